@@ -0,0 +1,202 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"net"
+	"sort"
+)
+
+// uint128 holds an IPv4 or IPv6 address as an integer so ranges can be merged arithmetically.
+type uint128 struct {
+	hi, lo uint64
+}
+
+func (u uint128) less(v uint128) bool {
+	return u.hi < v.hi || (u.hi == v.hi && u.lo < v.lo)
+}
+
+func (u uint128) or(v uint128) uint128 {
+	return uint128{hi: u.hi | v.hi, lo: u.lo | v.lo}
+}
+
+func (u uint128) addOne() uint128 {
+	lo := u.lo + 1
+	hi := u.hi
+	if lo == 0 {
+		hi++
+	}
+
+	return uint128{hi: hi, lo: lo}
+}
+
+func (u uint128) trailingZeros() int {
+	if u.lo != 0 {
+		return bits.TrailingZeros64(u.lo)
+	}
+
+	return 64 + bits.TrailingZeros64(u.hi)
+}
+
+// lowBits returns a value with the n lowest bits set.
+func lowBits(n int) uint128 {
+	switch {
+	case n >= 128:
+		return uint128{hi: ^uint64(0), lo: ^uint64(0)}
+	case n >= 64:
+		return uint128{hi: 1<<uint(n-64) - 1, lo: ^uint64(0)}
+	default:
+		return uint128{lo: 1<<uint(n) - 1}
+	}
+}
+
+type ipInterval struct {
+	start, end uint128
+}
+
+// rangeAggregator collects networks per label and returns the minimal set of CIDRs
+// covering them, merging overlapping and adjacent networks.
+type rangeAggregator struct {
+	labels    []string
+	intervals map[string]*[2][]ipInterval
+}
+
+func newRangeAggregator() *rangeAggregator {
+	return &rangeAggregator{intervals: make(map[string]*[2][]ipInterval)}
+}
+
+func (a *rangeAggregator) add(label string, network *net.IPNet) {
+	family, width, start := 0, 32, uint128{}
+	if ip := network.IP.To4(); ip != nil {
+		start.lo = uint64(binary.BigEndian.Uint32(ip))
+	} else {
+		family, width = 1, 128
+		start = uint128{hi: binary.BigEndian.Uint64(network.IP[:8]), lo: binary.BigEndian.Uint64(network.IP[8:16])}
+	}
+
+	ones, bits := network.Mask.Size()
+	if family == 0 && bits == 128 {
+		// an IPv4-mapped IPv6 network (::ffff:192.0.2.0/120) keeps its 16 byte mask
+		ones -= 96
+	}
+	host := lowBits(width - ones)
+	start = uint128{hi: start.hi &^ host.hi, lo: start.lo &^ host.lo}
+
+	families, ok := a.intervals[label]
+	if !ok {
+		families = &[2][]ipInterval{}
+		a.intervals[label] = families
+		a.labels = append(a.labels, label)
+	}
+	families[family] = append(families[family], ipInterval{start: start, end: start.or(host)})
+}
+
+// ranges returns the aggregated CIDRs, IPv4 before IPv6, each in address order.
+func (a *rangeAggregator) ranges() []labeledRange {
+	type aggregated struct {
+		family int
+		start  uint128
+		entry  labeledRange
+	}
+
+	result := make([]aggregated, 0)
+	for _, label := range a.labels {
+		for family, intervals := range a.intervals[label] {
+			width := 32
+			if family == 1 {
+				width = 128
+			}
+			for _, interval := range mergeIntervals(intervals, width) {
+				for _, block := range intervalCIDRs(interval, width) {
+					result = append(result, aggregated{
+						family: family,
+						start:  block.start,
+						entry:  labeledRange{CIDR: block.network.String(), Label: label},
+					})
+				}
+			}
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].family != result[j].family {
+			return result[i].family < result[j].family
+		}
+		return result[i].start.less(result[j].start)
+	})
+
+	ranges := make([]labeledRange, 0, len(result))
+	for _, item := range result {
+		ranges = append(ranges, item.entry)
+	}
+
+	return ranges
+}
+
+func mergeIntervals(intervals []ipInterval, width int) []ipInterval {
+	if len(intervals) == 0 {
+		return nil
+	}
+
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].start.less(intervals[j].start) })
+
+	last := lowBits(width)
+	merged := []ipInterval{intervals[0]}
+	for _, next := range intervals[1:] {
+		current := &merged[len(merged)-1]
+		if current.end != last && current.end.addOne().less(next.start) {
+			merged = append(merged, next)
+			continue
+		}
+		if current.end.less(next.end) {
+			current.end = next.end
+		}
+	}
+
+	return merged
+}
+
+type cidrBlock struct {
+	start   uint128
+	network *net.IPNet
+}
+
+// intervalCIDRs splits an interval into the largest aligned blocks it contains.
+func intervalCIDRs(interval ipInterval, width int) []cidrBlock {
+	blocks := make([]cidrBlock, 0, 1)
+	last := lowBits(width)
+
+	start := interval.start
+	for {
+		size := start.trailingZeros()
+		if size > width {
+			size = width
+		}
+		end := start.or(lowBits(size))
+		for interval.end.less(end) {
+			size--
+			end = start.or(lowBits(size))
+		}
+
+		blocks = append(blocks, cidrBlock{start: start, network: uint128Network(start, width-size, width)})
+
+		if end == interval.end || end == last {
+			return blocks
+		}
+		start = end.addOne()
+	}
+}
+
+func uint128Network(start uint128, ones, width int) *net.IPNet {
+	if width == 32 {
+		ip := make(net.IP, net.IPv4len)
+		binary.BigEndian.PutUint32(ip, uint32(start.lo))
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(ones, 32)}
+	}
+
+	ip := make(net.IP, net.IPv6len)
+	binary.BigEndian.PutUint64(ip[:8], start.hi)
+	binary.BigEndian.PutUint64(ip[8:], start.lo)
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(ones, 128)}
+}
@@ -0,0 +1,319 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	awsTimeFormat = "20060102T150405Z"
+	awsDateFormat = "20060102"
+	// awsEmptyPayloadHash is the SHA-256 of an empty body.
+	awsEmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	// awsCredentialRefresh renews temporary credentials this long before they expire.
+	awsCredentialRefresh = 5 * time.Minute
+	defaultAWSRegion     = "us-east-1"
+)
+
+type awsCredentials struct {
+	accessKeyID     string
+	secretAccessKey string
+	sessionToken    string
+	expires         time.Time
+}
+
+// awsAuthSettings are the credential settings shared by the AWS-signed sources.
+// Static keys win over web identity; both fall back to the standard AWS_* variables.
+type awsAuthSettings struct {
+	accessKeyID          string
+	secretAccessKey      string
+	sessionToken         string
+	roleARN              string
+	webIdentityTokenFile string
+	stsEndpoint          string
+	region               string
+}
+
+// awsCredentialProvider returns static credentials, or temporary credentials obtained
+// with AssumeRoleWithWebIdentity and cached until shortly before they expire.
+type awsCredentialProvider struct {
+	static               awsCredentials
+	roleARN              string
+	webIdentityTokenFile string
+	stsEndpoint          string
+	client               *http.Client
+
+	mu     sync.Mutex
+	cached awsCredentials
+}
+
+func newAWSCredentialProvider(settings awsAuthSettings, client *http.Client) (*awsCredentialProvider, error) {
+	static := awsCredentials{
+		accessKeyID:     strings.TrimSpace(settings.accessKeyID),
+		secretAccessKey: strings.TrimSpace(settings.secretAccessKey),
+		sessionToken:    strings.TrimSpace(settings.sessionToken),
+	}
+	if static.accessKeyID == "" && static.secretAccessKey == "" {
+		static = awsCredentials{
+			accessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			sessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}
+	}
+	if (static.accessKeyID == "") != (static.secretAccessKey == "") {
+		return nil, fmt.Errorf("accessKeyID and secretAccessKey must be set together")
+	}
+
+	provider := &awsCredentialProvider{static: static, client: client}
+	if static.accessKeyID != "" {
+		return provider, nil
+	}
+
+	provider.roleARN = strings.TrimSpace(settings.roleARN)
+	if provider.roleARN == "" {
+		provider.roleARN = os.Getenv("AWS_ROLE_ARN")
+	}
+	provider.webIdentityTokenFile = strings.TrimSpace(settings.webIdentityTokenFile)
+	if provider.webIdentityTokenFile == "" {
+		provider.webIdentityTokenFile = os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE")
+	}
+	if provider.roleARN == "" || provider.webIdentityTokenFile == "" {
+		return nil, fmt.Errorf("credentials required: set accessKeyID/secretAccessKey or roleARN/webIdentityTokenFile")
+	}
+
+	provider.stsEndpoint = strings.TrimSuffix(strings.TrimSpace(settings.stsEndpoint), "/")
+	if provider.stsEndpoint == "" {
+		provider.stsEndpoint = "https://sts." + settings.region + ".amazonaws.com"
+	}
+
+	return provider, nil
+}
+
+func (p *awsCredentialProvider) retrieve(ctx context.Context) (awsCredentials, error) {
+	if p.static.accessKeyID != "" {
+		return p.static, nil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cached.accessKeyID != "" && time.Until(p.cached.expires) > awsCredentialRefresh {
+		return p.cached, nil
+	}
+
+	credentials, err := p.assumeRoleWithWebIdentity(ctx)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	p.cached = credentials
+
+	return credentials, nil
+}
+
+type assumeRoleWithWebIdentityResponse struct {
+	Credentials struct {
+		AccessKeyID     string    `xml:"AccessKeyId"`
+		SecretAccessKey string    `xml:"SecretAccessKey"`
+		SessionToken    string    `xml:"SessionToken"`
+		Expiration      time.Time `xml:"Expiration"`
+	} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+}
+
+// assumeRoleWithWebIdentity exchanges the (rotating) token file for temporary credentials.
+// The call is not signed, the token authenticates it.
+func (p *awsCredentialProvider) assumeRoleWithWebIdentity(ctx context.Context) (awsCredentials, error) {
+	token, err := os.ReadFile(p.webIdentityTokenFile)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+
+	query := url.Values{}
+	query.Set("Action", "AssumeRoleWithWebIdentity")
+	query.Set("Version", "2011-06-15")
+	query.Set("RoleArn", p.roleARN)
+	query.Set("RoleSessionName", "traefik-dynamic-public-whitelist-"+strconv.FormatInt(time.Now().Unix(), 10))
+	query.Set("WebIdentityToken", strings.TrimSpace(string(token)))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.stsEndpoint+"/", strings.NewReader(query.Encode()))
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	defer closeBody(resp.Body)
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return awsCredentials{}, fmt.Errorf("sts: AssumeRoleWithWebIdentity: %s", awsErrorMessage(resp.StatusCode, body))
+	}
+
+	var response assumeRoleWithWebIdentityResponse
+	if err := xml.Unmarshal(body, &response); err != nil {
+		return awsCredentials{}, fmt.Errorf("sts: %w", err)
+	}
+	if response.Credentials.AccessKeyID == "" {
+		return awsCredentials{}, fmt.Errorf("sts: response holds no credentials")
+	}
+
+	return awsCredentials{
+		accessKeyID:     response.Credentials.AccessKeyID,
+		secretAccessKey: response.Credentials.SecretAccessKey,
+		sessionToken:    response.Credentials.SessionToken,
+		expires:         response.Credentials.Expiration,
+	}, nil
+}
+
+// awsErrorMessage extracts the Code and Message of an AWS XML error body.
+func awsErrorMessage(status int, body []byte) string {
+	var response struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+		Error   struct {
+			Code    string `xml:"Code"`
+			Message string `xml:"Message"`
+		} `xml:"Error"`
+		Errors struct {
+			Error struct {
+				Code    string `xml:"Code"`
+				Message string `xml:"Message"`
+			} `xml:"Error"`
+		} `xml:"Errors"`
+	}
+	_ = xml.Unmarshal(body, &response)
+
+	for _, candidate := range [][2]string{
+		{response.Code, response.Message},
+		{response.Error.Code, response.Error.Message},
+		{response.Errors.Error.Code, response.Errors.Error.Message},
+	} {
+		if candidate[0] != "" {
+			return fmt.Sprintf("status %d %s: %s", status, candidate[0], candidate[1])
+		}
+	}
+
+	return fmt.Sprintf("status %d", status)
+}
+
+// signAWSRequest adds a Signature Version 4 Authorization header to req.
+// payloadHash is the hex SHA-256 of the body.
+func signAWSRequest(req *http.Request, credentials awsCredentials, region, service, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(awsTimeFormat)
+	date := now.Format(awsDateFormat)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if credentials.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" {
+			headers[lower] = strings.Join(strings.Fields(strings.Join(values, ",")), " ")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsCanonicalPath(req.URL.Path),
+		awsCanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+credentials.secretAccessKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+credentials.accessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// awsURIEncode applies the SigV4 encoding: only unreserved characters stay literal,
+// slashes are kept unless encodeSlash is set.
+func awsURIEncode(raw string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			encoded.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			encoded.WriteByte(c)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", c)
+		}
+	}
+
+	return encoded.String()
+}
+
+func awsCanonicalPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+
+	return awsURIEncode(path, false)
+}
+
+func awsCanonicalQuery(query url.Values) string {
+	pairs := make([]string, 0, len(query))
+	for key, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, awsURIEncode(key, true)+"="+awsURIEncode(value, true))
+		}
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, "&")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,160 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+// clientIPHeaderAuto picks the real-client-IP header of the configured CDN provider.
+const clientIPHeaderAuto = "auto"
+
+// cdnClientIPHeaders maps CDN providers to the header carrying the original client IP.
+// CloudFront is left out: CloudFront-Viewer-Address carries "ip:port", which would key
+// the limit on every connection instead of every client.
+var cdnClientIPHeaders = map[string]string{
+	providerCloudflare: "CF-Connecting-IP",
+	providerFastly:     "Fastly-Client-IP",
+}
+
+// RateLimitConfig configures the optional RateLimit middleware chained after the allowlist.
+type RateLimitConfig struct {
+	Average int64  `json:"average,omitempty"`
+	Period  string `json:"period,omitempty"`
+	Burst   int64  `json:"burst,omitempty"`
+	// ClientIPHeader keys the limit on a request header instead of the IP strategy.
+	// "auto" uses the real-client-IP header of the configured CDN provider.
+	ClientIPHeader string `json:"clientIPHeader,omitempty"`
+}
+
+// InFlightReqConfig configures the optional InFlightReq middleware chained after the allowlist.
+type InFlightReqConfig struct {
+	Amount int64 `json:"amount,omitempty"`
+}
+
+type sourceCriterionV3 struct {
+	IPStrategy        *IPStrategyV3 `json:"ipStrategy,omitempty"`
+	RequestHeaderName string        `json:"requestHeaderName,omitempty"`
+}
+
+type rateLimitV3 struct {
+	*dynamic.RateLimit
+	SourceCriterion *sourceCriterionV3 `json:"sourceCriterion,omitempty"`
+}
+
+type inFlightReqV3 struct {
+	*dynamic.InFlightReq
+	SourceCriterion *sourceCriterionV3 `json:"sourceCriterion,omitempty"`
+}
+
+func validateChain(config *Config, providerNames []string, outputSchema string) (string, error) {
+	if config.RateLimit == nil && config.InFlightReq == nil {
+		return "", nil
+	}
+
+	if outputSchema == outputSchemaBoth {
+		return "", fmt.Errorf("rateLimit and inFlightReq require outputSchema %q or %q", outputSchemaV2, outputSchemaV3)
+	}
+
+	if config.InFlightReq != nil && config.InFlightReq.Amount <= 0 {
+		return "", fmt.Errorf("inFlightReq.amount must be greater than 0")
+	}
+
+	if config.RateLimit == nil {
+		return "", nil
+	}
+
+	if config.RateLimit.Average < 0 || config.RateLimit.Burst < 0 {
+		return "", fmt.Errorf("rateLimit.average and rateLimit.burst must not be negative")
+	}
+
+	header := strings.TrimSpace(config.RateLimit.ClientIPHeader)
+	if !strings.EqualFold(header, clientIPHeaderAuto) {
+		return header, nil
+	}
+
+	header = ""
+	for _, providerName := range providerNames {
+		if providerName == providerCloudfront {
+			return "", fmt.Errorf("rateLimit.clientIPHeader %q is not available for cloudfront, set a header carrying only the client IP", clientIPHeaderAuto)
+		}
+		candidate, ok := cdnClientIPHeaders[providerName]
+		if !ok {
+			continue
+		}
+		if header != "" && header != candidate {
+			return "", fmt.Errorf("rateLimit.clientIPHeader %q is ambiguous with providers %v", clientIPHeaderAuto, providerNames)
+		}
+		header = candidate
+	}
+
+	if header == "" {
+		return "", fmt.Errorf("rateLimit.clientIPHeader %q requires a CDN provider", clientIPHeaderAuto)
+	}
+
+	return header, nil
+}
+
+// addChainMiddlewares emits the RateLimit/InFlightReq middlewares sharing the allowlist IP strategy,
+// and a Chain wrapping the allowlist and both of them in order.
+// It returns the name of the middleware routers should reference.
+func (p *Provider) addChainMiddlewares(result *payload, resolved *resolvedRanges, allowListName string) string {
+	if p.rateLimit == nil && p.inFlightReq == nil {
+		return allowListName
+	}
+
+	middlewares := result.Configuration.HTTP.Middlewares
+	chain := []string{allowListName}
+	rateLimitMiddlewareName := p.middlewareNames[middlewareKindRateLimit]
+	inFlightReqMiddlewareName := p.middlewareNames[middlewareKindInFlightReq]
+	chainMiddlewareName := p.middlewareNames[middlewareKindChain]
+
+	// genconf has no ipv6Subnet, so v3 criteria carrying it are merged at marshal time.
+	withIPv6Subnet := schemaEmitsV3(p.outputSchema) && p.ipv6Subnet != 0
+
+	if p.rateLimit != nil {
+		rateLimit := &dynamic.RateLimit{
+			Average: p.rateLimit.Average,
+			Period:  p.rateLimit.Period,
+			Burst:   p.rateLimit.Burst,
+		}
+
+		if p.clientIPHeader != "" {
+			rateLimit.SourceCriterion = &dynamic.SourceCriterion{RequestHeaderName: p.clientIPHeader}
+			middlewares[rateLimitMiddlewareName] = &dynamic.Middleware{RateLimit: rateLimit}
+		} else if withIPv6Subnet {
+			result.setMiddlewareField(rateLimitMiddlewareName, "rateLimit", &rateLimitV3{
+				RateLimit:       rateLimit,
+				SourceCriterion: &sourceCriterionV3{IPStrategy: p.ipStrategyV3(resolved)},
+			})
+		} else {
+			rateLimit.SourceCriterion = &dynamic.SourceCriterion{IPStrategy: p.ipStrategyV2(resolved)}
+			middlewares[rateLimitMiddlewareName] = &dynamic.Middleware{RateLimit: rateLimit}
+		}
+
+		chain = append(chain, rateLimitMiddlewareName)
+	}
+
+	if p.inFlightReq != nil {
+		inFlightReq := &dynamic.InFlightReq{Amount: p.inFlightReq.Amount}
+
+		if withIPv6Subnet {
+			result.setMiddlewareField(inFlightReqMiddlewareName, "inFlightReq", &inFlightReqV3{
+				InFlightReq:     inFlightReq,
+				SourceCriterion: &sourceCriterionV3{IPStrategy: p.ipStrategyV3(resolved)},
+			})
+		} else {
+			inFlightReq.SourceCriterion = &dynamic.SourceCriterion{IPStrategy: p.ipStrategyV2(resolved)}
+			middlewares[inFlightReqMiddlewareName] = &dynamic.Middleware{InFlightReq: inFlightReq}
+		}
+
+		chain = append(chain, inFlightReqMiddlewareName)
+	}
+
+	middlewares[chainMiddlewareName] = &dynamic.Middleware{
+		Chain: &dynamic.Chain{Middlewares: chain},
+	}
+
+	return chainMiddlewareName
+}
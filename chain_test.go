@@ -0,0 +1,161 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+	"github.com/traefik/genconf/dynamic"
+)
+
+func TestChainMiddlewares(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("198.51.100.7"))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := baseConfig(traefikdynamicpublicwhitelist.ProviderCustom)
+	cfg.IPv4Resolver = srv.URL
+	cfg.IPStrategy = dynamic.IPStrategy{Depth: 2, ExcludedIPs: []string{"10.0.0.1"}}
+	cfg.RateLimit = &traefikdynamicpublicwhitelist.RateLimitConfig{Average: 100, Period: "1s", Burst: 50}
+	cfg.InFlightReq = &traefikdynamicpublicwhitelist.InFlightReqConfig{Amount: 10}
+
+	configuration := loadOnce(t, cfg)
+	middlewares := configuration.HTTP.Middlewares
+
+	chain := middlewares["public_chain"]
+	if chain == nil || chain.Chain == nil {
+		t.Fatalf("missing chain middleware: %v", middlewares)
+	}
+	if got := strings.Join(chain.Chain.Middlewares, ","); got != "public_ipwhitelist,public_ratelimit,public_inflightreq" {
+		t.Fatalf("unexpected chain order: %s", got)
+	}
+
+	rateLimit := middlewares["public_ratelimit"].RateLimit
+	if rateLimit.Average != 100 || rateLimit.Burst != 50 || rateLimit.Period != "1s" {
+		t.Fatalf("unexpected rate limit: %+v", rateLimit)
+	}
+	assertStrategy(t, rateLimit.SourceCriterion.IPStrategy)
+	assertStrategy(t, middlewares["public_inflightreq"].InFlightReq.SourceCriterion.IPStrategy)
+}
+
+func TestChainRateLimitCDNHeader(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("198.51.100.0/24"))
+	}))
+	t.Cleanup(srv.Close)
+
+	traefikdynamicpublicwhitelist.SetCloudflareEndpoints(srv.URL, "")
+	t.Cleanup(func() {
+		traefikdynamicpublicwhitelist.SetCloudflareEndpoints(
+			"https://www.cloudflare.com/ips-v4/",
+			"https://www.cloudflare.com/ips-v6/",
+		)
+	})
+
+	cfg := baseConfig(traefikdynamicpublicwhitelist.ProviderCloudflare)
+	cfg.RateLimit = &traefikdynamicpublicwhitelist.RateLimitConfig{Average: 10, ClientIPHeader: "auto"}
+
+	configuration := loadOnce(t, cfg)
+
+	criterion := configuration.HTTP.Middlewares["public_ratelimit"].RateLimit.SourceCriterion
+	if criterion.RequestHeaderName != "CF-Connecting-IP" || criterion.IPStrategy != nil {
+		t.Fatalf("unexpected source criterion: %+v", criterion)
+	}
+}
+
+func TestChainRateLimitAutoHeaderPerCDN(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fastly" {
+			_, _ = w.Write([]byte(`{"addresses":["151.101.0.0/16"]}`))
+			return
+		}
+		_, _ = w.Write([]byte("198.51.100.0/24"))
+	}))
+	t.Cleanup(srv.Close)
+
+	traefikdynamicpublicwhitelist.SetCloudflareEndpoints(srv.URL, "")
+	traefikdynamicpublicwhitelist.SetFastlyEndpoint(srv.URL + "/fastly")
+	t.Cleanup(func() {
+		traefikdynamicpublicwhitelist.SetCloudflareEndpoints(
+			"https://www.cloudflare.com/ips-v4/",
+			"https://www.cloudflare.com/ips-v6/",
+		)
+		traefikdynamicpublicwhitelist.SetFastlyEndpoint("https://api.fastly.com/public-ip-list")
+	})
+
+	for provider, header := range map[string]string{
+		traefikdynamicpublicwhitelist.ProviderCloudflare: "CF-Connecting-IP",
+		traefikdynamicpublicwhitelist.ProviderFastly:     "Fastly-Client-IP",
+	} {
+		cfg := baseConfig(provider)
+		cfg.RateLimit = &traefikdynamicpublicwhitelist.RateLimitConfig{Average: 10, ClientIPHeader: "auto"}
+
+		configuration := loadOnce(t, cfg)
+		if got := configuration.HTTP.Middlewares["public_ratelimit"].RateLimit.SourceCriterion.RequestHeaderName; got != header {
+			t.Fatalf("%s: unexpected client IP header %q", provider, got)
+		}
+	}
+
+	// CloudFront only sends the client address with its port, one value per connection
+	for _, providers := range []string{"cloudfront", "cloudflare,cloudfront"} {
+		cfg := baseConfig(providers)
+		cfg.RateLimit = &traefikdynamicpublicwhitelist.RateLimitConfig{Average: 10, ClientIPHeader: "auto"}
+		if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil || !strings.Contains(err.Error(), "cloudfront") {
+			t.Fatalf("%s: expected auto to be rejected, got %v", providers, err)
+		}
+	}
+}
+
+func TestChainV3IPv6Subnet(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("198.51.100.7"))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := baseConfig(traefikdynamicpublicwhitelist.ProviderCustom)
+	cfg.IPv4Resolver = srv.URL
+	cfg.OutputSchema = traefikdynamicpublicwhitelist.OutputSchemaV3
+	cfg.IPv6Subnet = 56
+	cfg.InFlightReq = &traefikdynamicpublicwhitelist.InFlightReqConfig{Amount: 5}
+
+	middlewares := emittedMiddlewares(t, cfg)
+
+	chain := middlewareSection(t, middlewares, "public_chain", "chain")
+	members, _ := chain["middlewares"].([]interface{})
+	if len(members) != 2 || members[0] != "public_ipallowlist" {
+		t.Fatalf("unexpected chain: %v", chain)
+	}
+
+	inFlight := middlewareSection(t, middlewares, "public_inflightreq", "inFlightReq")
+	criterion, _ := inFlight["sourceCriterion"].(map[string]interface{})
+	strategy, _ := criterion["ipStrategy"].(map[string]interface{})
+	if strategy["ipv6Subnet"] != float64(56) || inFlight["amount"] != float64(5) {
+		t.Fatalf("unexpected inFlightReq: %v", inFlight)
+	}
+}
+
+func TestChainValidation(t *testing.T) {
+	cfg := baseConfig(traefikdynamicpublicwhitelist.ProviderCustom)
+	cfg.OutputSchema = traefikdynamicpublicwhitelist.OutputSchemaBoth
+	cfg.InFlightReq = &traefikdynamicpublicwhitelist.InFlightReqConfig{Amount: 5}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error when chaining with outputSchema both")
+	}
+
+	cfg = baseConfig(traefikdynamicpublicwhitelist.ProviderCustom)
+	cfg.RateLimit = &traefikdynamicpublicwhitelist.RateLimitConfig{Average: 10, ClientIPHeader: "auto"}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error when clientIPHeader auto has no CDN provider")
+	}
+}
+
+func assertStrategy(t *testing.T, strategy *dynamic.IPStrategy) {
+	t.Helper()
+	if strategy == nil || strategy.Depth != 2 || strings.Join(strategy.ExcludedIPs, ",") != "10.0.0.1" {
+		t.Fatalf("unexpected ip strategy: %+v", strategy)
+	}
+}
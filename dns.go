@@ -0,0 +1,332 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	dnsTypeA     = 1
+	dnsTypeCNAME = 5
+	dnsTypeMX    = 15
+	dnsTypeTXT   = 16
+	dnsTypeAAAA  = 28
+
+	dnsClassINET = 1
+
+	dnsRcodeSuccess  = 0
+	dnsRcodeNXDomain = 3
+
+	dnsTimeout        = 5 * time.Second
+	defaultDNSServer  = "127.0.0.1:53"
+	resolvConfPath    = "/etc/resolv.conf"
+	dnsMaxMessageSize = 65535
+)
+
+var errDNSNotFound = errors.New("no such host")
+
+// dnsRecord is one answer record; only the field matching Type is set.
+type dnsRecord struct {
+	Type uint16
+	TTL  uint32
+	IP   net.IP
+	Text string
+	Host string
+}
+
+// dnsClient is a minimal stub resolver. Go's net.Resolver does not expose record TTLs
+// or TXT/MX records through a configurable server, so queries are encoded here.
+type dnsClient struct {
+	server  string
+	timeout time.Duration
+}
+
+// newDNSClient targets server (host or host:port), defaulting to the first resolv.conf nameserver.
+func newDNSClient(server string) *dnsClient {
+	server = strings.TrimSpace(server)
+	if server == "" {
+		server = systemDNSServer()
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(strings.Trim(server, "[]"), "53")
+	}
+
+	return &dnsClient{server: server, timeout: dnsTimeout}
+}
+
+func systemDNSServer() string {
+	file, err := os.Open(resolvConfPath)
+	if err != nil {
+		return defaultDNSServer
+	}
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return fields[1]
+		}
+	}
+
+	return defaultDNSServer
+}
+
+// query resolves name and returns the answer records of qtype, following the CNAME chain
+// returned by the recursive server. A missing name returns errDNSNotFound, no data an empty list.
+func (c *dnsClient) query(ctx context.Context, name string, qtype uint16) ([]dnsRecord, error) {
+	id, request, err := buildDNSQuery(name, qtype)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := c.exchange(ctx, "udp", request)
+	if err != nil {
+		return nil, err
+	}
+	if len(response) > 2 && response[2]&0x02 != 0 {
+		// truncated, retry over TCP
+		if response, err = c.exchange(ctx, "tcp", request); err != nil {
+			return nil, err
+		}
+	}
+
+	return parseDNSResponse(response, id, qtype)
+}
+
+func (c *dnsClient) exchange(ctx context.Context, network string, request []byte) ([]byte, error) {
+	dialer := &net.Dialer{Timeout: c.timeout}
+	conn, err := dialer.DialContext(ctx, network, c.server)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	deadline := time.Now().Add(c.timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	if network == "tcp" {
+		framed := make([]byte, 2+len(request))
+		binary.BigEndian.PutUint16(framed, uint16(len(request)))
+		copy(framed[2:], request)
+		if _, err := conn.Write(framed); err != nil {
+			return nil, err
+		}
+
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		response := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, response); err != nil {
+			return nil, err
+		}
+		return response, nil
+	}
+
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	response := make([]byte, dnsMaxMessageSize)
+	n, err := conn.Read(response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response[:n], nil
+}
+
+func buildDNSQuery(name string, qtype uint16) (uint16, []byte, error) {
+	var idBytes [2]byte
+	if _, err := rand.Read(idBytes[:]); err != nil {
+		return 0, nil, err
+	}
+	id := binary.BigEndian.Uint16(idBytes[:])
+
+	message := make([]byte, 12, 12+len(name)+6)
+	binary.BigEndian.PutUint16(message[0:], id)
+	message[2] = 0x01 // recursion desired
+	binary.BigEndian.PutUint16(message[4:], 1)
+
+	encoded, err := encodeDNSName(name)
+	if err != nil {
+		return 0, nil, err
+	}
+	message = append(message, encoded...)
+	message = append(message, byte(qtype>>8), byte(qtype), 0, dnsClassINET)
+
+	return id, message, nil
+}
+
+func encodeDNSName(name string) ([]byte, error) {
+	name = strings.TrimSuffix(strings.TrimSpace(name), ".")
+	if name == "" {
+		return nil, fmt.Errorf("empty DNS name")
+	}
+
+	encoded := make([]byte, 0, len(name)+2)
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 {
+			return nil, fmt.Errorf("invalid DNS name %q", name)
+		}
+		encoded = append(encoded, byte(len(label)))
+		encoded = append(encoded, label...)
+	}
+	if len(encoded) > 254 {
+		return nil, fmt.Errorf("DNS name %q is too long", name)
+	}
+
+	return append(encoded, 0), nil
+}
+
+func parseDNSResponse(message []byte, id, qtype uint16) ([]dnsRecord, error) {
+	if len(message) < 12 {
+		return nil, fmt.Errorf("dns: short response")
+	}
+	if binary.BigEndian.Uint16(message) != id {
+		return nil, fmt.Errorf("dns: response id mismatch")
+	}
+
+	switch rcode := message[3] & 0x0f; rcode {
+	case dnsRcodeSuccess:
+	case dnsRcodeNXDomain:
+		return nil, errDNSNotFound
+	default:
+		return nil, fmt.Errorf("dns: server returned rcode %d", rcode)
+	}
+
+	questions := int(binary.BigEndian.Uint16(message[4:]))
+	answers := int(binary.BigEndian.Uint16(message[6:]))
+
+	offset := 12
+	for i := 0; i < questions; i++ {
+		var err error
+		if _, offset, err = readDNSName(message, offset); err != nil {
+			return nil, err
+		}
+		offset += 4
+	}
+
+	records := make([]dnsRecord, 0, answers)
+	for i := 0; i < answers; i++ {
+		var err error
+		if _, offset, err = readDNSName(message, offset); err != nil {
+			return nil, err
+		}
+		if offset+10 > len(message) {
+			return nil, fmt.Errorf("dns: truncated record")
+		}
+
+		recordType := binary.BigEndian.Uint16(message[offset:])
+		ttl := binary.BigEndian.Uint32(message[offset+4:])
+		length := int(binary.BigEndian.Uint16(message[offset+8:]))
+		offset += 10
+		if offset+length > len(message) {
+			return nil, fmt.Errorf("dns: truncated record data")
+		}
+		data := message[offset : offset+length]
+		start := offset
+		offset += length
+
+		if recordType != qtype {
+			continue
+		}
+
+		record := dnsRecord{Type: recordType, TTL: ttl}
+		switch recordType {
+		case dnsTypeA:
+			if length != net.IPv4len {
+				return nil, fmt.Errorf("dns: invalid A record")
+			}
+			record.IP = net.IP(append([]byte(nil), data...))
+		case dnsTypeAAAA:
+			if length != net.IPv6len {
+				return nil, fmt.Errorf("dns: invalid AAAA record")
+			}
+			record.IP = net.IP(append([]byte(nil), data...))
+		case dnsTypeTXT:
+			var b strings.Builder
+			for pos := 0; pos < len(data); {
+				size := int(data[pos])
+				if pos+1+size > len(data) {
+					return nil, fmt.Errorf("dns: invalid TXT record")
+				}
+				b.Write(data[pos+1 : pos+1+size])
+				pos += 1 + size
+			}
+			record.Text = b.String()
+		case dnsTypeMX:
+			if length < 3 {
+				return nil, fmt.Errorf("dns: invalid MX record")
+			}
+			host, _, err := readDNSName(message, start+2)
+			if err != nil {
+				return nil, err
+			}
+			record.Host = host
+		case dnsTypeCNAME:
+			host, _, err := readDNSName(message, start)
+			if err != nil {
+				return nil, err
+			}
+			record.Host = host
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// readDNSName decodes a possibly compressed name, returning the offset following it.
+func readDNSName(message []byte, offset int) (string, int, error) {
+	labels := make([]string, 0, 4)
+	next := -1
+
+	for jumps := 0; ; {
+		if offset >= len(message) {
+			return "", 0, fmt.Errorf("dns: truncated name")
+		}
+
+		size := int(message[offset])
+		switch {
+		case size == 0:
+			if next < 0 {
+				next = offset + 1
+			}
+			return strings.Join(labels, "."), next, nil
+		case size&0xc0 == 0xc0:
+			if offset+1 >= len(message) {
+				return "", 0, fmt.Errorf("dns: truncated name")
+			}
+			if jumps++; jumps > 32 {
+				return "", 0, fmt.Errorf("dns: compression loop")
+			}
+			if next < 0 {
+				next = offset + 2
+			}
+			offset = int(binary.BigEndian.Uint16(message[offset:]) & 0x3fff)
+		default:
+			if offset+1+size > len(message) {
+				return "", 0, fmt.Errorf("dns: truncated name")
+			}
+			labels = append(labels, string(message[offset+1:offset+1+size]))
+			offset += 1 + size
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHMACSignatureHeader = "X-Signature"
+	defaultHMACTimestampHeader = "X-Timestamp"
+	hmacContentHashHeader      = "X-Content-SHA256"
+	hmacKeyIDHeader            = "X-Key-ID"
+	maxAuthRedirects           = 10
+
+	redacted = "REDACTED"
+)
+
+// HTTPAuthConfig authenticates the requests of a URL based source or of the custom resolvers.
+type HTTPAuthConfig struct {
+	// Headers are added to every request.
+	Headers map[string]string `json:"headers,omitempty"`
+	// BearerToken sends "Authorization: Bearer <token>".
+	BearerToken string `json:"bearerToken,omitempty"`
+	// Username and Password send Basic auth.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// HMAC signs every request, see HMACAuthConfig.
+	HMAC *HMACAuthConfig `json:"hmac,omitempty"`
+}
+
+// HMACAuthConfig signs "<timestamp>\n<method>\n<path?query>\n<hex sha256 of the body>" with the
+// secret. The timestamp (Unix seconds), body hash and hex signature are sent as headers.
+type HMACAuthConfig struct {
+	Secret string `json:"secret,omitempty"`
+	// Algorithm is "sha256" (default) or "sha512".
+	Algorithm string `json:"algorithm,omitempty"`
+	// KeyID is sent in X-Key-ID when set.
+	KeyID           string `json:"keyID,omitempty"`
+	SignatureHeader string `json:"signatureHeader,omitempty"`
+	TimestampHeader string `json:"timestampHeader,omitempty"`
+}
+
+// httpAuth applies an HTTPAuthConfig to requests and knows its secrets for redaction.
+type httpAuth struct {
+	headers  http.Header
+	bearer   string
+	username string
+	password string
+
+	hmacSecret          []byte
+	hmacHash            func() hash.Hash
+	hmacKeyID           string
+	hmacSignatureHeader string
+	hmacTimestampHeader string
+
+	secrets []string
+}
+
+func newHTTPAuth(config *HTTPAuthConfig) (*httpAuth, error) {
+	auth := &httpAuth{
+		headers:  http.Header{},
+		bearer:   strings.TrimSpace(config.BearerToken),
+		username: config.Username,
+		password: config.Password,
+	}
+
+	for name, value := range config.Headers {
+		name = strings.TrimSpace(name)
+		if name == "" || strings.ContainsAny(name, " :\r\n") || strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("headers: invalid header %q", name)
+		}
+		auth.headers.Set(name, value)
+		if sensitiveName(name) {
+			auth.secrets = append(auth.secrets, value)
+		}
+	}
+
+	if auth.bearer != "" && (auth.username != "" || auth.password != "") {
+		return nil, fmt.Errorf("bearerToken and username/password cannot be combined")
+	}
+	if auth.password != "" && auth.username == "" {
+		return nil, fmt.Errorf("password requires username")
+	}
+	if (auth.bearer != "" || auth.username != "") && auth.headers.Get("Authorization") != "" {
+		return nil, fmt.Errorf("headers: Authorization conflicts with bearerToken or username")
+	}
+	auth.secrets = append(auth.secrets, auth.bearer, auth.password)
+
+	if config.HMAC != nil {
+		if config.HMAC.Secret == "" {
+			return nil, fmt.Errorf("hmac.secret is required")
+		}
+		auth.hmacSecret = []byte(config.HMAC.Secret)
+		auth.secrets = append(auth.secrets, config.HMAC.Secret)
+
+		switch strings.ToLower(strings.TrimSpace(config.HMAC.Algorithm)) {
+		case "", "sha256":
+			auth.hmacHash = sha256.New
+		case "sha512":
+			auth.hmacHash = sha512.New
+		default:
+			return nil, fmt.Errorf("hmac.algorithm: unsupported algorithm %q", config.HMAC.Algorithm)
+		}
+
+		auth.hmacKeyID = strings.TrimSpace(config.HMAC.KeyID)
+		auth.hmacSignatureHeader = strings.TrimSpace(config.HMAC.SignatureHeader)
+		if auth.hmacSignatureHeader == "" {
+			auth.hmacSignatureHeader = defaultHMACSignatureHeader
+		}
+		auth.hmacTimestampHeader = strings.TrimSpace(config.HMAC.TimestampHeader)
+		if auth.hmacTimestampHeader == "" {
+			auth.hmacTimestampHeader = defaultHMACTimestampHeader
+		}
+	}
+
+	return auth, nil
+}
+
+// apply sets the headers, credentials and signature of req, whose body is body.
+func (a *httpAuth) apply(req *http.Request, body []byte, now time.Time) {
+	for name, values := range a.headers {
+		req.Header[name] = append([]string(nil), values...)
+	}
+
+	if a.bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+a.bearer)
+	}
+	if a.username != "" {
+		req.SetBasicAuth(a.username, a.password)
+	}
+
+	if a.hmacSecret != nil {
+		timestamp := strconv.FormatInt(now.Unix(), 10)
+		bodyHash := sha256.Sum256(body)
+		contentHash := hex.EncodeToString(bodyHash[:])
+
+		mac := hmac.New(a.hmacHash, a.hmacSecret)
+		_, _ = mac.Write([]byte(timestamp + "\n" + req.Method + "\n" + req.URL.RequestURI() + "\n" + contentHash))
+
+		req.Header.Set(a.hmacTimestampHeader, timestamp)
+		req.Header.Set(hmacContentHashHeader, contentHash)
+		req.Header.Set(a.hmacSignatureHeader, hex.EncodeToString(mac.Sum(nil)))
+		if a.hmacKeyID != "" {
+			req.Header.Set(hmacKeyIDHeader, a.hmacKeyID)
+		}
+	}
+}
+
+// client returns a copy of base following redirects on the same scheme and host only, so
+// custom headers and HMAC signatures never reach another host, and re-signing every hop.
+func (a *httpAuth) client(base *http.Client) *http.Client {
+	client := *base
+	client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxAuthRedirects {
+			return fmt.Errorf("stopped after %d redirects", maxAuthRedirects)
+		}
+		if req.URL.Scheme != via[0].URL.Scheme || req.URL.Host != via[0].URL.Host {
+			return fmt.Errorf("refusing authenticated redirect to another host")
+		}
+		a.apply(req, nil, time.Now())
+
+		return nil
+	}
+
+	return &client
+}
+
+// redact replaces the secrets in message, e.g. when a server echoes a header in its error.
+func (a *httpAuth) redact(message string) string {
+	if a == nil {
+		return message
+	}
+	for _, secret := range a.secrets {
+		if secret != "" {
+			message = strings.ReplaceAll(message, secret, redacted)
+		}
+	}
+
+	return message
+}
+
+// redactURL hides the password and the values of credential-like query parameters.
+func redactURL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+
+	query := parsed.Query()
+	changed := false
+	for name := range query {
+		if sensitiveName(name) {
+			query.Set(name, redacted)
+			changed = true
+		}
+	}
+	if changed {
+		parsed.RawQuery = query.Encode()
+	}
+
+	return parsed.Redacted()
+}
+
+// sensitiveName reports whether a header or query parameter name suggests a credential.
+func sensitiveName(name string) bool {
+	name = strings.ToLower(name)
+	for _, marker := range []string{"auth", "token", "secret", "password", "key", "signature", "cookie", "session"} {
+		if strings.Contains(name, marker) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// redactedError keeps the wrapped error for errors.Is while hiding secrets in its message.
+type redactedError struct {
+	message string
+	err     error
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.err
+}
@@ -0,0 +1,250 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+func TestSourceAuthBearerAndHeaders(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assertHeader(t, r, "X-Kes-RequestID")
+		if r.Header.Get("Authorization") != "Bearer allowlist-token" || r.Header.Get("X-Tenant") != "acme" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"ranges":["203.0.113.0/24"]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "json",
+		URL:  server.URL,
+		JSON: &traefikdynamicpublicwhitelist.JSONSourceConfig{IPv4: "ranges"},
+		Auth: &traefikdynamicpublicwhitelist.HTTPAuthConfig{
+			BearerToken: "allowlist-token",
+			Headers:     map[string]string{"X-Tenant": "acme"},
+		},
+	}}
+
+	configuration, err := newProvider(t, cfg).GenerateConfiguration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ","); got != "203.0.113.0/24" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+}
+
+func TestSourceAuthHMAC(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		timestamp := r.Header.Get("X-Request-Time")
+		unix, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || time.Since(time.Unix(unix, 0)) > time.Minute {
+			t.Errorf("unexpected timestamp %q", timestamp)
+		}
+
+		bodyHash := sha256.Sum256(nil)
+		if got := r.Header.Get("X-Content-SHA256"); got != hex.EncodeToString(bodyHash[:]) {
+			t.Errorf("unexpected body hash %q", got)
+		}
+		if got := r.Header.Get("X-Key-ID"); got != "traefik" {
+			t.Errorf("unexpected key id %q", got)
+		}
+
+		mac := hmac.New(sha256.New, []byte("shared-secret"))
+		_, _ = mac.Write([]byte(timestamp + "\n" + r.Method + "\n" + r.URL.RequestURI() + "\n" + hex.EncodeToString(bodyHash[:])))
+		if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(r.Header.Get("X-Signature"))) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("198.51.100.0/24\n"))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "text",
+		URL:  server.URL + "/allowlist?scope=office",
+		Auth: &traefikdynamicpublicwhitelist.HTTPAuthConfig{
+			HMAC: &traefikdynamicpublicwhitelist.HMACAuthConfig{
+				Secret:          "shared-secret",
+				KeyID:           "traefik",
+				TimestampHeader: "X-Request-Time",
+			},
+		},
+	}}
+
+	configuration, err := newProvider(t, cfg).GenerateConfiguration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ","); got != "198.51.100.0/24" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+
+	cfg.Sources[0].Auth.HMAC.Secret = "rotated-secret"
+	if _, err := newProvider(t, cfg).GenerateConfiguration(context.Background()); err == nil || !strings.Contains(err.Error(), "unexpected status code 401") {
+		t.Fatalf("expected authentication error, got %v", err)
+	}
+}
+
+func TestSourceAuthRedirects(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("authenticated request followed to another host with headers %v", r.Header)
+		_, _ = w.Write([]byte("192.0.2.66\n"))
+	}))
+	t.Cleanup(other.Close)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/moved":
+			http.Redirect(w, r, "/allowlist", http.StatusFound)
+		case "/elsewhere":
+			http.Redirect(w, r, other.URL+"/allowlist", http.StatusFound)
+		case "/allowlist":
+			mac := hmac.New(sha256.New, []byte("shared-secret"))
+			_, _ = mac.Write([]byte(r.Header.Get("X-Timestamp") + "\n" + r.Method + "\n" + r.URL.RequestURI() + "\n" + r.Header.Get("X-Content-SHA256")))
+			if !hmac.Equal([]byte(hex.EncodeToString(mac.Sum(nil))), []byte(r.Header.Get("X-Signature"))) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			_, _ = w.Write([]byte("198.51.100.0/24\n"))
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "text",
+		URL:  server.URL + "/moved",
+		Auth: &traefikdynamicpublicwhitelist.HTTPAuthConfig{
+			Headers: map[string]string{"X-Api-Token": "header-secret"},
+			HMAC:    &traefikdynamicpublicwhitelist.HMACAuthConfig{Secret: "shared-secret"},
+		},
+	}}
+
+	// a redirect on the same host is followed and signed for the new path
+	configuration, err := newProvider(t, cfg).GenerateConfiguration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ","); got != "198.51.100.0/24" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+
+	cfg.Sources[0].URL = server.URL + "/elsewhere"
+	if _, err := newProvider(t, cfg).GenerateConfiguration(context.Background()); err == nil || !strings.Contains(err.Error(), "another host") {
+		t.Fatalf("expected the cross-host redirect to be refused, got %v", err)
+	}
+}
+
+func TestResolverAuthBasic(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if username, password, ok := r.BasicAuth(); !ok || username != "resolver" || password != "s3cret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte("203.0.113.77"))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := baseConfig("custom")
+	cfg.IPv4Resolver = server.URL
+	cfg.ResolverAuth = &traefikdynamicpublicwhitelist.HTTPAuthConfig{Username: "resolver", Password: "s3cret"}
+
+	configuration, err := newProvider(t, cfg).GenerateConfiguration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ","); got != "203.0.113.77" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+}
+
+func TestSourceAuthRedactsSecrets(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	t.Cleanup(server.Close)
+
+	// a closed port makes the client fail with the URL in its error
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := listener.Addr().String()
+	_ = listener.Close()
+
+	for name, endpoint := range map[string]string{
+		"status":    "http://reader:url-password@" + strings.TrimPrefix(server.URL, "http://") + "/list?api_key=query-secret&scope=office",
+		"transport": "http://reader:url-password@" + closed + "/list?access_token=query-secret",
+	} {
+		cfg := baseConfig("")
+		cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+			Type: "text",
+			URL:  endpoint,
+			Auth: &traefikdynamicpublicwhitelist.HTTPAuthConfig{Headers: map[string]string{"X-Api-Token": "header-secret"}},
+		}}
+
+		_, err := newProvider(t, cfg).GenerateConfiguration(context.Background())
+		if err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+		for _, secret := range []string{"url-password", "query-secret", "header-secret"} {
+			if strings.Contains(err.Error(), secret) {
+				t.Fatalf("%s: error leaks %q: %v", name, secret, err)
+			}
+		}
+	}
+}
+
+func TestAuthValidation(t *testing.T) {
+	for name, source := range map[string]traefikdynamicpublicwhitelist.SourceConfig{
+		"unsupported type":   {Type: "docker", Docker: &traefikdynamicpublicwhitelist.DockerSourceConfig{Networks: []string{"edge"}}, Auth: &traefikdynamicpublicwhitelist.HTTPAuthConfig{BearerToken: "token"}},
+		"default endpoint":   {Type: "asn", ASN: &traefikdynamicpublicwhitelist.ASNSourceConfig{ASNs: []string{"AS13335"}}, Auth: &traefikdynamicpublicwhitelist.HTTPAuthConfig{BearerToken: "token"}},
+		"bearer and basic":   {Type: "text", URL: "https://example.com", Auth: &traefikdynamicpublicwhitelist.HTTPAuthConfig{BearerToken: "token", Username: "user"}},
+		"password only":      {Type: "text", URL: "https://example.com", Auth: &traefikdynamicpublicwhitelist.HTTPAuthConfig{Password: "secret"}},
+		"invalid header":     {Type: "text", URL: "https://example.com", Auth: &traefikdynamicpublicwhitelist.HTTPAuthConfig{Headers: map[string]string{"X-Bad\r\nHeader": "value"}}},
+		"missing hmac":       {Type: "text", URL: "https://example.com", Auth: &traefikdynamicpublicwhitelist.HTTPAuthConfig{HMAC: &traefikdynamicpublicwhitelist.HMACAuthConfig{}}},
+		"unknown hmac":       {Type: "text", URL: "https://example.com", Auth: &traefikdynamicpublicwhitelist.HTTPAuthConfig{HMAC: &traefikdynamicpublicwhitelist.HMACAuthConfig{Secret: "s", Algorithm: "md5"}}},
+		"conflicting header": {Type: "text", URL: "https://example.com", Auth: &traefikdynamicpublicwhitelist.HTTPAuthConfig{BearerToken: "token", Headers: map[string]string{"authorization": "Token x"}}},
+	} {
+		cfg := baseConfig("")
+		cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{source}
+		if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+
+	// sources with their own credentials must not silently drop auth
+	for sourceType, hint := range map[string]string{"netbox": "netbox.token", "tailscale": "tailscale.apiKey", "consul": "consul.token"} {
+		cfg := baseConfig("")
+		cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+			Type: sourceType,
+			URL:  "https://" + sourceType + ".example.com",
+			Auth: &traefikdynamicpublicwhitelist.HTTPAuthConfig{BearerToken: "token"},
+		}}
+		_, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test")
+		if err == nil || !strings.Contains(err.Error(), hint) {
+			t.Fatalf("%s: expected auth to be rejected with a hint to %s, got %v", sourceType, hint, err)
+		}
+	}
+
+	cfg := baseConfig("cloudflare")
+	cfg.ResolverAuth = &traefikdynamicpublicwhitelist.HTTPAuthConfig{BearerToken: "token"}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected resolverAuth to require the custom provider")
+	}
+}
@@ -0,0 +1,291 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	kubeServiceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	kubeTimeout           = 10 * time.Second
+	// kubeListLimit pages large lists so a big cluster is not returned in one response.
+	kubeListLimit = 500
+)
+
+// kubeClient is a minimal Kubernetes API client listing core/v1 objects, authenticated
+// with a bearer token, basic auth or a client certificate.
+type kubeClient struct {
+	server    string
+	client    *http.Client
+	token     string
+	tokenFile string
+	username  string
+	password  string
+}
+
+// newInClusterKubeClient authenticates with the pod's service account.
+func newInClusterKubeClient() (*kubeClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("not running in a cluster, set kubernetes.kubeconfig")
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if err := appendKubeCA(tlsConfig, filepath.Join(kubeServiceAccountDir, "ca.crt"), ""); err != nil {
+		return nil, err
+	}
+
+	return &kubeClient{
+		server:    "https://" + net.JoinHostPort(host, port),
+		client:    newKubeHTTPClient(tlsConfig),
+		tokenFile: filepath.Join(kubeServiceAccountDir, "token"),
+	}, nil
+}
+
+// newKubeconfigClient reads the cluster and user of contextName (the current context when empty).
+// Relative file references are resolved against the kubeconfig directory.
+func newKubeconfigClient(path, contextName string) (*kubeClient, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := parseYAML(data)
+	if err != nil {
+		return nil, fmt.Errorf("kubeconfig: %w", err)
+	}
+	kubeconfig, _ := document.(map[string]interface{})
+
+	if contextName == "" {
+		contextName = yamlString(kubeconfig, "current-context")
+	}
+	if contextName == "" {
+		return nil, fmt.Errorf("kubeconfig: no context selected")
+	}
+
+	kubeContext, err := kubeconfigEntry(kubeconfig, "contexts", "context", contextName)
+	if err != nil {
+		return nil, err
+	}
+	cluster, err := kubeconfigEntry(kubeconfig, "clusters", "cluster", yamlString(kubeContext, "cluster"))
+	if err != nil {
+		return nil, err
+	}
+
+	user := map[string]interface{}{}
+	if name := yamlString(kubeContext, "user"); name != "" {
+		if user, err = kubeconfigEntry(kubeconfig, "users", "user", name); err != nil {
+			return nil, err
+		}
+	}
+
+	dir := filepath.Dir(path)
+	resolve := func(file string) string {
+		if file == "" || filepath.IsAbs(file) {
+			return file
+		}
+		return filepath.Join(dir, file)
+	}
+
+	server := strings.TrimSuffix(yamlString(cluster, "server"), "/")
+	if server == "" {
+		return nil, fmt.Errorf("kubeconfig: cluster %q has no server", yamlString(kubeContext, "cluster"))
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: yamlString(cluster, "tls-server-name")}
+	if insecure, _ := cluster["insecure-skip-tls-verify"].(bool); insecure {
+		tlsConfig.InsecureSkipVerify = true //nolint:gosec // explicitly requested by the kubeconfig
+	} else if err := appendKubeCA(tlsConfig, resolve(yamlString(cluster, "certificate-authority")), yamlString(cluster, "certificate-authority-data")); err != nil {
+		return nil, err
+	}
+
+	certificate, err := kubeconfigPEM(resolve(yamlString(user, "client-certificate")), yamlString(user, "client-certificate-data"))
+	if err != nil {
+		return nil, err
+	}
+	key, err := kubeconfigPEM(resolve(yamlString(user, "client-key")), yamlString(user, "client-key-data"))
+	if err != nil {
+		return nil, err
+	}
+	if certificate != nil || key != nil {
+		pair, err := tls.X509KeyPair(certificate, key)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig: client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{pair}
+	}
+
+	client := &kubeClient{
+		server:    server,
+		client:    newKubeHTTPClient(tlsConfig),
+		token:     yamlString(user, "token"),
+		tokenFile: resolve(yamlString(user, "tokenFile")),
+		username:  yamlString(user, "username"),
+		password:  yamlString(user, "password"),
+	}
+
+	if _, ok := user["exec"]; ok && client.token == "" && client.tokenFile == "" && certificate == nil {
+		return nil, fmt.Errorf("kubeconfig: exec credential plugins are not supported, use a token or client certificate")
+	}
+
+	return client, nil
+}
+
+// kubeconfigEntry returns the field inner of the named item of the list key.
+func kubeconfigEntry(kubeconfig map[string]interface{}, key, inner, name string) (map[string]interface{}, error) {
+	items, _ := kubeconfig[key].([]interface{})
+	for _, item := range items {
+		entry, _ := item.(map[string]interface{})
+		if yamlString(entry, "name") != name {
+			continue
+		}
+		value, _ := entry[inner].(map[string]interface{})
+		if value == nil {
+			value = map[string]interface{}{}
+		}
+		return value, nil
+	}
+
+	return nil, fmt.Errorf("kubeconfig: %s %q not found", inner, name)
+}
+
+func yamlString(fields map[string]interface{}, key string) string {
+	switch value := fields[key].(type) {
+	case string:
+		return strings.TrimSpace(value)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// kubeconfigPEM returns the inline base64 data or the content of file.
+func kubeconfigPEM(file, data string) ([]byte, error) {
+	if data != "" {
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("kubeconfig: invalid base64 data: %w", err)
+		}
+		return decoded, nil
+	}
+	if file == "" {
+		return nil, nil
+	}
+
+	return os.ReadFile(file)
+}
+
+func appendKubeCA(tlsConfig *tls.Config, file, data string) error {
+	ca, err := kubeconfigPEM(file, data)
+	if err != nil {
+		return err
+	}
+	if ca == nil {
+		// fall back to the system roots
+		return nil
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return fmt.Errorf("kubernetes: no certificate found in the certificate authority")
+	}
+	tlsConfig.RootCAs = pool
+
+	return nil
+}
+
+func newKubeHTTPClient(tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout: kubeTimeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+		},
+	}
+}
+
+type kubeList struct {
+	Metadata struct {
+		Continue string `json:"continue"`
+	} `json:"metadata"`
+	Items []json.RawMessage `json:"items"`
+}
+
+// list pages through the collection at path (e.g. /api/v1/nodes) and calls visit for every item.
+func (c *kubeClient) list(ctx context.Context, path, labelSelector string, visit func(item json.RawMessage) error) error {
+	query := url.Values{}
+	query.Set("limit", fmt.Sprint(kubeListLimit))
+	if labelSelector != "" {
+		query.Set("labelSelector", labelSelector)
+	}
+
+	for {
+		var page kubeList
+		if err := c.get(ctx, path+"?"+query.Encode(), &page); err != nil {
+			return err
+		}
+
+		for _, item := range page.Items {
+			if err := visit(item); err != nil {
+				return err
+			}
+		}
+
+		if page.Metadata.Continue == "" {
+			return nil
+		}
+		query.Set("continue", page.Metadata.Continue)
+	}
+}
+
+func (c *kubeClient) get(ctx context.Context, path string, target interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.server+path, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	token := c.token
+	if c.tokenFile != "" {
+		// projected service account tokens rotate, read the current one on every request
+		data, err := os.ReadFile(c.tokenFile)
+		if err != nil {
+			return err
+		}
+		token = strings.TrimSpace(string(data))
+	}
+	switch {
+	case token != "":
+		req.Header.Set("Authorization", "Bearer "+token)
+	case c.username != "":
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var status struct {
+			Message string `json:"message"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&status)
+		return fmt.Errorf("kubernetes: GET %s: status %d %s", strings.SplitN(path, "?", 2)[0], resp.StatusCode, status.Message)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(target)
+}
@@ -0,0 +1,362 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+)
+
+const (
+	mmdbTypeExtended = 0
+	mmdbTypePointer  = 1
+	mmdbTypeString   = 2
+	mmdbTypeDouble   = 3
+	mmdbTypeBytes    = 4
+	mmdbTypeUint16   = 5
+	mmdbTypeUint32   = 6
+	mmdbTypeMap      = 7
+	mmdbTypeInt32    = 8
+	mmdbTypeUint64   = 9
+	mmdbTypeUint128  = 10
+	mmdbTypeArray    = 11
+	mmdbTypeBool     = 14
+	mmdbTypeFloat    = 15
+
+	// mmdbDataSeparator is the 16 zero bytes between the search tree and the data section.
+	mmdbDataSeparator = 16
+	// mmdbMaxDepth guards the decoder against pointer or nesting loops in corrupt files.
+	mmdbMaxDepth = 32
+)
+
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// mmdbReader reads MaxMind DB files (GeoIP2, GeoLite2, DB-IP) without cgo or unsafe,
+// so it also runs under yaegi. Only what is needed to walk the tree and decode records is supported.
+type mmdbReader struct {
+	tree       []byte
+	data       *mmdbDecoder
+	nodeCount  uint64
+	recordSize uint64
+	ipVersion  uint64
+}
+
+// mmdbNetwork is a search tree leaf holding a data record.
+type mmdbNetwork struct {
+	network    *net.IPNet
+	dataOffset int
+}
+
+func openMMDB(file []byte) (*mmdbReader, error) {
+	marker := bytes.LastIndex(file, mmdbMetadataMarker)
+	if marker < 0 {
+		return nil, fmt.Errorf("mmdb: metadata not found, not a MaxMind DB file")
+	}
+
+	metadataValue, _, err := (&mmdbDecoder{buf: file[marker+len(mmdbMetadataMarker):]}).decode(0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("mmdb: metadata: %w", err)
+	}
+	metadata, ok := metadataValue.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("mmdb: metadata is not a map")
+	}
+
+	reader := &mmdbReader{}
+	for key, target := range map[string]*uint64{
+		"node_count":  &reader.nodeCount,
+		"record_size": &reader.recordSize,
+		"ip_version":  &reader.ipVersion,
+	} {
+		value, ok := metadata[key].(uint64)
+		if !ok {
+			return nil, fmt.Errorf("mmdb: metadata %s missing", key)
+		}
+		*target = value
+	}
+
+	if major, _ := metadata["binary_format_major_version"].(uint64); major != 2 {
+		return nil, fmt.Errorf("mmdb: unsupported format version %d", major)
+	}
+	if reader.recordSize != 24 && reader.recordSize != 28 && reader.recordSize != 32 {
+		return nil, fmt.Errorf("mmdb: unsupported record size %d", reader.recordSize)
+	}
+	if reader.ipVersion != 4 && reader.ipVersion != 6 {
+		return nil, fmt.Errorf("mmdb: unsupported ip version %d", reader.ipVersion)
+	}
+
+	treeSize := reader.nodeCount * reader.recordSize / 4
+	if treeSize+mmdbDataSeparator > uint64(marker) {
+		return nil, fmt.Errorf("mmdb: search tree exceeds the file")
+	}
+
+	reader.tree = file[:treeSize]
+	reader.data = &mmdbDecoder{buf: file[treeSize+mmdbDataSeparator : marker]}
+
+	return reader, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node.
+func (r *mmdbReader) record(node uint64, bit int) uint64 {
+	switch r.recordSize {
+	case 24:
+		b := r.tree[node*6+uint64(bit)*3:]
+		return uint64(b[0])<<16 | uint64(b[1])<<8 | uint64(b[2])
+	case 28:
+		b := r.tree[node*7:]
+		if bit == 0 {
+			return uint64(b[3]>>4)<<24 | uint64(b[0])<<16 | uint64(b[1])<<8 | uint64(b[2])
+		}
+		return uint64(b[3]&0x0f)<<24 | uint64(b[4])<<16 | uint64(b[5])<<8 | uint64(b[6])
+	default:
+		return uint64(binary.BigEndian.Uint32(r.tree[node*8+uint64(bit)*4:]))
+	}
+}
+
+// networks walks the search tree and calls visit for every network with data.
+// In IPv6 databases the IPv4 space lives at ::/96; the IPv4-mapped and 6to4 aliases
+// pointing to the same subtree are skipped and IPv4 networks are reported as IPv4.
+// Without ipv6 only that IPv4 subtree is walked.
+func (r *mmdbReader) networks(ipv6 bool, visit func(mmdbNetwork) error) error {
+	bits := 32
+	if r.ipVersion == 6 {
+		bits = 128
+	}
+
+	type frame struct {
+		value uint64
+		depth int
+		ip    net.IP
+	}
+
+	root := frame{value: 0, ip: make(net.IP, bits/8)}
+	ipv4Start := uint64(math.MaxUint64)
+	if r.ipVersion == 6 {
+		node, depth := uint64(0), 0
+		for ; depth < 96 && node < r.nodeCount; depth++ {
+			node = r.record(node, 0)
+		}
+		ipv4Start = node
+		if !ipv6 {
+			// only walk the ::/96 subtree holding the IPv4 networks
+			root = frame{value: node, depth: depth, ip: root.ip}
+		}
+	}
+
+	stack := []frame{root}
+	for len(stack) > 0 {
+		current := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		switch {
+		case current.value == r.nodeCount:
+			// no data
+			continue
+		case current.value > r.nodeCount:
+			offset := current.value - r.nodeCount - mmdbDataSeparator
+			if offset >= uint64(len(r.data.buf)) {
+				return fmt.Errorf("mmdb: invalid data pointer %d", current.value)
+			}
+			if err := visit(mmdbNetwork{network: r.leafNetwork(current.ip, current.depth), dataOffset: int(offset)}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if current.value == ipv4Start && (current.depth != 96 || !current.ip[:12].Equal(make(net.IP, 12))) {
+			continue
+		}
+		if current.depth >= bits {
+			return fmt.Errorf("mmdb: search tree deeper than %d bits", bits)
+		}
+
+		// push the right branch first so networks come out in address order
+		for bit := 1; bit >= 0; bit-- {
+			ip := append(net.IP(nil), current.ip...)
+			if bit == 1 {
+				ip[current.depth/8] |= 0x80 >> uint(current.depth%8)
+			}
+			stack = append(stack, frame{value: r.record(current.value, bit), depth: current.depth + 1, ip: ip})
+		}
+	}
+
+	return nil
+}
+
+func (r *mmdbReader) leafNetwork(ip net.IP, depth int) *net.IPNet {
+	if r.ipVersion == 6 && depth >= 96 && ip[:12].Equal(make(net.IP, 12)) {
+		return &net.IPNet{IP: net.IP(ip[12:]), Mask: net.CIDRMask(depth-96, 32)}
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(depth, len(ip)*8)}
+}
+
+// mmdbDecoder decodes the MaxMind DB data section format; pointers are relative to buf.
+type mmdbDecoder struct {
+	buf []byte
+}
+
+func (d *mmdbDecoder) decode(offset, depth int) (interface{}, int, error) {
+	if depth > mmdbMaxDepth {
+		return nil, 0, fmt.Errorf("data nested too deeply")
+	}
+	if offset >= len(d.buf) {
+		return nil, 0, fmt.Errorf("unexpected end of data")
+	}
+
+	control := d.buf[offset]
+	offset++
+	kind := int(control >> 5)
+
+	if kind == mmdbTypePointer {
+		pointer, next, err := d.pointer(control, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		value, _, err := d.decode(pointer, depth+1)
+		return value, next, err
+	}
+
+	if kind == mmdbTypeExtended {
+		if offset >= len(d.buf) {
+			return nil, 0, fmt.Errorf("unexpected end of data")
+		}
+		kind = 7 + int(d.buf[offset])
+		offset++
+	}
+
+	size, offset, err := d.size(control, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch kind {
+	case mmdbTypeMap:
+		result := make(map[string]interface{}, size)
+		for i := 0; i < size; i++ {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key is not a string")
+			}
+			value, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			result[name] = value
+			offset = next
+		}
+		return result, offset, nil
+	case mmdbTypeArray:
+		result := make([]interface{}, 0, size)
+		for i := 0; i < size; i++ {
+			value, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			result = append(result, value)
+			offset = next
+		}
+		return result, offset, nil
+	case mmdbTypeBool:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > len(d.buf) {
+		return nil, 0, fmt.Errorf("unexpected end of data")
+	}
+	payload := d.buf[offset : offset+size]
+	offset += size
+
+	switch kind {
+	case mmdbTypeString:
+		return string(payload), offset, nil
+	case mmdbTypeBytes, mmdbTypeUint128:
+		return append([]byte(nil), payload...), offset, nil
+	case mmdbTypeDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(payload)), offset, nil
+	case mmdbTypeFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(payload))), offset, nil
+	case mmdbTypeUint16, mmdbTypeUint32, mmdbTypeUint64:
+		if size > 8 {
+			return nil, 0, fmt.Errorf("invalid unsigned integer size %d", size)
+		}
+		var value uint64
+		for _, b := range payload {
+			value = value<<8 | uint64(b)
+		}
+		return value, offset, nil
+	case mmdbTypeInt32:
+		if size > 4 {
+			return nil, 0, fmt.Errorf("invalid int32 size %d", size)
+		}
+		var value uint32
+		for _, b := range payload {
+			value = value<<8 | uint32(b)
+		}
+		return int64(int32(value)), offset, nil
+	default:
+		return nil, 0, fmt.Errorf("unsupported data type %d", kind)
+	}
+}
+
+func (d *mmdbDecoder) size(control byte, offset int) (int, int, error) {
+	size := int(control & 0x1f)
+	if size < 29 {
+		return size, offset, nil
+	}
+
+	extra := size - 28
+	if offset+extra > len(d.buf) {
+		return 0, 0, fmt.Errorf("unexpected end of data")
+	}
+
+	value := 0
+	for _, b := range d.buf[offset : offset+extra] {
+		value = value<<8 | int(b)
+	}
+
+	switch size {
+	case 29:
+		return 29 + value, offset + extra, nil
+	case 30:
+		return 285 + value, offset + extra, nil
+	default:
+		return 65821 + value, offset + extra, nil
+	}
+}
+
+func (d *mmdbDecoder) pointer(control byte, offset int) (int, int, error) {
+	sizeBits := int(control>>3) & 0x03
+	extra := sizeBits + 1
+	if offset+extra > len(d.buf) {
+		return 0, 0, fmt.Errorf("unexpected end of data")
+	}
+
+	value := 0
+	if sizeBits < 3 {
+		value = int(control & 0x07)
+	}
+	for _, b := range d.buf[offset : offset+extra] {
+		value = value<<8 | int(b)
+	}
+
+	switch sizeBits {
+	case 1:
+		value += 2048
+	case 2:
+		value += 526336
+	}
+
+	return value, offset + extra, nil
+}
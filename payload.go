@@ -0,0 +1,134 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+const (
+	outputSchemaV2   = "v2"
+	outputSchemaV3   = "v3"
+	outputSchemaBoth = "both"
+)
+
+// Exported output schema identifiers for users/tests.
+const (
+	OutputSchemaV2   = outputSchemaV2
+	OutputSchemaV3   = outputSchemaV3
+	OutputSchemaBoth = outputSchemaBoth
+)
+
+// IPAllowList is the Traefik v3 replacement of dynamic.IPWhiteList.
+// genconf v0.2.0 does not model it, so it is merged into the payload at marshal time.
+type IPAllowList struct {
+	SourceRange      []string      `json:"sourceRange,omitempty"`
+	IPStrategy       *IPStrategyV3 `json:"ipStrategy,omitempty"`
+	RejectStatusCode int           `json:"rejectStatusCode,omitempty"`
+}
+
+// IPStrategyV3 is dynamic.IPStrategy extended with the Traefik v3 ipv6Subnet option.
+type IPStrategyV3 struct {
+	Depth       int      `json:"depth,omitempty"`
+	ExcludedIPs []string `json:"excludedIPs,omitempty"`
+	IPv6Subnet  int      `json:"ipv6Subnet,omitempty"`
+}
+
+// payload is the json.Marshaler pushed to Traefik.
+// It carries middleware fields genconf cannot express next to the generated configuration.
+type payload struct {
+	*dynamic.Configuration
+
+	// middlewareFields holds extra keys merged into http.middlewares.<name>.
+	middlewareFields map[string]map[string]interface{}
+	// raw, when set, is emitted verbatim (rendered configurationTemplate).
+	raw json.RawMessage
+}
+
+func newPayload(configuration *dynamic.Configuration) *payload {
+	return &payload{
+		Configuration:    configuration,
+		middlewareFields: make(map[string]map[string]interface{}),
+	}
+}
+
+func (p *payload) setMiddlewareField(name, key string, value interface{}) {
+	fields, ok := p.middlewareFields[name]
+	if !ok {
+		fields = make(map[string]interface{})
+		p.middlewareFields[name] = fields
+	}
+	fields[key] = value
+}
+
+// MarshalJSON renders the configuration, merging any extra middleware fields.
+func (p *payload) MarshalJSON() ([]byte, error) {
+	if p.raw != nil {
+		return p.raw, nil
+	}
+
+	if p.Configuration == nil {
+		return nil, nil
+	}
+
+	if len(p.middlewareFields) == 0 {
+		return json.Marshal(p.Configuration)
+	}
+
+	raw, err := json.Marshal(p.Configuration)
+	if err != nil {
+		return nil, err
+	}
+
+	var document map[string]interface{}
+	if err := json.Unmarshal(raw, &document); err != nil {
+		return nil, err
+	}
+
+	httpSection, _ := document["http"].(map[string]interface{})
+	if httpSection == nil {
+		httpSection = make(map[string]interface{})
+		document["http"] = httpSection
+	}
+
+	middlewares, _ := httpSection["middlewares"].(map[string]interface{})
+	if middlewares == nil {
+		middlewares = make(map[string]interface{})
+		httpSection["middlewares"] = middlewares
+	}
+
+	for name, fields := range p.middlewareFields {
+		middleware, _ := middlewares[name].(map[string]interface{})
+		if middleware == nil {
+			middleware = make(map[string]interface{})
+			middlewares[name] = middleware
+		}
+		for key, value := range fields {
+			middleware[key] = value
+		}
+	}
+
+	return json.Marshal(document)
+}
+
+func parseOutputSchema(raw string) (string, error) {
+	schema := strings.ToLower(strings.TrimSpace(raw))
+	switch schema {
+	case "":
+		return outputSchemaV2, nil
+	case outputSchemaV2, outputSchemaV3, outputSchemaBoth:
+		return schema, nil
+	default:
+		return "", fmt.Errorf("unsupported outputSchema %q", raw)
+	}
+}
+
+func schemaEmitsV2(schema string) bool {
+	return schema == outputSchemaV2 || schema == outputSchemaBoth
+}
+
+func schemaEmitsV3(schema string) bool {
+	return schema == outputSchemaV3 || schema == outputSchemaBoth
+}
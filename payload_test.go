@@ -0,0 +1,163 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+func TestOutputSchemaV3(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("198.51.100.7"))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := baseConfig(traefikdynamicpublicwhitelist.ProviderCustom)
+	cfg.IPv4Resolver = srv.URL
+	cfg.OutputSchema = traefikdynamicpublicwhitelist.OutputSchemaV3
+	cfg.RejectStatusCode = 404
+	cfg.IPv6Subnet = 64
+
+	middlewares := emittedMiddlewares(t, cfg)
+
+	if _, ok := middlewares["public_ipwhitelist"]; ok {
+		t.Fatal("v3 output must not contain the ipWhiteList middleware")
+	}
+
+	allowList := middlewareSection(t, middlewares, "public_ipallowlist", "ipAllowList")
+	if allowList["rejectStatusCode"] != float64(404) {
+		t.Fatalf("unexpected rejectStatusCode: %v", allowList["rejectStatusCode"])
+	}
+
+	strategy, _ := allowList["ipStrategy"].(map[string]interface{})
+	if strategy["ipv6Subnet"] != float64(64) {
+		t.Fatalf("unexpected ipStrategy: %v", allowList["ipStrategy"])
+	}
+
+	ranges, _ := allowList["sourceRange"].([]interface{})
+	if len(ranges) != 1 || ranges[0] != "198.51.100.7" {
+		t.Fatalf("unexpected source ranges: %v", allowList["sourceRange"])
+	}
+}
+
+func TestOutputSchemaBoth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("198.51.100.7"))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := baseConfig(traefikdynamicpublicwhitelist.ProviderCustom)
+	cfg.IPv4Resolver = srv.URL
+	cfg.OutputSchema = traefikdynamicpublicwhitelist.OutputSchemaBoth
+
+	middlewares := emittedMiddlewares(t, cfg)
+
+	middlewareSection(t, middlewares, "public_ipwhitelist", "ipWhiteList")
+	middlewareSection(t, middlewares, "public_ipallowlist", "ipAllowList")
+}
+
+func TestGenerateDocumentMatchesEmittedPayload(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("198.51.100.7"))
+	}))
+	t.Cleanup(srv.Close)
+
+	for _, schema := range []string{traefikdynamicpublicwhitelist.OutputSchemaV2, traefikdynamicpublicwhitelist.OutputSchemaV3, traefikdynamicpublicwhitelist.OutputSchemaBoth} {
+		cfg := baseConfig(traefikdynamicpublicwhitelist.ProviderCustom)
+		cfg.IPv4Resolver = srv.URL
+		cfg.OutputSchema = schema
+
+		raw, err := newProvider(t, cfg).GenerateDocument(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var generated map[string]interface{}
+		if err := json.Unmarshal(raw, &generated); err != nil {
+			t.Fatal(err)
+		}
+
+		if emitted := emittedDocument(t, cfg); !reflect.DeepEqual(generated, emitted) {
+			t.Fatalf("%s: generated document differs from the emitted one:\n%s\n%v", schema, raw, emitted)
+		}
+		if schema != traefikdynamicpublicwhitelist.OutputSchemaV2 {
+			httpSection, _ := generated["http"].(map[string]interface{})
+			middlewares, _ := httpSection["middlewares"].(map[string]interface{})
+			middlewareSection(t, middlewares, "public_ipallowlist", "ipAllowList")
+		}
+	}
+}
+
+func TestOutputSchemaValidation(t *testing.T) {
+	cfg := baseConfig(traefikdynamicpublicwhitelist.ProviderCloudflare)
+	cfg.OutputSchema = "v4"
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error for unsupported outputSchema")
+	}
+
+	cfg = baseConfig(traefikdynamicpublicwhitelist.ProviderCloudflare)
+	cfg.RejectStatusCode = 404
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error when rejectStatusCode is used with the v2 schema")
+	}
+}
+
+// emittedMiddlewares runs the provider once and decodes http.middlewares from the pushed payload.
+func emittedMiddlewares(t *testing.T, cfg *traefikdynamicpublicwhitelist.Config) map[string]interface{} {
+	t.Helper()
+
+	document := emittedDocument(t, cfg)
+	httpSection, _ := document["http"].(map[string]interface{})
+	middlewares, _ := httpSection["middlewares"].(map[string]interface{})
+	if middlewares == nil {
+		t.Fatalf("no middlewares in payload: %v", document)
+	}
+
+	return middlewares
+}
+
+func emittedDocument(t *testing.T, cfg *traefikdynamicpublicwhitelist.Config) map[string]interface{} {
+	t.Helper()
+
+	provider := newProvider(t, cfg)
+	cfgChan := make(chan json.Marshaler, 1)
+	if err := provider.Provide(cfgChan); err != nil {
+		t.Fatal(err)
+	}
+
+	var data json.Marshaler
+	select {
+	case data = <-cfgChan:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for configuration")
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var document map[string]interface{}
+	if err := json.Unmarshal(raw, &document); err != nil {
+		t.Fatal(err)
+	}
+
+	return document
+}
+
+func middlewareSection(t *testing.T, middlewares map[string]interface{}, name, key string) map[string]interface{} {
+	t.Helper()
+
+	middleware, _ := middlewares[name].(map[string]interface{})
+	section, _ := middleware[key].(map[string]interface{})
+	if section == nil {
+		t.Fatalf("middleware %s has no %s section: %v", name, key, middlewares)
+	}
+
+	return section
+}
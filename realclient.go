@@ -0,0 +1,52 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"fmt"
+)
+
+// parseExcludedIPsProviders validates the providers whose ranges become IPStrategy.ExcludedIPs.
+// Those providers describe the proxies in front of Traefik (typically a CDN), so Traefik skips
+// their hops in X-Forwarded-For and matches the real client against the allowlist.
+func parseExcludedIPsProviders(config *Config, providerNames []string) ([]string, error) {
+	if len(config.ExcludedIPsProviders) == 0 {
+		return nil, nil
+	}
+
+	excluded := make([]string, 0, len(config.ExcludedIPsProviders))
+	seen := make(map[string]struct{}, len(config.ExcludedIPsProviders))
+
+	for _, raw := range config.ExcludedIPsProviders {
+		name := normalizeProviderName(raw)
+		if name == "" {
+			continue
+		}
+		if _, ok := supportedProviders[name]; !ok {
+			return nil, fmt.Errorf("unsupported excludedIPs provider %q", raw)
+		}
+		if _, ok := seen[name]; ok {
+			continue
+		}
+		seen[name] = struct{}{}
+		excluded = append(excluded, name)
+	}
+
+	for _, name := range providerNames {
+		if _, ok := seen[name]; ok {
+			return nil, fmt.Errorf("provider %q cannot be both allowed and excluded", name)
+		}
+	}
+
+	if config.IPStrategy.Depth > 0 {
+		return nil, fmt.Errorf("excludedIPsProviders requires ipStrategy.depth to be 0, depth takes precedence over excludedIPs")
+	}
+
+	if len(providerNames) == 0 && len(config.Sources) == 0 && len(config.AdditionalSourceRange) == 0 {
+		return nil, fmt.Errorf("excludedIPsProviders requires client ranges from a provider, a source or additionalSourceRange")
+	}
+
+	return excluded, nil
+}
+
+func hasProviderConfig(config *Config) bool {
+	return normalizeProviderName(config.Provider) != "" || len(config.Providers) > 0
+}
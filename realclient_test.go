@@ -0,0 +1,75 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+	"github.com/traefik/genconf/dynamic"
+)
+
+func TestExcludedIPsProviders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v6" {
+			_, _ = w.Write([]byte("2400:cb00::/32"))
+			return
+		}
+		_, _ = w.Write([]byte("173.245.48.0/20\n103.21.244.0/22"))
+	}))
+	t.Cleanup(srv.Close)
+
+	traefikdynamicpublicwhitelist.SetCloudflareEndpoints(srv.URL+"/v4", srv.URL+"/v6")
+	t.Cleanup(func() {
+		traefikdynamicpublicwhitelist.SetCloudflareEndpoints(
+			"https://www.cloudflare.com/ips-v4/",
+			"https://www.cloudflare.com/ips-v6/",
+		)
+	})
+
+	cfg := baseConfig("")
+	cfg.ExcludedIPsProviders = []string{traefikdynamicpublicwhitelist.ProviderCloudflare}
+	cfg.AdditionalSourceRange = []string{"203.0.113.0/24"}
+	cfg.IPStrategy = dynamic.IPStrategy{ExcludedIPs: []string{"10.0.0.1"}}
+	cfg.InFlightReq = &traefikdynamicpublicwhitelist.InFlightReqConfig{Amount: 5}
+
+	configuration := loadOnce(t, cfg)
+
+	allowList := configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList
+	if strings.Join(allowList.SourceRange, ",") != "203.0.113.0/24" {
+		t.Fatalf("unexpected source range: %v", allowList.SourceRange)
+	}
+
+	// the CDN's IPv6 edges are excluded even though only IPv4 clients are allowed
+	expected := "10.0.0.1,173.245.48.0/20,103.21.244.0/22,2400:cb00::/32"
+	if got := strings.Join(allowList.IPStrategy.ExcludedIPs, ","); got != expected {
+		t.Fatalf("unexpected excluded IPs: %s", got)
+	}
+
+	criterion := configuration.HTTP.Middlewares["public_inflightreq"].InFlightReq.SourceCriterion
+	if got := strings.Join(criterion.IPStrategy.ExcludedIPs, ","); got != expected {
+		t.Fatalf("in-flight strategy does not match allowlist: %s", got)
+	}
+}
+
+func TestExcludedIPsProvidersValidation(t *testing.T) {
+	cfg := baseConfig(traefikdynamicpublicwhitelist.ProviderCloudflare)
+	cfg.ExcludedIPsProviders = []string{traefikdynamicpublicwhitelist.ProviderCloudflare}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error when a provider is both allowed and excluded")
+	}
+
+	cfg = baseConfig("")
+	cfg.ExcludedIPsProviders = []string{traefikdynamicpublicwhitelist.ProviderCloudflare}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error without client ranges")
+	}
+
+	cfg.AdditionalSourceRange = []string{"203.0.113.0/24"}
+	cfg.IPStrategy = dynamic.IPStrategy{Depth: 1}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error when depth is set")
+	}
+}
@@ -0,0 +1,209 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	redisTimeout = 5 * time.Second
+	// redisMaxBulk, redisMaxArray and redisMaxDepth reject corrupt or hostile length
+	// prefixes; buffers only grow with the data actually received.
+	redisMaxBulk  = 1 << 20
+	redisMaxArray = 1 << 20
+	redisMaxDepth = 8
+	// redisPrealloc bounds the capacity reserved from an announced array length.
+	redisPrealloc = 1024
+)
+
+// redisError is an error reply sent by the server.
+type redisError string
+
+func (e redisError) Error() string {
+	return string(e)
+}
+
+// redisOptions describe how to reach and authenticate to a Redis server.
+type redisOptions struct {
+	address  string
+	tls      bool
+	username string
+	password string
+	database int
+}
+
+// redisConn speaks RESP2 over a single connection, enough for AUTH, SELECT,
+// read commands and SUBSCRIBE without cgo.
+type redisConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// dialRedis connects, authenticates and selects the database.
+func dialRedis(ctx context.Context, options redisOptions) (*redisConn, error) {
+	dialer := &net.Dialer{Timeout: redisTimeout}
+
+	var (
+		conn net.Conn
+		err  error
+	)
+	if options.tls {
+		host, _, _ := net.SplitHostPort(options.address)
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{MinVersion: tls.VersionTLS12, ServerName: host}}).DialContext(ctx, "tcp", options.address)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", options.address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client := &redisConn{conn: conn, reader: bufio.NewReader(conn)}
+
+	if options.password != "" {
+		args := []string{"AUTH", options.password}
+		if options.username != "" {
+			args = []string{"AUTH", options.username, options.password}
+		}
+		if _, err := client.do(args...); err != nil {
+			client.close()
+			return nil, fmt.Errorf("redis: AUTH: %w", err)
+		}
+	}
+	if options.database != 0 {
+		if _, err := client.do("SELECT", strconv.Itoa(options.database)); err != nil {
+			client.close()
+			return nil, fmt.Errorf("redis: SELECT: %w", err)
+		}
+	}
+
+	return client, nil
+}
+
+func (c *redisConn) close() {
+	_ = c.conn.Close()
+}
+
+// do sends a command and reads its reply within redisTimeout.
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	if err := c.conn.SetDeadline(time.Now().Add(redisTimeout)); err != nil {
+		return nil, err
+	}
+	if err := c.send(args...); err != nil {
+		return nil, err
+	}
+
+	reply, err := c.receive()
+	if err != nil {
+		return nil, err
+	}
+	if replyErr, ok := reply.(redisError); ok {
+		return nil, replyErr
+	}
+
+	return reply, nil
+}
+
+func (c *redisConn) send(args ...string) error {
+	var command strings.Builder
+	command.WriteString("*" + strconv.Itoa(len(args)) + "\r\n")
+	for _, arg := range args {
+		command.WriteString("$" + strconv.Itoa(len(arg)) + "\r\n" + arg + "\r\n")
+	}
+
+	_, err := io.WriteString(c.conn, command.String())
+
+	return err
+}
+
+// receive reads one reply: a string for simple and bulk strings, int64, nil,
+// redisError or []interface{} for arrays.
+func (c *redisConn) receive() (interface{}, error) {
+	return c.receiveNested(0)
+}
+
+func (c *redisConn) receiveNested(depth int) (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+
+	payload := line[1:]
+	switch line[0] {
+	case '+':
+		return payload, nil
+	case '-':
+		return redisError(payload), nil
+	case ':':
+		return strconv.ParseInt(payload, 10, 64)
+	case '$':
+		size, err := strconv.Atoi(payload)
+		if err != nil || size > redisMaxBulk {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", payload)
+		}
+		if size < 0 {
+			return nil, nil
+		}
+		var data bytes.Buffer
+		if _, err := io.CopyN(&data, c.reader, int64(size)+2); err != nil {
+			return nil, err
+		}
+		return string(data.Bytes()[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(payload)
+		if err != nil || count > redisMaxArray {
+			return nil, fmt.Errorf("redis: invalid array length %q", payload)
+		}
+		if count < 0 {
+			return nil, nil
+		}
+		if depth >= redisMaxDepth {
+			return nil, fmt.Errorf("redis: arrays nested too deeply")
+		}
+		capacity := count
+		if capacity > redisPrealloc {
+			capacity = redisPrealloc
+		}
+		items := make([]interface{}, 0, capacity)
+		for i := 0; i < count; i++ {
+			item, err := c.receiveNested(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+// redisStrings converts an array reply of bulk strings.
+func redisStrings(reply interface{}) ([]string, error) {
+	items, ok := reply.([]interface{})
+	if !ok && reply != nil {
+		return nil, fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		value, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("redis: unexpected array item %v", item)
+		}
+		values = append(values, value)
+	}
+
+	return values, nil
+}
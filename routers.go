@@ -0,0 +1,114 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+// RouterConfig declares a router generated with the allowlist middleware attached.
+type RouterConfig struct {
+	Name         string   `json:"name,omitempty"`
+	Host         string   `json:"host,omitempty"`
+	PathPrefix   string   `json:"pathPrefix,omitempty"`
+	EntryPoints  []string `json:"entryPoints,omitempty"`
+	Service      string   `json:"service,omitempty"`
+	Priority     int      `json:"priority,omitempty"`
+	TLS          bool     `json:"tls,omitempty"`
+	CertResolver string   `json:"certResolver,omitempty"`
+	TLSOptions   string   `json:"tlsOptions,omitempty"`
+}
+
+func validateRouters(routers []RouterConfig, outputSchema, group string) ([]RouterConfig, error) {
+	if len(routers) == 0 {
+		return nil, nil
+	}
+
+	if outputSchema == outputSchemaBoth {
+		return nil, fmt.Errorf("routers require outputSchema %q or %q", outputSchemaV2, outputSchemaV3)
+	}
+
+	validated := make([]RouterConfig, 0, len(routers))
+	seen := make(map[string]struct{}, len(routers))
+
+	for i, router := range routers {
+		router.Host = strings.TrimSpace(router.Host)
+		router.PathPrefix = strings.TrimSpace(router.PathPrefix)
+		router.Service = strings.TrimSpace(router.Service)
+
+		if router.Host == "" {
+			return nil, fmt.Errorf("routers[%d]: host is required", i)
+		}
+		if router.Service == "" {
+			return nil, fmt.Errorf("routers[%d]: service is required", i)
+		}
+		if router.PathPrefix != "" && !strings.HasPrefix(router.PathPrefix, "/") {
+			return nil, fmt.Errorf("routers[%d]: pathPrefix must start with /", i)
+		}
+		if strings.ContainsAny(router.Host+router.PathPrefix, "`") {
+			return nil, fmt.Errorf("routers[%d]: host and pathPrefix must not contain backquotes", i)
+		}
+
+		router.Name = strings.TrimSpace(router.Name)
+		if router.Name == "" {
+			router.Name = group + "_" + sanitizeRouterName(router.Host+router.PathPrefix)
+		}
+		if _, ok := seen[router.Name]; ok {
+			return nil, fmt.Errorf("routers[%d]: duplicate router name %q", i, router.Name)
+		}
+		seen[router.Name] = struct{}{}
+
+		router.EntryPoints = append([]string(nil), router.EntryPoints...)
+		router.TLS = router.TLS || router.CertResolver != "" || router.TLSOptions != ""
+
+		validated = append(validated, router)
+	}
+
+	return validated, nil
+}
+
+func sanitizeRouterName(raw string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(raw) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			b.WriteRune(r)
+		default:
+			b.WriteByte('_')
+		}
+	}
+
+	return strings.Trim(b.String(), "_")
+}
+
+func routerRule(router RouterConfig) string {
+	rule := fmt.Sprintf("Host(`%s`)", router.Host)
+	if router.PathPrefix != "" {
+		rule += fmt.Sprintf(" && PathPrefix(`%s`)", router.PathPrefix)
+	}
+
+	return rule
+}
+
+// addRouters emits the declared routers with the given middleware attached.
+func (p *Provider) addRouters(configuration *dynamic.Configuration, middlewareName string) {
+	for _, router := range p.routers {
+		generated := &dynamic.Router{
+			EntryPoints: router.EntryPoints,
+			Middlewares: []string{middlewareName},
+			Service:     router.Service,
+			Rule:        routerRule(router),
+			Priority:    router.Priority,
+		}
+
+		if router.TLS {
+			generated.TLS = &dynamic.RouterTLSConfig{
+				CertResolver: router.CertResolver,
+				Options:      router.TLSOptions,
+			}
+		}
+
+		configuration.HTTP.Routers[router.Name] = generated
+	}
+}
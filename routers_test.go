@@ -0,0 +1,92 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+func TestRouterGeneration(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("198.51.100.7"))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := baseConfig(traefikdynamicpublicwhitelist.ProviderCustom)
+	cfg.IPv4Resolver = srv.URL
+	cfg.Routers = []traefikdynamicpublicwhitelist.RouterConfig{
+		{
+			Host:         "admin.example.com",
+			PathPrefix:   "/api",
+			EntryPoints:  []string{"websecure"},
+			Service:      "admin@docker",
+			CertResolver: "le",
+		},
+		{
+			Name:    "dashboard",
+			Host:    "traefik.example.com",
+			Service: "api@internal",
+		},
+	}
+
+	configuration := loadOnce(t, cfg)
+	routers := configuration.HTTP.Routers
+
+	admin := routers["public_admin_example_com_api"]
+	if admin == nil {
+		t.Fatalf("missing generated router: %v", routers)
+	}
+	if admin.Rule != "Host(`admin.example.com`) && PathPrefix(`/api`)" {
+		t.Fatalf("unexpected rule: %s", admin.Rule)
+	}
+	if len(admin.Middlewares) != 1 || admin.Middlewares[0] != "public_ipwhitelist" {
+		t.Fatalf("unexpected middlewares: %v", admin.Middlewares)
+	}
+	if admin.TLS == nil || admin.TLS.CertResolver != "le" || admin.Service != "admin@docker" {
+		t.Fatalf("unexpected router: %+v", admin)
+	}
+
+	dashboard := routers["dashboard"]
+	if dashboard == nil || dashboard.Rule != "Host(`traefik.example.com`)" || dashboard.TLS != nil {
+		t.Fatalf("unexpected dashboard router: %+v", dashboard)
+	}
+}
+
+func TestRouterUsesChain(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("198.51.100.7"))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := baseConfig(traefikdynamicpublicwhitelist.ProviderCustom)
+	cfg.IPv4Resolver = srv.URL
+	cfg.InFlightReq = &traefikdynamicpublicwhitelist.InFlightReqConfig{Amount: 5}
+	cfg.Routers = []traefikdynamicpublicwhitelist.RouterConfig{{Host: "admin.example.com", Service: "admin"}}
+
+	configuration := loadOnce(t, cfg)
+
+	router := configuration.HTTP.Routers["public_admin_example_com"]
+	if router == nil || len(router.Middlewares) != 1 || router.Middlewares[0] != "public_chain" {
+		t.Fatalf("expected router to reference the chain: %+v", router)
+	}
+}
+
+func TestRouterValidation(t *testing.T) {
+	cfg := baseConfig(traefikdynamicpublicwhitelist.ProviderCustom)
+	cfg.Routers = []traefikdynamicpublicwhitelist.RouterConfig{{Host: "admin.example.com"}}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error when service is missing")
+	}
+
+	cfg = baseConfig(traefikdynamicpublicwhitelist.ProviderCustom)
+	cfg.Routers = []traefikdynamicpublicwhitelist.RouterConfig{
+		{Host: "admin.example.com", Service: "a"},
+		{Host: "admin.example.com", Service: "b"},
+	}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error for duplicate router names")
+	}
+}
@@ -0,0 +1,296 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const sourceTypeJSON = "json"
+
+// SourceConfig declares a configurable range source.
+// Common settings live at the top level, type-specific settings in the block named after the type.
+type SourceConfig struct {
+	Type string `json:"type,omitempty"`
+	// Name identifies the source in logs and templates, defaults to the type.
+	Name string `json:"name,omitempty"`
+	URL  string `json:"url,omitempty"`
+	// Auth authenticates the requests to url, for the json, text, csv, asn, geofeed and
+	// terraform sources. Other types reject it.
+	Auth *HTTPAuthConfig `json:"auth,omitempty"`
+	// Path, Format and WatchInterval apply to sources reading local files.
+	Path          string `json:"path,omitempty"`
+	Format        string `json:"format,omitempty"`
+	WatchInterval string `json:"watchInterval,omitempty"`
+
+	JSON       *JSONSourceConfig       `json:"json,omitempty"`
+	Text       *TextSourceConfig       `json:"text,omitempty"`
+	Directory  *DirectorySourceConfig  `json:"directory,omitempty"`
+	DNS        *DNSSourceConfig        `json:"dns,omitempty"`
+	SPF        *SPFSourceConfig        `json:"spf,omitempty"`
+	ASN        *ASNSourceConfig        `json:"asn,omitempty"`
+	MRT        *MRTSourceConfig        `json:"mrt,omitempty"`
+	MMDB       *MMDBSourceConfig       `json:"mmdb,omitempty"`
+	Geofeed    *GeofeedSourceConfig    `json:"geofeed,omitempty"`
+	Kubernetes *KubernetesSourceConfig `json:"kubernetes,omitempty"`
+	Docker     *DockerSourceConfig     `json:"docker,omitempty"`
+	Consul     *ConsulSourceConfig     `json:"consul,omitempty"`
+	Redis      *RedisSourceConfig      `json:"redis,omitempty"`
+	S3         *S3SourceConfig         `json:"s3,omitempty"`
+	Tailscale  *TailscaleSourceConfig  `json:"tailscale,omitempty"`
+	NetBox     *NetBoxSourceConfig     `json:"netbox,omitempty"`
+	Terraform  *TerraformSourceConfig  `json:"terraform,omitempty"`
+	EC2        *EC2SourceConfig        `json:"ec2,omitempty"`
+}
+
+// rangeSource resolves the ranges of one configured source.
+type rangeSource interface {
+	fetch(ctx context.Context) ([]labeledRange, error)
+}
+
+// watcher is implemented by sources that detect changes between polls.
+// notify requests an immediate refresh and never blocks.
+type watcher interface {
+	watch(ctx context.Context, notify func())
+}
+
+// dynamicSource is implemented by sources whose entries come and go at runtime, such as
+// expiring Redis members or removed containers, so an empty result is not an error.
+type dynamicSource interface {
+	allowsEmpty() bool
+}
+
+type configuredSource struct {
+	name   string
+	source rangeSource
+}
+
+// sourceEnv carries the provider settings shared by every source.
+type sourceEnv struct {
+	httpClient    *http.Client
+	httpGet       httpGetter
+	httpOpen      httpOpener
+	whitelistIPv6 bool
+}
+
+func newSources(configs []SourceConfig, shared sourceEnv, reserved []string) ([]configuredSource, error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+
+	seen := make(map[string]struct{}, len(configs)+len(reserved))
+	for _, name := range reserved {
+		seen[name] = struct{}{}
+	}
+
+	sources := make([]configuredSource, 0, len(configs))
+	for i, config := range configs {
+		sourceType := strings.ToLower(strings.TrimSpace(config.Type))
+
+		name := strings.TrimSpace(config.Name)
+		if name == "" {
+			name = sourceType
+		}
+		if _, ok := seen[name]; ok {
+			return nil, fmt.Errorf("sources[%d]: duplicate source name %q, set a unique name", i, name)
+		}
+		seen[name] = struct{}{}
+
+		env, err := sourceAuthEnv(shared, sourceType, config)
+		if err != nil {
+			return nil, fmt.Errorf("sources[%d] %s: %w", i, name, err)
+		}
+
+		var source rangeSource
+
+		switch sourceType {
+		case sourceTypeJSON:
+			source, err = newJSONSource(config, env)
+		case sourceTypeText:
+			source, err = newTextSource(config, env, false)
+		case sourceTypeCSV:
+			source, err = newTextSource(config, env, true)
+		case sourceTypeFile:
+			source, err = newFileSource(config, env)
+		case sourceTypeDirectory:
+			source, err = newDirectorySource(name, config, env)
+		case sourceTypeDNS:
+			source, err = newDNSSource(name, config, env)
+		case sourceTypeSPF:
+			source, err = newSPFSource(name, config, env)
+		case sourceTypeASN:
+			source, err = newASNSource(name, config, env)
+		case sourceTypeMRT:
+			source, err = newMRTSource(config, env)
+		case sourceTypeMMDB:
+			source, err = newMMDBSource(config, env)
+		case sourceTypeGeofeed:
+			source, err = newGeofeedSource(name, config, env)
+		case sourceTypeKubernetes:
+			source, err = newKubernetesSource(config)
+		case sourceTypeDocker:
+			source, err = newDockerSource(name, config)
+		case sourceTypeConsul:
+			source, err = newConsulSource(name, config)
+		case sourceTypeRedis:
+			source, err = newRedisSource(name, config)
+		case sourceTypeS3:
+			source, err = newS3Source(name, config, env)
+		case sourceTypeTailscale:
+			source, err = newTailscaleSource(config)
+		case sourceTypeNetBox:
+			source, err = newNetBoxSource(config)
+		case sourceTypeTerraform:
+			source, err = newTerraformSource(config, env)
+		case sourceTypeEC2:
+			source, err = newEC2Source(config)
+		case "":
+			err = fmt.Errorf("type is required")
+		default:
+			err = fmt.Errorf("unsupported source type %q", config.Type)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("sources[%d] %s: %w", i, name, err)
+		}
+
+		sources = append(sources, configuredSource{name: name, source: source})
+	}
+
+	return sources, nil
+}
+
+// sourceAuthEnv returns env with HTTP requests authenticated by the source's auth settings.
+func sourceAuthEnv(env sourceEnv, sourceType string, config SourceConfig) (sourceEnv, error) {
+	if config.Auth == nil {
+		return env, nil
+	}
+
+	// sources with their own credentials reject auth rather than ignoring it
+	switch sourceType {
+	case sourceTypeJSON, sourceTypeText, sourceTypeCSV, sourceTypeASN, sourceTypeGeofeed, sourceTypeTerraform:
+	case sourceTypeNetBox:
+		return env, fmt.Errorf("auth is not supported by %q sources, use netbox.token", sourceType)
+	case sourceTypeTailscale:
+		return env, fmt.Errorf("auth is not supported by %q sources, use tailscale.apiKey", sourceType)
+	case sourceTypeConsul:
+		return env, fmt.Errorf("auth is not supported by %q sources, use consul.token", sourceType)
+	default:
+		return env, fmt.Errorf("auth is not supported by %q sources", sourceType)
+	}
+	// never send the credentials to a default endpoint
+	if strings.TrimSpace(config.URL) == "" {
+		return env, fmt.Errorf("auth requires url")
+	}
+
+	auth, err := newHTTPAuth(config.Auth)
+	if err != nil {
+		return env, fmt.Errorf("auth: %w", err)
+	}
+	env.httpOpen = newHTTPOpener(env.httpClient, auth)
+	env.httpGet = newHTTPGetter(env.httpOpen)
+
+	return env, nil
+}
+
+// startWatchers runs the watch loop of every source supporting change detection.
+func (p *Provider) startWatchers(ctx context.Context) {
+	for _, configured := range p.sources {
+		if w, ok := configured.source.(watcher); ok {
+			goRecover(configured.name, func() { w.watch(ctx, p.requestRefresh) })
+		}
+	}
+}
+
+// goRecover runs fn in a goroutine, logging a panic like Provide does instead of
+// taking down Traefik.
+func goRecover(sourceName string, fn func()) {
+	go func() {
+		defer func() {
+			if err := recover(); err != nil {
+				log.Printf("traefik_dynamic_public_whitelist: source %s: watcher stopped: %v", sourceName, err)
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// requestRefresh schedules an immediate refresh, coalescing pending requests.
+func (p *Provider) requestRefresh() {
+	select {
+	case p.refresh <- struct{}{}:
+	default:
+	}
+}
+
+func (p *Provider) fetchSourceRanges(ctx context.Context, byProvider map[string][]string, labels map[string]string) ([]string, error) {
+	seen := make(map[string]struct{})
+	combined := make([]string, 0)
+
+	for _, configured := range p.sources {
+		ranges, err := configured.source.fetch(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %w", configured.name, err)
+		}
+
+		filtered := filterRanges(configured.name, ranges, p.whitelistIPv6)
+		if len(filtered) == 0 {
+			if dynamic, ok := configured.source.(dynamicSource); !ok || !dynamic.allowsEmpty() {
+				return nil, fmt.Errorf("source %s: empty range list", configured.name)
+			}
+		}
+
+		resolved := make([]string, 0, len(filtered))
+		for _, entry := range filtered {
+			resolved = append(resolved, entry.CIDR)
+			if entry.Label != "" {
+				if _, ok := labels[entry.CIDR]; !ok {
+					labels[entry.CIDR] = entry.Label
+				}
+			}
+			if _, ok := seen[entry.CIDR]; ok {
+				continue
+			}
+			seen[entry.CIDR] = struct{}{}
+			combined = append(combined, entry.CIDR)
+		}
+		byProvider[configured.name] = resolved
+	}
+
+	return combined, nil
+}
+
+// filterRanges keeps valid IPs/CIDRs, dropping IPv6 entries unless whitelistIPv6 is set.
+// Invalid entries are logged and skipped since Traefik rejects the whole middleware otherwise.
+func filterRanges(sourceName string, ranges []labeledRange, whitelistIPv6 bool) []labeledRange {
+	filtered := make([]labeledRange, 0, len(ranges))
+	for _, entry := range ranges {
+		raw := entry.CIDR
+		cidr := strings.TrimSpace(raw)
+		if cidr == "" {
+			continue
+		}
+
+		ip := net.ParseIP(cidr)
+		if ip == nil {
+			var err error
+			ip, _, err = net.ParseCIDR(cidr)
+			if err != nil {
+				log.Printf("traefik_dynamic_public_whitelist: source %s: skipping invalid range %q", sourceName, raw)
+				continue
+			}
+		}
+
+		if ip.To4() == nil && !whitelistIPv6 {
+			continue
+		}
+
+		filtered = append(filtered, labeledRange{CIDR: cidr, Label: entry.Label})
+	}
+
+	return filtered
+}
@@ -0,0 +1,158 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	sourceTypeASN = "asn"
+
+	defaultAnnouncedPrefixesEndpoint = "https://stat.ripe.net/data/announced-prefixes/data.json"
+)
+
+// ASNSourceConfig lists the autonomous systems whose announced prefixes are allowed.
+type ASNSourceConfig struct {
+	// ASNs accepts "AS13335" or "13335".
+	ASNs []string `json:"asns,omitempty"`
+	// MinPeersSeeing drops prefixes seen by fewer RIS peers, defaults to the API default.
+	MinPeersSeeing int `json:"minPeersSeeing,omitempty"`
+}
+
+type announcedPrefixesResponse struct {
+	Status   string          `json:"status"`
+	Messages [][]string      `json:"messages"`
+	Data     announcedPrefix `json:"data"`
+}
+
+type announcedPrefix struct {
+	Prefixes []struct {
+		Prefix string `json:"prefix"`
+	} `json:"prefixes"`
+}
+
+type asnSource struct {
+	endpoint       string
+	asns           []string
+	minPeersSeeing int
+	httpGet        httpGetter
+}
+
+func newASNSource(name string, config SourceConfig, env sourceEnv) (rangeSource, error) {
+	if config.ASN == nil || len(config.ASN.ASNs) == 0 {
+		return nil, fmt.Errorf("asn.asns is required")
+	}
+	if config.ASN.MinPeersSeeing < 0 {
+		return nil, fmt.Errorf("asn.minPeersSeeing must not be negative")
+	}
+
+	asns := make([]string, 0, len(config.ASN.ASNs))
+	for _, raw := range config.ASN.ASNs {
+		asn, err := parseASN(raw)
+		if err != nil {
+			return nil, fmt.Errorf("asn.asns: %w", err)
+		}
+		asns = append(asns, "AS"+strconv.FormatUint(uint64(asn), 10))
+	}
+
+	endpoint := strings.TrimSpace(config.URL)
+	if endpoint == "" {
+		endpoint = defaultAnnouncedPrefixesEndpoint
+	}
+	if _, err := url.Parse(endpoint); err != nil {
+		return nil, fmt.Errorf("url: %w", err)
+	}
+
+	return newLastGoodSource(name, &asnSource{
+		endpoint:       endpoint,
+		asns:           asns,
+		minPeersSeeing: config.ASN.MinPeersSeeing,
+		httpGet:        env.httpGet,
+	}), nil
+}
+
+// parseASN accepts "AS13335" or "13335".
+func parseASN(raw string) (uint32, error) {
+	number := strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(raw)), "AS")
+	asn, err := strconv.ParseUint(number, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid ASN %q", raw)
+	}
+
+	return uint32(asn), nil
+}
+
+func (s *asnSource) fetch(ctx context.Context) ([]labeledRange, error) {
+	ranges := make([]labeledRange, 0)
+
+	for _, asn := range s.asns {
+		endpoint, _ := url.Parse(s.endpoint)
+		query := endpoint.Query()
+		query.Set("resource", asn)
+		if s.minPeersSeeing > 0 {
+			query.Set("min_peers_seeing", strconv.Itoa(s.minPeersSeeing))
+		}
+		endpoint.RawQuery = query.Encode()
+
+		body, err := s.httpGet(ctx, endpoint.String())
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", asn, err)
+		}
+
+		var response announcedPrefixesResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, fmt.Errorf("%s: %w", asn, err)
+		}
+		if response.Status != "" && response.Status != "ok" {
+			return nil, fmt.Errorf("%s: announced-prefixes status %q %v", asn, response.Status, response.Messages)
+		}
+		if len(response.Data.Prefixes) == 0 {
+			return nil, fmt.Errorf("%s: no announced prefixes", asn)
+		}
+
+		for _, prefix := range response.Data.Prefixes {
+			ranges = append(ranges, labeledRange{CIDR: prefix.Prefix, Label: asn})
+		}
+	}
+
+	return ranges, nil
+}
+
+// lastGoodSource keeps serving the last successful result of a source while it fails,
+// so an outage of the upstream API does not block refreshes of everything else.
+type lastGoodSource struct {
+	name   string
+	source rangeSource
+
+	mu     sync.Mutex
+	ranges []labeledRange
+}
+
+func newLastGoodSource(name string, source rangeSource) *lastGoodSource {
+	return &lastGoodSource{name: name, source: source}
+}
+
+func (s *lastGoodSource) fetch(ctx context.Context) ([]labeledRange, error) {
+	ranges, err := s.source.fetch(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		if s.ranges == nil {
+			return nil, err
+		}
+		log.Printf("traefik_dynamic_public_whitelist: source %s: using last known ranges: %v", s.name, err)
+		return s.ranges, nil
+	}
+
+	s.ranges = ranges
+
+	return ranges, nil
+}
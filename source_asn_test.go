@@ -0,0 +1,97 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+func TestASNSource(t *testing.T) {
+	var outage int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&outage) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if got := r.URL.Query().Get("min_peers_seeing"); got != "50" {
+			t.Errorf("unexpected min_peers_seeing %q", got)
+		}
+
+		switch r.URL.Query().Get("resource") {
+		case "AS64496":
+			_, _ = w.Write([]byte(`{"status":"ok","data":{"prefixes":[{"prefix":"192.0.2.0/24","timelines":[]},{"prefix":"2001:db8::/32","timelines":[]}]}}`))
+		case "AS64497":
+			_, _ = w.Write([]byte(`{"status":"ok","data":{"prefixes":[{"prefix":"198.51.100.0/24","timelines":[]}]}}`))
+		default:
+			t.Errorf("unexpected resource %q", r.URL.Query().Get("resource"))
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "asn",
+		URL:  srv.URL + "/data/announced-prefixes/data.json",
+		ASN:  &traefikdynamicpublicwhitelist.ASNSourceConfig{ASNs: []string{"AS64496", "64497"}, MinPeersSeeing: 50},
+	}}
+
+	provider := newProvider(t, cfg)
+	sourceRange := func() string {
+		t.Helper()
+		configuration, err := provider.GenerateConfiguration(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ",")
+	}
+
+	if got := sourceRange(); got != "192.0.2.0/24,198.51.100.0/24" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+
+	// an API outage keeps the last known prefixes
+	atomic.StoreInt32(&outage, 1)
+	if got := sourceRange(); got != "192.0.2.0/24,198.51.100.0/24" {
+		t.Fatalf("unexpected source ranges during outage: %s", got)
+	}
+}
+
+func TestASNSourceFailsWithoutPreviousResult(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(`{"status":"error","messages":[["error","invalid resource"]],"data":{}}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "asn",
+		URL:  srv.URL,
+		ASN:  &traefikdynamicpublicwhitelist.ASNSourceConfig{ASNs: []string{"AS64496"}},
+	}}
+
+	provider := newProvider(t, cfg)
+	if _, err := provider.GenerateConfiguration(context.Background()); err == nil {
+		t.Fatal("expected error for failed API call")
+	}
+}
+
+func TestASNSourceValidation(t *testing.T) {
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "asn"}}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error without asns")
+	}
+
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "asn",
+		ASN:  &traefikdynamicpublicwhitelist.ASNSourceConfig{ASNs: []string{"ASX"}},
+	}}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error for invalid ASN")
+	}
+}
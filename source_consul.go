@@ -0,0 +1,291 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sourceTypeConsul = "consul"
+
+	defaultConsulAddress = "http://127.0.0.1:8500"
+	consulTimeout        = 10 * time.Second
+	// consulWait is the blocking query wait; Consul adds up to wait/16 of jitter.
+	consulWait = 5 * time.Minute
+	// consulRetry delays the next blocking query after a failure.
+	consulRetry = 5 * time.Second
+)
+
+// ConsulSourceConfig selects the KV prefix and catalog services read from Consul.
+type ConsulSourceConfig struct {
+	// Token is the ACL token, defaults to CONSUL_HTTP_TOKEN.
+	Token      string `json:"token,omitempty"`
+	Datacenter string `json:"datacenter,omitempty"`
+	// KVPrefix lists the keys whose values hold text lists of ranges.
+	KVPrefix string `json:"kvPrefix,omitempty"`
+	// Services are catalog services whose instance addresses are allowed.
+	Services []string `json:"services,omitempty"`
+	// Tag keeps only the service instances carrying it.
+	Tag string `json:"tag,omitempty"`
+}
+
+type consulKVPair struct {
+	Key   string `json:"Key"`
+	Value []byte `json:"Value"`
+}
+
+type consulCatalogService struct {
+	Node           string `json:"Node"`
+	Address        string `json:"Address"`
+	ServiceAddress string `json:"ServiceAddress"`
+}
+
+// consulSource reads a KV prefix and catalog service addresses. Between polls it holds a
+// blocking query per endpoint so changes trigger a refresh within seconds.
+type consulSource struct {
+	name       string
+	address    string
+	token      string
+	datacenter string
+	kvPrefix   string
+	services   []string
+	tag        string
+	client     *http.Client
+	blocking   *http.Client
+
+	// indexes holds the X-Consul-Index of each endpoint at the last fetch so blocking
+	// queries also catch changes made before the watch started.
+	mu      sync.Mutex
+	indexes map[string]uint64
+}
+
+func newConsulSource(name string, config SourceConfig) (rangeSource, error) {
+	if config.Consul == nil || (strings.TrimSpace(config.Consul.KVPrefix) == "" && len(config.Consul.Services) == 0) {
+		return nil, fmt.Errorf("consul.kvPrefix or consul.services is required")
+	}
+
+	address := strings.TrimSpace(config.URL)
+	if address == "" {
+		address = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if address == "" {
+		address = defaultConsulAddress
+	}
+	if !strings.Contains(address, "://") {
+		address = "http://" + address
+	}
+	if _, err := url.Parse(address); err != nil {
+		return nil, fmt.Errorf("url: %w", err)
+	}
+
+	token := strings.TrimSpace(config.Consul.Token)
+	if token == "" {
+		token = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+
+	services := make([]string, 0, len(config.Consul.Services))
+	for _, service := range config.Consul.Services {
+		if service = strings.TrimSpace(service); service != "" {
+			services = append(services, service)
+		}
+	}
+
+	return &consulSource{
+		name:       name,
+		address:    strings.TrimSuffix(address, "/"),
+		token:      token,
+		datacenter: strings.TrimSpace(config.Consul.Datacenter),
+		kvPrefix:   strings.Trim(strings.TrimSpace(config.Consul.KVPrefix), "/"),
+		services:   services,
+		tag:        strings.TrimSpace(config.Consul.Tag),
+		client:     &http.Client{Timeout: consulTimeout},
+		blocking:   &http.Client{Timeout: consulWait + consulWait/16 + consulTimeout},
+		indexes:    make(map[string]uint64),
+	}, nil
+}
+
+// endpoints returns the paths read by the source.
+func (s *consulSource) endpoints() []string {
+	paths := make([]string, 0, len(s.services)+1)
+	if s.kvPrefix != "" {
+		paths = append(paths, "/v1/kv/"+s.kvPrefix)
+	}
+	for _, service := range s.services {
+		paths = append(paths, "/v1/catalog/service/"+service)
+	}
+
+	return paths
+}
+
+// allowsEmpty reports that deregistered instances and deleted keys empty the allowlist.
+func (s *consulSource) allowsEmpty() bool {
+	return true
+}
+
+func (s *consulSource) fetch(ctx context.Context) ([]labeledRange, error) {
+	ranges := make([]labeledRange, 0)
+
+	if s.kvPrefix != "" {
+		var pairs []consulKVPair
+		if err := s.read(ctx, "/v1/kv/"+s.kvPrefix, &pairs); err != nil {
+			return nil, err
+		}
+
+		parser := &textParser{comment: defaultCommentPrefix}
+		for _, pair := range pairs {
+			// without a delimiter or regex the text parser cannot fail
+			entries, _ := parser.parse(pair.Value)
+			for _, entry := range entries {
+				if entry.Label == "" {
+					entry.Label = pair.Key
+				}
+				ranges = append(ranges, entry)
+			}
+		}
+	}
+
+	for _, service := range s.services {
+		var instances []consulCatalogService
+		if err := s.read(ctx, "/v1/catalog/service/"+service, &instances); err != nil {
+			return nil, err
+		}
+
+		for _, instance := range instances {
+			address := instance.ServiceAddress
+			if address == "" {
+				address = instance.Address
+			}
+			if address != "" {
+				ranges = append(ranges, labeledRange{CIDR: address, Label: service + "/" + instance.Node})
+			}
+		}
+	}
+
+	return ranges, nil
+}
+
+// read fetches path and records its index for the blocking queries.
+func (s *consulSource) read(ctx context.Context, path string, target interface{}) error {
+	index, err := s.get(ctx, s.client, path, 0, target)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.indexes[path] = index
+	s.mu.Unlock()
+
+	return nil
+}
+
+// watch runs one blocking query loop per endpoint.
+func (s *consulSource) watch(ctx context.Context, notify func()) {
+	for _, path := range s.endpoints() {
+		path := path
+		goRecover(s.name, func() { s.block(ctx, path, notify) })
+	}
+}
+
+// block repeats a blocking query on path and notifies whenever the returned index changes,
+// starting from the index of the last fetch.
+func (s *consulSource) block(ctx context.Context, path string, notify func()) {
+	s.mu.Lock()
+	index := s.indexes[path]
+	s.mu.Unlock()
+
+	for {
+		var discard json.RawMessage
+		next, err := s.get(ctx, s.blocking, path, index, &discard)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			log.Printf("traefik_dynamic_public_whitelist: source %s: consul blocking query %s: %v", s.name, path, err)
+			select {
+			case <-time.After(consulRetry):
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		if next == 0 {
+			// Consul indexes start at 1, a zero index would turn the next query non-blocking
+			next = 1
+		}
+
+		switch {
+		case next < index:
+			// the index went backwards (e.g. a snapshot restore), start over
+			index = 0
+			notify()
+		case index != 0 && next != index:
+			index = next
+			notify()
+		default:
+			index = next
+		}
+	}
+}
+
+// get reads path into target and returns the X-Consul-Index. A non-zero index turns the
+// request into a blocking query. Missing KV prefixes decode as an empty list.
+func (s *consulSource) get(ctx context.Context, client *http.Client, path string, index uint64, target interface{}) (uint64, error) {
+	query := url.Values{}
+	if s.datacenter != "" {
+		query.Set("dc", s.datacenter)
+	}
+	if strings.HasPrefix(path, "/v1/kv/") {
+		query.Set("recurse", "true")
+	}
+	if s.tag != "" && strings.HasPrefix(path, "/v1/catalog/service/") {
+		query.Set("tag", s.tag)
+	}
+	if index != 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", consulWait.String())
+	}
+
+	endpoint := s.address + (&url.URL{Path: path}).EscapedPath()
+	if encoded := query.Encode(); encoded != "" {
+		endpoint += "?" + encoded
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return 0, err
+	}
+	if s.token != "" {
+		req.Header.Set("X-Consul-Token", s.token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer closeBody(resp.Body)
+
+	next, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+
+	if resp.StatusCode == http.StatusNotFound && strings.HasPrefix(path, "/v1/kv/") {
+		return next, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("consul: GET %s: status %d", path, resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(target); err != nil {
+		return 0, fmt.Errorf("consul: GET %s: %w", path, err)
+	}
+
+	return next, nil
+}
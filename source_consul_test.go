@@ -0,0 +1,150 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+// fakeConsul serves KV and catalog reads; blocking queries wait until the index moves.
+type fakeConsul struct {
+	t *testing.T
+
+	mu      sync.Mutex
+	index   int
+	kv      map[string]string
+	changed chan struct{}
+}
+
+func (c *fakeConsul) set(key, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.kv[key] = value
+	c.index++
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+func (c *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if got := r.Header.Get("X-Consul-Token"); got != "acl-token" {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if got := r.URL.Query().Get("dc"); got != "dc2" {
+		c.t.Errorf("unexpected datacenter %q", got)
+	}
+
+	c.mu.Lock()
+	index, changed := c.index, c.changed
+	c.mu.Unlock()
+
+	if wait := r.URL.Query().Get("index"); wait == strconv.Itoa(index) {
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	w.Header().Set("X-Consul-Index", strconv.Itoa(c.index))
+
+	switch r.URL.Path {
+	case "/v1/kv/network/allowed":
+		if r.URL.Query().Get("recurse") != "true" {
+			c.t.Errorf("kv read without recurse")
+		}
+		pairs := make([]map[string]interface{}, 0, len(c.kv))
+		for _, key := range []string{"network/allowed/office", "network/allowed/vpn"} {
+			if value, ok := c.kv[key]; ok {
+				pairs = append(pairs, map[string]interface{}{"Key": key, "Value": []byte(value), "ModifyIndex": c.index})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(pairs)
+	case "/v1/catalog/service/egress":
+		if got := r.URL.Query().Get("tag"); got != "public" {
+			c.t.Errorf("unexpected tag %q", got)
+		}
+		_, _ = w.Write([]byte(`[
+			{"Node":"edge-1","Address":"10.0.0.1","ServiceAddress":"203.0.113.10"},
+			{"Node":"edge-2","Address":"203.0.113.11","ServiceAddress":""}]`))
+	default:
+		c.t.Errorf("unexpected request %s", r.URL.Path)
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func TestConsulSource(t *testing.T) {
+	consul := &fakeConsul{
+		t:       t,
+		index:   7,
+		kv:      map[string]string{"network/allowed/office": "192.0.2.0/24 # hq\n"},
+		changed: make(chan struct{}),
+	}
+	srv := httptest.NewServer(consul)
+	t.Cleanup(srv.Close)
+
+	cfg := baseConfig("")
+	cfg.PollInterval = "1h"
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "consul",
+		URL:  srv.URL,
+		Consul: &traefikdynamicpublicwhitelist.ConsulSourceConfig{
+			Token:      "acl-token",
+			Datacenter: "dc2",
+			KVPrefix:   "/network/allowed/",
+			Services:   []string{"egress"},
+			Tag:        "public",
+		},
+	}}
+
+	provider := newProvider(t, cfg)
+	cfgChan := make(chan json.Marshaler, 1)
+	if err := provider.Provide(cfgChan); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := nextSourceRange(t, cfgChan); got != "192.0.2.0/24,203.0.113.10,203.0.113.11" {
+		t.Fatalf("unexpected initial source ranges: %s", got)
+	}
+
+	// a KV write unblocks the pending query and reaches Traefik without waiting for pollInterval
+	consul.set("network/allowed/vpn", "198.51.100.0/24\n")
+
+	if got := nextSourceRange(t, cfgChan); got != "192.0.2.0/24,198.51.100.0/24,203.0.113.10,203.0.113.11" {
+		t.Fatalf("unexpected refreshed source ranges: %s", got)
+	}
+}
+
+func TestConsulSourceACL(t *testing.T) {
+	srv := httptest.NewServer(&fakeConsul{t: t, kv: map[string]string{}, changed: make(chan struct{})})
+	t.Cleanup(srv.Close)
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type:   "consul",
+		URL:    srv.URL,
+		Consul: &traefikdynamicpublicwhitelist.ConsulSourceConfig{Token: "wrong", KVPrefix: "network/allowed"},
+	}}
+
+	provider := newProvider(t, cfg)
+	if _, err := provider.GenerateConfiguration(context.Background()); err == nil {
+		t.Fatal("expected error for a rejected ACL token")
+	}
+}
+
+func TestConsulSourceValidation(t *testing.T) {
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "consul", Consul: &traefikdynamicpublicwhitelist.ConsulSourceConfig{Token: "acl-token"}}}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error without kvPrefix or services")
+	}
+}
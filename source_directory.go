@@ -0,0 +1,220 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sourceTypeDirectory = "directory"
+
+var defaultDirectoryPatterns = []string{"*.txt", "*.json"}
+
+// DirectorySourceConfig selects the files merged by a directory source.
+type DirectorySourceConfig struct {
+	// Patterns are glob patterns matched against file names, defaults to *.txt and *.json.
+	Patterns []string `json:"patterns,omitempty"`
+}
+
+// directorySource merges every matching file of a conf.d style directory,
+// labelling each range with the file it came from.
+type directorySource struct {
+	name          string
+	path          string
+	patterns      []string
+	config        SourceConfig
+	env           sourceEnv
+	watchInterval time.Duration
+
+	mu        sync.Mutex
+	files     map[string]*fileSource
+	signature string
+}
+
+func newDirectorySource(name string, config SourceConfig, env sourceEnv) (rangeSource, error) {
+	path := strings.TrimSpace(config.Path)
+	if path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+
+	patterns := defaultDirectoryPatterns
+	if config.Directory != nil && len(config.Directory.Patterns) > 0 {
+		patterns = config.Directory.Patterns
+	}
+	for _, pattern := range patterns {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("directory.patterns: invalid pattern %q", pattern)
+		}
+	}
+
+	// validate the format settings once; files are parsed by extension unless format is set
+	if _, err := newDocumentParser(config, env, patterns[0]); err != nil {
+		return nil, err
+	}
+
+	watchInterval, err := parseWatchInterval(config.WatchInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	return &directorySource{
+		name:          name,
+		path:          path,
+		patterns:      append([]string(nil), patterns...),
+		config:        config,
+		env:           env,
+		watchInterval: watchInterval,
+		files:         make(map[string]*fileSource),
+	}, nil
+}
+
+// matches lists the matching regular files, sorted by name.
+func (s *directorySource) matches() ([]string, error) {
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+		for _, pattern := range s.patterns {
+			if ok, _ := filepath.Match(pattern, name); ok {
+				names = append(names, name)
+				break
+			}
+		}
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+// allowsEmpty reports that removing every fragment empties the allowlist.
+func (s *directorySource) allowsEmpty() bool {
+	return true
+}
+
+// fetch merges every matching file. A malformed file is reported and skipped so the
+// other fragments still apply; the source only fails when no file could be read.
+func (s *directorySource) fetch(ctx context.Context) ([]labeledRange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names, err := s.matches()
+	if err != nil {
+		return nil, err
+	}
+
+	present := make(map[string]struct{}, len(names))
+	ranges := make([]labeledRange, 0)
+	failed := 0
+
+	for _, name := range names {
+		present[name] = struct{}{}
+
+		file, ok := s.files[name]
+		if !ok {
+			parser, err := newDocumentParser(s.config, s.env, name)
+			if err != nil {
+				log.Printf("traefik_dynamic_public_whitelist: source %s: skipping %s: %v", s.name, name, err)
+				failed++
+				continue
+			}
+			file = &fileSource{path: filepath.Join(s.path, name), parser: parser}
+			s.files[name] = file
+		}
+
+		fileRanges, err := file.fetch(ctx)
+		if err != nil {
+			log.Printf("traefik_dynamic_public_whitelist: source %s: skipping %s: %v", s.name, name, err)
+			failed++
+			continue
+		}
+
+		for _, entry := range fileRanges {
+			label := name
+			if entry.Label != "" {
+				label = name + ": " + entry.Label
+			}
+			ranges = append(ranges, labeledRange{CIDR: entry.CIDR, Label: label})
+		}
+	}
+
+	for name := range s.files {
+		if _, ok := present[name]; !ok {
+			delete(s.files, name)
+		}
+	}
+
+	if len(names) > 0 && failed == len(names) {
+		return nil, fmt.Errorf("no readable file in %s", s.path)
+	}
+
+	s.signature = s.snapshot(names)
+
+	return ranges, nil
+}
+
+// snapshot summarizes the name, size and mtime of every matching file.
+func (s *directorySource) snapshot(names []string) string {
+	var b strings.Builder
+	for _, name := range names {
+		info, err := os.Stat(filepath.Join(s.path, name))
+		if err != nil {
+			continue
+		}
+		fmt.Fprintf(&b, "%s|%d|%d\n", name, info.Size(), info.ModTime().UnixNano())
+	}
+
+	return b.String()
+}
+
+// watch notifies when files are added, removed or modified between polls.
+func (s *directorySource) watch(ctx context.Context, notify func()) {
+	if s.watchInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if s.changed() {
+				notify()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *directorySource) changed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names, err := s.matches()
+	if err != nil {
+		return false
+	}
+
+	signature := s.snapshot(names)
+	if signature == s.signature {
+		return false
+	}
+	s.signature = signature
+
+	return true
+}
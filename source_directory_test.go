@@ -0,0 +1,142 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+func TestDirectorySourceLabelsAndMalformedFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "10-office.txt"), "203.0.113.0/24 ; hq\n")
+	writeFile(t, filepath.Join(dir, "20-vpn.json"), `["198.51.100.0/24"]`)
+	writeFile(t, filepath.Join(dir, "30-broken.json"), `["192.0.2.0/24"`)
+	writeFile(t, filepath.Join(dir, "README.md"), "100.64.0.0/10\n")
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "directory", Name: "teams", Path: dir}}
+	cfg.ConfigurationTemplate = `{"http":{"middlewares":{"labels":{"headers":{"customRequestHeaders":{{json .Labels}}}}}}}`
+
+	middlewares := emittedMiddlewares(t, cfg)
+	headers := middlewareSection(t, middlewares, "labels", "headers")
+	labels, _ := headers["customRequestHeaders"].(map[string]interface{})
+
+	expected := map[string]string{
+		"203.0.113.0/24":  "10-office.txt: hq",
+		"198.51.100.0/24": "20-vpn.json",
+	}
+	if len(labels) != len(expected) {
+		t.Fatalf("unexpected labels: %v", labels)
+	}
+	for cidr, label := range expected {
+		if labels[cidr] != label {
+			t.Fatalf("label of %s: got %v want %q", cidr, labels[cidr], label)
+		}
+	}
+}
+
+func TestDirectorySourcePicksUpAddedAndRemovedFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "office.txt"), "203.0.113.0/24\n")
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type:      "directory",
+		Path:      dir,
+		Directory: &traefikdynamicpublicwhitelist.DirectorySourceConfig{Patterns: []string{"*.txt", "*.list"}},
+	}}
+
+	provider := newProvider(t, cfg)
+	sourceRange := func() string {
+		t.Helper()
+		configuration, err := provider.GenerateConfiguration(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ",")
+	}
+
+	if got := sourceRange(); got != "203.0.113.0/24" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+
+	writeFile(t, filepath.Join(dir, "partners.list"), "198.51.100.0/24\n")
+	if got := sourceRange(); got != "203.0.113.0/24,198.51.100.0/24" {
+		t.Fatalf("added file not picked up: %s", got)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "office.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if got := sourceRange(); got != "198.51.100.0/24" {
+		t.Fatalf("removed file still applied: %s", got)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "partners.list")); err != nil {
+		t.Fatal(err)
+	}
+	if got := sourceRange(); got != "0.0.0.0/32" {
+		t.Fatalf("expected every client to be denied once all files are removed: %s", got)
+	}
+}
+
+func TestDirectorySourceEmptyDoesNotLockOutForGood(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "office.txt"), "203.0.113.0/24\n")
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "directory", Path: dir}}
+	sourceRange := func(provider *traefikdynamicpublicwhitelist.Provider) string {
+		t.Helper()
+		configuration, err := provider.GenerateConfiguration(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ",")
+	}
+
+	alone := newProvider(t, cfg)
+	cfg.AdditionalSourceRange = []string{"192.0.2.10"}
+	withStatic := newProvider(t, cfg)
+
+	if err := os.Remove(filepath.Join(dir, "office.txt")); err != nil {
+		t.Fatal(err)
+	}
+	if got := sourceRange(alone); got != "0.0.0.0/32" {
+		t.Fatalf("expected every client to be denied while the allowlist is empty: %s", got)
+	}
+	// other ranges keep applying while the source is empty
+	if got := sourceRange(withStatic); got != "192.0.2.10" {
+		t.Fatalf("unexpected source ranges with additionalSourceRange: %s", got)
+	}
+
+	// the next refresh after the transient empty result restores access
+	writeFile(t, filepath.Join(dir, "office.txt"), "203.0.113.0/24\n")
+	if got := sourceRange(alone); got != "203.0.113.0/24" {
+		t.Fatalf("allowlist not restored after the source recovered: %s", got)
+	}
+	if got := sourceRange(withStatic); got != "192.0.2.10,203.0.113.0/24" {
+		t.Fatalf("allowlist not restored after the source recovered: %s", got)
+	}
+}
+
+func TestDirectorySourceValidation(t *testing.T) {
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "directory"}}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error without path")
+	}
+
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type:      "directory",
+		Path:      t.TempDir(),
+		Directory: &traefikdynamicpublicwhitelist.DirectorySourceConfig{Patterns: []string{"[*.txt"}},
+	}}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error for invalid pattern")
+	}
+}
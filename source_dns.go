@@ -0,0 +1,194 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sourceTypeDNS = "dns"
+
+	// dnsMinTTL bounds re-resolution of records published with a zero or tiny TTL.
+	dnsMinTTL = time.Second
+	// dnsMinRefresh bounds how often expiring records trigger a refresh between polls.
+	dnsMinRefresh = 30 * time.Second
+)
+
+// DNSSourceConfig lists the hostnames resolved by a dns source.
+type DNSSourceConfig struct {
+	Hostnames []string `json:"hostnames,omitempty"`
+	// Server is the DNS server (host or host:port), defaults to the system resolver.
+	Server string `json:"server,omitempty"`
+}
+
+type dnsHostEntry struct {
+	ranges  []labeledRange
+	expires time.Time
+}
+
+// dnsSource resolves hostnames to A/AAAA records and caches each host for its record TTL.
+type dnsSource struct {
+	name          string
+	hostnames     []string
+	client        *dnsClient
+	whitelistIPv6 bool
+
+	mu    sync.Mutex
+	cache map[string]dnsHostEntry
+}
+
+func newDNSSource(name string, config SourceConfig, env sourceEnv) (rangeSource, error) {
+	if config.DNS == nil || len(config.DNS.Hostnames) == 0 {
+		return nil, fmt.Errorf("dns.hostnames is required")
+	}
+
+	hostnames := make([]string, 0, len(config.DNS.Hostnames))
+	for _, hostname := range config.DNS.Hostnames {
+		hostname = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(hostname), "."))
+		if _, err := encodeDNSName(hostname); err != nil {
+			return nil, fmt.Errorf("dns.hostnames: %w", err)
+		}
+		hostnames = append(hostnames, hostname)
+	}
+
+	return &dnsSource{
+		name:          name,
+		hostnames:     hostnames,
+		client:        newDNSClient(config.DNS.Server),
+		whitelistIPv6: env.whitelistIPv6,
+		cache:         make(map[string]dnsHostEntry),
+	}, nil
+}
+
+// fetch resolves every hostname whose cached records expired. Hosts without
+// addresses are logged and skipped; query failures fail the refresh.
+func (s *dnsSource) fetch(ctx context.Context) ([]labeledRange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	ranges := make([]labeledRange, 0, len(s.hostnames))
+
+	for _, hostname := range s.hostnames {
+		entry, ok := s.cache[hostname]
+		if !ok || !now.Before(entry.expires) {
+			resolved, ttl, err := s.resolve(ctx, hostname)
+			if errors.Is(err, errDNSNotFound) {
+				log.Printf("traefik_dynamic_public_whitelist: source %s: %s: skipping host without A/AAAA records", s.name, hostname)
+				delete(s.cache, hostname)
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", hostname, err)
+			}
+			entry = dnsHostEntry{ranges: resolved, expires: now.Add(ttl)}
+			s.cache[hostname] = entry
+		}
+
+		ranges = append(ranges, entry.ranges...)
+	}
+
+	return ranges, nil
+}
+
+// resolve queries A (and AAAA when IPv6 is whitelisted) records and returns them
+// with the lowest record TTL.
+func (s *dnsSource) resolve(ctx context.Context, hostname string) ([]labeledRange, time.Duration, error) {
+	qtypes := []uint16{dnsTypeA}
+	if s.whitelistIPv6 {
+		qtypes = append(qtypes, dnsTypeAAAA)
+	}
+
+	ranges := make([]labeledRange, 0, 2)
+	ttl := time.Duration(-1)
+
+	for _, qtype := range qtypes {
+		records, err := s.client.query(ctx, hostname, qtype)
+		if errors.Is(err, errDNSNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+
+		for _, record := range records {
+			cidr := record.IP.String()
+			if qtype == dnsTypeAAAA {
+				// same /64 normalization as the custom provider's IPv6 resolver
+				if cidr, err = ipv6ToCIDR(cidr); err != nil {
+					return nil, 0, err
+				}
+			}
+			ranges = append(ranges, labeledRange{CIDR: cidr, Label: hostname})
+
+			recordTTL := time.Duration(record.TTL) * time.Second
+			if ttl < 0 || recordTTL < ttl {
+				ttl = recordTTL
+			}
+		}
+	}
+
+	if len(ranges) == 0 {
+		return nil, 0, errDNSNotFound
+	}
+
+	if ttl < dnsMinTTL {
+		ttl = dnsMinTTL
+	}
+
+	return ranges, ttl, nil
+}
+
+// watch requests a refresh when cached records expire before the next poll.
+func (s *dnsSource) watch(ctx context.Context, notify func()) {
+	for {
+		wait := s.nextExpiry().Sub(time.Now())
+		if wait < dnsMinRefresh {
+			wait = dnsMinRefresh
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+			if s.expired() {
+				notify()
+			}
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+func (s *dnsSource) nextExpiry() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var next time.Time
+	for _, entry := range s.cache {
+		if next.IsZero() || entry.expires.Before(next) {
+			next = entry.expires
+		}
+	}
+
+	return next
+}
+
+func (s *dnsSource) expired() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for _, entry := range s.cache {
+		if !now.Before(entry.expires) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,237 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+const (
+	testDNSTypeA    = 1
+	testDNSTypeMX   = 15
+	testDNSTypeTXT  = 16
+	testDNSTypeAAAA = 28
+)
+
+type testDNSRecord struct {
+	Type  uint16
+	TTL   uint32
+	Value string
+}
+
+func TestDNSSource(t *testing.T) {
+	server, queries := startDNSServer(t, map[string][]testDNSRecord{
+		"branch.example.com": {
+			{Type: testDNSTypeA, TTL: 300, Value: "198.51.100.7"},
+			{Type: testDNSTypeA, TTL: 300, Value: "198.51.100.8"},
+			{Type: testDNSTypeAAAA, TTL: 300, Value: "2001:db8:1:2:3::1"},
+		},
+		"office.example.com": {
+			{Type: testDNSTypeA, TTL: 1, Value: "203.0.113.5"},
+		},
+	})
+
+	cfg := baseConfig("")
+	cfg.WhitelistIPv6 = true
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "dns",
+		DNS: &traefikdynamicpublicwhitelist.DNSSourceConfig{
+			Hostnames: []string{"branch.example.com", "Office.Example.com."},
+			Server:    server,
+		},
+	}}
+
+	provider := newProvider(t, cfg)
+	sourceRange := func() string {
+		t.Helper()
+		configuration, err := provider.GenerateConfiguration(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ",")
+	}
+
+	if got := sourceRange(); got != "198.51.100.7,198.51.100.8,2001:db8:1:2::/64,203.0.113.5" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+	if got := atomic.LoadInt32(queries); got != 4 {
+		t.Fatalf("expected 4 queries, got %d", got)
+	}
+
+	// both hosts are cached until their TTL expires
+	sourceRange()
+	if got := atomic.LoadInt32(queries); got != 4 {
+		t.Fatalf("expected cached answers, got %d queries", got)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	sourceRange()
+	if got := atomic.LoadInt32(queries); got != 6 {
+		t.Fatalf("expected only the expired host to be re-resolved, got %d queries", got)
+	}
+}
+
+func TestDNSSourceUnknownHost(t *testing.T) {
+	server, _ := startDNSServer(t, map[string][]testDNSRecord{})
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "dns",
+		DNS:  &traefikdynamicpublicwhitelist.DNSSourceConfig{Hostnames: []string{"missing.example.com"}, Server: server},
+	}}
+
+	provider := newProvider(t, cfg)
+	if _, err := provider.GenerateConfiguration(context.Background()); err == nil {
+		t.Fatal("expected error for unknown host")
+	}
+}
+
+func TestDNSSourceSkipsUnknownHost(t *testing.T) {
+	server, _ := startDNSServer(t, map[string][]testDNSRecord{
+		"branch.example.com": {{Type: testDNSTypeA, TTL: 300, Value: "198.51.100.7"}},
+	})
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "dns",
+		DNS: &traefikdynamicpublicwhitelist.DNSSourceConfig{
+			Hostnames: []string{"retired.example.com", "branch.example.com"},
+			Server:    server,
+		},
+	}}
+
+	// a decommissioned branch must not drop the ranges of every other host
+	configuration := loadOnce(t, cfg)
+	if got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ","); got != "198.51.100.7" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+}
+
+func TestDNSSourceValidation(t *testing.T) {
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "dns"}}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error without hostnames")
+	}
+
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "dns",
+		DNS:  &traefikdynamicpublicwhitelist.DNSSourceConfig{Hostnames: []string{"bad..example.com"}},
+	}}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error for invalid hostname")
+	}
+}
+
+// startDNSServer answers UDP queries from zone and counts them.
+func startDNSServer(t *testing.T, zone map[string][]testDNSRecord) (string, *int32) {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	queries := new(int32)
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(queries, 1)
+			if response := answerDNSQuery(buf[:n], zone); response != nil {
+				_, _ = conn.WriteTo(response, addr)
+			}
+		}
+	}()
+
+	return conn.LocalAddr().String(), queries
+}
+
+func answerDNSQuery(query []byte, zone map[string][]testDNSRecord) []byte {
+	if len(query) < 12 {
+		return nil
+	}
+
+	labels := make([]string, 0, 4)
+	offset := 12
+	for offset < len(query) && query[offset] != 0 {
+		size := int(query[offset])
+		labels = append(labels, string(query[offset+1:offset+1+size]))
+		offset += 1 + size
+	}
+	offset++
+	qtype := binary.BigEndian.Uint16(query[offset:])
+	question := query[12 : offset+4]
+	name := strings.ToLower(strings.Join(labels, "."))
+
+	records, ok := zone[name]
+
+	response := make([]byte, 12, 512)
+	copy(response, query[:2])
+	response[2] = 0x81 // response, recursion desired
+	response[3] = 0x80 // recursion available
+	if !ok {
+		response[3] |= 3 // NXDOMAIN
+	}
+	binary.BigEndian.PutUint16(response[4:], 1)
+	response = append(response, question...)
+
+	answers := 0
+	for _, record := range records {
+		if record.Type != qtype {
+			continue
+		}
+
+		var data []byte
+		switch record.Type {
+		case testDNSTypeA:
+			data = net.ParseIP(record.Value).To4()
+		case testDNSTypeAAAA:
+			data = net.ParseIP(record.Value).To16()
+		case testDNSTypeTXT:
+			for text := record.Value; ; {
+				chunk := text
+				if len(chunk) > 255 {
+					chunk = chunk[:255]
+				}
+				data = append(append(data, byte(len(chunk))), chunk...)
+				if text = text[len(chunk):]; text == "" {
+					break
+				}
+			}
+		case testDNSTypeMX:
+			data = append([]byte{0, 10}, encodeTestDNSName(record.Value)...)
+		}
+
+		response = append(response, 0xc0, 12) // pointer to the question name
+		response = append(response, byte(record.Type>>8), byte(record.Type), 0, 1)
+		response = append(response, byte(record.TTL>>24), byte(record.TTL>>16), byte(record.TTL>>8), byte(record.TTL))
+		response = append(response, byte(len(data)>>8), byte(len(data)))
+		response = append(response, data...)
+		answers++
+	}
+	binary.BigEndian.PutUint16(response[6:], uint16(answers))
+
+	return response
+}
+
+func encodeTestDNSName(name string) []byte {
+	if name == "." {
+		return []byte{0}
+	}
+	encoded := make([]byte, 0, len(name)+2)
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		encoded = append(append(encoded, byte(len(label))), label...)
+	}
+	return append(encoded, 0)
+}
@@ -0,0 +1,234 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	sourceTypeDocker = "docker"
+
+	defaultDockerEndpoint = "unix:///var/run/docker.sock"
+	dockerTimeout         = 10 * time.Second
+	// dockerEventsRetry delays reconnecting to the event stream after it failed.
+	dockerEventsRetry = 5 * time.Second
+)
+
+// DockerSourceConfig selects the Docker networks whose IPAM subnets are allowed.
+// A network is selected when its name is listed or it carries one of the labels.
+type DockerSourceConfig struct {
+	// Endpoint is the Docker API address ("unix:///path" or "tcp://host:port"),
+	// defaults to DOCKER_HOST or the local socket.
+	Endpoint string   `json:"endpoint,omitempty"`
+	Networks []string `json:"networks,omitempty"`
+	// Labels are "key" or "key=value".
+	Labels []string `json:"labels,omitempty"`
+}
+
+type dockerNetwork struct {
+	Name   string            `json:"Name"`
+	Labels map[string]string `json:"Labels"`
+	IPAM   struct {
+		Config []struct {
+			Subnet string `json:"Subnet"`
+		} `json:"Config"`
+	} `json:"IPAM"`
+}
+
+// dockerSource lists the Engine API networks and emits the subnets of the selected ones,
+// labelled with the network name. Network create and remove events trigger a refresh.
+type dockerSource struct {
+	name     string
+	baseURL  string
+	client   *http.Client
+	stream   *http.Client
+	networks map[string]struct{}
+	labels   map[string]string
+}
+
+func newDockerSource(name string, config SourceConfig) (rangeSource, error) {
+	if config.Docker == nil || (len(config.Docker.Networks) == 0 && len(config.Docker.Labels) == 0) {
+		return nil, fmt.Errorf("docker.networks or docker.labels is required")
+	}
+
+	endpoint := strings.TrimSpace(config.Docker.Endpoint)
+	if endpoint == "" {
+		endpoint = os.Getenv("DOCKER_HOST")
+	}
+	if endpoint == "" {
+		endpoint = defaultDockerEndpoint
+	}
+
+	baseURL, transport, err := dockerTransport(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	source := &dockerSource{
+		name:     name,
+		baseURL:  baseURL,
+		client:   &http.Client{Timeout: dockerTimeout, Transport: transport},
+		stream:   &http.Client{Transport: transport},
+		networks: make(map[string]struct{}, len(config.Docker.Networks)),
+		labels:   make(map[string]string, len(config.Docker.Labels)),
+	}
+
+	for _, network := range config.Docker.Networks {
+		source.networks[strings.TrimSpace(network)] = struct{}{}
+	}
+	for _, label := range config.Docker.Labels {
+		key, value, _ := strings.Cut(strings.TrimSpace(label), "=")
+		if key == "" {
+			return nil, fmt.Errorf("docker.labels: invalid label %q", label)
+		}
+		source.labels[key] = value
+	}
+
+	return source, nil
+}
+
+// dockerTransport maps a DOCKER_HOST style endpoint to a base URL and transport.
+func dockerTransport(endpoint string) (string, *http.Transport, error) {
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return "", nil, fmt.Errorf("docker.endpoint: %w", err)
+	}
+
+	switch parsed.Scheme {
+	case "unix":
+		return "http://docker", unixSocketTransport(parsed.Path), nil
+	case "tcp", "http":
+		return "http://" + parsed.Host, &http.Transport{Proxy: http.ProxyFromEnvironment}, nil
+	default:
+		return "", nil, fmt.Errorf("docker.endpoint: unsupported scheme %q", parsed.Scheme)
+	}
+}
+
+// unixSocketTransport sends every request to the unix socket at path, whatever the URL host.
+func unixSocketTransport(path string) *http.Transport {
+	dialer := &net.Dialer{Timeout: dockerTimeout}
+
+	return &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", path)
+		},
+	}
+}
+
+// allowsEmpty reports that removed networks empty the allowlist.
+func (s *dockerSource) allowsEmpty() bool {
+	return true
+}
+
+func (s *dockerSource) fetch(ctx context.Context) ([]labeledRange, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"/networks", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("docker: list networks: status %d", resp.StatusCode)
+	}
+
+	var networks []dockerNetwork
+	if err := json.NewDecoder(resp.Body).Decode(&networks); err != nil {
+		return nil, fmt.Errorf("docker: list networks: %w", err)
+	}
+
+	ranges := make([]labeledRange, 0)
+	for _, network := range networks {
+		if !s.selected(network) {
+			continue
+		}
+		for _, config := range network.IPAM.Config {
+			if config.Subnet != "" {
+				ranges = append(ranges, labeledRange{CIDR: config.Subnet, Label: network.Name})
+			}
+		}
+	}
+
+	return ranges, nil
+}
+
+func (s *dockerSource) selected(network dockerNetwork) bool {
+	if _, ok := s.networks[network.Name]; ok {
+		return true
+	}
+
+	for key, value := range s.labels {
+		if actual, ok := network.Labels[key]; ok && (value == "" || actual == value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// watch follows the network event stream, reconnecting after failures. A refresh is also
+// requested after reconnecting since events may have been missed in between.
+func (s *dockerSource) watch(ctx context.Context, notify func()) {
+	for connected := false; ; connected = true {
+		err := s.streamEvents(ctx, notify, connected)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("traefik_dynamic_public_whitelist: source %s: docker events: %v, reconnecting in %s", s.name, err, dockerEventsRetry)
+
+		select {
+		case <-time.After(dockerEventsRetry):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *dockerSource) streamEvents(ctx context.Context, notify func(), reconnect bool) error {
+	filters := `{"type":["network"],"event":["create","destroy","remove"]}`
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"/events?filters="+url.QueryEscape(filters), nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.stream.Do(req)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	if reconnect {
+		notify()
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event struct {
+			Action string `json:"Action"`
+		}
+		if err := decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("stream closed")
+			}
+			return err
+		}
+		notify()
+	}
+}
@@ -0,0 +1,123 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+const testDockerNetworks = `[
+	{"Name":"bridge","Labels":{},"IPAM":{"Config":[{"Subnet":"172.17.0.0/16","Gateway":"172.17.0.1"}]}},
+	{"Name":"backend","Labels":{},"IPAM":{"Config":[{"Subnet":"172.20.0.0/16"},{"Subnet":"fd00:20::/64"}]}},
+	{"Name":"monitoring","Labels":{"traefik.whitelist":"true"},"IPAM":{"Config":[{"Subnet":"172.21.0.0/16"}]}},
+	{"Name":"host","Labels":null,"IPAM":{"Config":[]}}
+]`
+
+func TestDockerSource(t *testing.T) {
+	var recreated int32
+	events := make(chan struct{})
+
+	socket := startUnixHTTPServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/networks":
+			if atomic.LoadInt32(&recreated) == 1 {
+				_, _ = w.Write([]byte(`[{"Name":"backend","IPAM":{"Config":[{"Subnet":"172.30.0.0/16"}]}}]`))
+				return
+			}
+			_, _ = w.Write([]byte(testDockerNetworks))
+		case "/events":
+			var filters map[string][]string
+			if err := json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters); err != nil || filters["type"][0] != "network" {
+				t.Errorf("unexpected event filters %q", r.URL.Query().Get("filters"))
+			}
+			w.(http.Flusher).Flush()
+			select {
+			case <-events:
+				_, _ = w.Write([]byte(`{"Type":"network","Action":"create","Actor":{"Attributes":{"name":"backend"}}}` + "\n"))
+				w.(http.Flusher).Flush()
+			case <-r.Context().Done():
+				return
+			}
+			<-r.Context().Done()
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+
+	cfg := baseConfig("")
+	cfg.PollInterval = "1h"
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "docker",
+		Docker: &traefikdynamicpublicwhitelist.DockerSourceConfig{
+			Endpoint: "unix://" + socket,
+			Networks: []string{"backend"},
+			Labels:   []string{"traefik.whitelist=true"},
+		},
+	}}
+
+	provider := newProvider(t, cfg)
+	cfgChan := make(chan json.Marshaler, 1)
+	if err := provider.Provide(cfgChan); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := nextSourceRange(t, cfgChan); got != "172.20.0.0/16,172.21.0.0/16" {
+		t.Fatalf("unexpected initial source ranges: %s", got)
+	}
+
+	// recreating the network changes its subnet and emits an event
+	atomic.StoreInt32(&recreated, 1)
+	close(events)
+
+	if got := nextSourceRange(t, cfgChan); got != "172.30.0.0/16" {
+		t.Fatalf("unexpected refreshed source ranges: %s", got)
+	}
+}
+
+func TestDockerSourceValidation(t *testing.T) {
+	for name, settings := range map[string]*traefikdynamicpublicwhitelist.DockerSourceConfig{
+		"missing selection":  nil,
+		"empty selection":    {Endpoint: "unix:///var/run/docker.sock"},
+		"invalid label":      {Labels: []string{"=value"}},
+		"unsupported scheme": {Endpoint: "npipe:////./pipe/docker_engine", Networks: []string{"backend"}},
+	} {
+		cfg := baseConfig("")
+		cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "docker", Docker: settings}}
+		if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
+
+// startUnixHTTPServer serves handler on a unix socket and returns the socket path.
+func startUnixHTTPServer(t *testing.T, handler http.Handler) string {
+	t.Helper()
+
+	// unix socket paths are limited to ~100 bytes, t.TempDir can be longer
+	dir, err := os.MkdirTemp("", "sock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+
+	socket := filepath.Join(dir, "api.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewUnstartedServer(handler)
+	srv.Listener = listener
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	return socket
+}
@@ -0,0 +1,285 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sourceTypeEC2 = "ec2"
+
+	ec2ResourceAddresses   = "addresses"
+	ec2ResourceNatGateways = "nat-gateways"
+
+	ec2APIVersion = "2016-11-15"
+	ec2Timeout    = 10 * time.Second
+	// ec2MaxPages stops a misbehaving endpoint from paging forever.
+	ec2MaxPages = 100
+)
+
+// EC2SourceConfig selects the Elastic IPs and NAT gateway addresses read from EC2.
+type EC2SourceConfig struct {
+	// Regions are queried one after the other, default to AWS_REGION, then us-east-1.
+	Regions []string `json:"regions,omitempty"`
+	// Resources are "addresses" (Elastic IPs) and/or "nat-gateways", default both.
+	Resources []string `json:"resources,omitempty"`
+	// Tags are "key=value" or "key"; a resource must carry all of them.
+	Tags []string `json:"tags,omitempty"`
+
+	// Static credentials, default to AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY/AWS_SESSION_TOKEN.
+	AccessKeyID     string `json:"accessKeyID,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+	// Web identity credentials, default to AWS_ROLE_ARN/AWS_WEB_IDENTITY_TOKEN_FILE (IRSA).
+	RoleARN              string `json:"roleARN,omitempty"`
+	WebIdentityTokenFile string `json:"webIdentityTokenFile,omitempty"`
+	STSEndpoint          string `json:"stsEndpoint,omitempty"`
+}
+
+type ec2Tag struct {
+	Key   string `xml:"key"`
+	Value string `xml:"value"`
+}
+
+type describeAddressesResponse struct {
+	Addresses []struct {
+		PublicIP     string   `xml:"publicIp"`
+		AllocationID string   `xml:"allocationId"`
+		Tags         []ec2Tag `xml:"tagSet>item"`
+	} `xml:"addressesSet>item"`
+}
+
+type describeNatGatewaysResponse struct {
+	NatGateways []struct {
+		ID        string `xml:"natGatewayId"`
+		Addresses []struct {
+			PublicIP string `xml:"publicIp"`
+		} `xml:"natGatewayAddressSet>item"`
+		Tags []ec2Tag `xml:"tagSet>item"`
+	} `xml:"natGatewaySet>item"`
+	NextToken string `xml:"nextToken"`
+}
+
+// ec2Source calls DescribeAddresses and DescribeNatGateways in every region and emits the
+// public IPs, labelled with the Name tag or the resource ID.
+type ec2Source struct {
+	endpoint    string
+	regions     []string
+	resources   []string
+	filters     url.Values
+	tagFilters  int
+	credentials *awsCredentialProvider
+	client      *http.Client
+}
+
+func newEC2Source(config SourceConfig) (rangeSource, error) {
+	settings := config.EC2
+	if settings == nil {
+		settings = &EC2SourceConfig{}
+	}
+
+	source := &ec2Source{
+		endpoint: strings.TrimSuffix(strings.TrimSpace(config.URL), "/"),
+		filters:  url.Values{},
+		client:   &http.Client{Timeout: ec2Timeout},
+	}
+
+	for _, region := range settings.Regions {
+		if region = strings.TrimSpace(region); region != "" {
+			source.regions = append(source.regions, region)
+		}
+	}
+	if len(source.regions) == 0 {
+		region := os.Getenv("AWS_REGION")
+		if region == "" {
+			region = defaultAWSRegion
+		}
+		source.regions = []string{region}
+	}
+
+	resources := settings.Resources
+	if len(resources) == 0 {
+		resources = []string{ec2ResourceAddresses, ec2ResourceNatGateways}
+	}
+	for _, resource := range resources {
+		resource = strings.ToLower(strings.TrimSpace(resource))
+		if resource != ec2ResourceAddresses && resource != ec2ResourceNatGateways {
+			return nil, fmt.Errorf("ec2.resources: unsupported resource %q", resource)
+		}
+		source.resources = append(source.resources, resource)
+	}
+
+	for _, tag := range settings.Tags {
+		key, value, hasValue := strings.Cut(strings.TrimSpace(tag), "=")
+		if key == "" {
+			return nil, fmt.Errorf("ec2.tags: invalid tag %q", tag)
+		}
+		prefix := "Filter." + strconv.Itoa(source.tagFilters+1)
+		if hasValue {
+			source.filters.Set(prefix+".Name", "tag:"+key)
+			source.filters.Set(prefix+".Value.1", value)
+		} else {
+			source.filters.Set(prefix+".Name", "tag-key")
+			source.filters.Set(prefix+".Value.1", key)
+		}
+		source.tagFilters++
+	}
+
+	credentials, err := newAWSCredentialProvider(awsAuthSettings{
+		accessKeyID:          settings.AccessKeyID,
+		secretAccessKey:      settings.SecretAccessKey,
+		sessionToken:         settings.SessionToken,
+		roleARN:              settings.RoleARN,
+		webIdentityTokenFile: settings.WebIdentityTokenFile,
+		stsEndpoint:          settings.STSEndpoint,
+		region:               source.regions[0],
+	}, source.client)
+	if err != nil {
+		return nil, fmt.Errorf("ec2: %w", err)
+	}
+	source.credentials = credentials
+
+	return source, nil
+}
+
+func (s *ec2Source) fetch(ctx context.Context) ([]labeledRange, error) {
+	ranges := make([]labeledRange, 0)
+	for _, region := range s.regions {
+		for _, resource := range s.resources {
+			var (
+				found []labeledRange
+				err   error
+			)
+			if resource == ec2ResourceAddresses {
+				found, err = s.addresses(ctx, region)
+			} else {
+				found, err = s.natGateways(ctx, region)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("ec2 %s: %w", region, err)
+			}
+			ranges = append(ranges, found...)
+		}
+	}
+
+	return ranges, nil
+}
+
+func (s *ec2Source) addresses(ctx context.Context, region string) ([]labeledRange, error) {
+	var response describeAddressesResponse
+	if err := s.call(ctx, region, "DescribeAddresses", url.Values{}, &response); err != nil {
+		return nil, err
+	}
+
+	ranges := make([]labeledRange, 0, len(response.Addresses))
+	for _, address := range response.Addresses {
+		if address.PublicIP != "" {
+			ranges = append(ranges, labeledRange{CIDR: address.PublicIP, Label: ec2Label(address.Tags, address.AllocationID)})
+		}
+	}
+
+	return ranges, nil
+}
+
+func (s *ec2Source) natGateways(ctx context.Context, region string) ([]labeledRange, error) {
+	// deleted and failed gateways keep their address set for a while
+	prefix := "Filter." + strconv.Itoa(s.tagFilters+1)
+	params := url.Values{}
+	params.Set(prefix+".Name", "state")
+	params.Set(prefix+".Value.1", "pending")
+	params.Set(prefix+".Value.2", "available")
+
+	ranges := make([]labeledRange, 0)
+	for pages := 0; ; pages++ {
+		if pages == ec2MaxPages {
+			return nil, fmt.Errorf("DescribeNatGateways: more than %d pages", ec2MaxPages)
+		}
+
+		var response describeNatGatewaysResponse
+		if err := s.call(ctx, region, "DescribeNatGateways", params, &response); err != nil {
+			return nil, err
+		}
+
+		for _, gateway := range response.NatGateways {
+			label := ec2Label(gateway.Tags, gateway.ID)
+			for _, address := range gateway.Addresses {
+				if address.PublicIP != "" {
+					ranges = append(ranges, labeledRange{CIDR: address.PublicIP, Label: label})
+				}
+			}
+		}
+
+		if response.NextToken == "" {
+			return ranges, nil
+		}
+		params.Set("NextToken", response.NextToken)
+	}
+}
+
+// call sends a signed query API request and decodes the XML response into target.
+func (s *ec2Source) call(ctx context.Context, region, action string, params url.Values, target interface{}) error {
+	form := url.Values{}
+	for name, values := range s.filters {
+		form[name] = values
+	}
+	for name, values := range params {
+		form[name] = values
+	}
+	form.Set("Action", action)
+	form.Set("Version", ec2APIVersion)
+	body := form.Encode()
+
+	endpoint := s.endpoint
+	if endpoint == "" {
+		endpoint = "https://ec2." + region + ".amazonaws.com"
+	}
+
+	credentials, err := s.credentials.retrieve(ctx)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/", strings.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	signAWSRequest(req, credentials, region, "ec2", sha256Hex([]byte(body)), time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer closeBody(resp.Body)
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", action, awsErrorMessage(resp.StatusCode, data))
+	}
+	if err := xml.Unmarshal(data, target); err != nil {
+		return fmt.Errorf("%s: %w", action, err)
+	}
+
+	return nil
+}
+
+func ec2Label(tags []ec2Tag, id string) string {
+	for _, tag := range tags {
+		if tag.Key == "Name" && tag.Value != "" {
+			return tag.Value
+		}
+	}
+
+	return id
+}
@@ -0,0 +1,151 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+// fakeEC2 answers the query API for two regions, the region is taken from the signature scope.
+func fakeEC2(t *testing.T, secret string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		hash := sha256.Sum256(body)
+		if got := r.Header.Get("X-Amz-Content-Sha256"); got != hex.EncodeToString(hash[:]) {
+			t.Errorf("payload hash %q does not match the body", got)
+		}
+
+		_, scope, _ := strings.Cut(r.Header.Get("Authorization"), "Credential=AKIDEXAMPLE/")
+		parts := strings.Split(scope, "/")
+		if len(parts) < 2 || !verifySigV4(t, r, "AKIDEXAMPLE", secret, parts[1], "ec2") {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<Response><Errors><Error><Code>AuthFailure</Code><Message>AWS was not able to validate the provided access credentials</Message></Error></Errors><RequestID>1</RequestID></Response>`))
+			return
+		}
+		region := parts[1]
+
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			t.Error(err)
+		}
+		if form.Get("Version") != "2016-11-15" || form.Get("Filter.1.Name") != "tag:Env" || form.Get("Filter.1.Value.1") != "prod" ||
+			form.Get("Filter.2.Name") != "tag-key" || form.Get("Filter.2.Value.1") != "egress" {
+			t.Errorf("unexpected request %v", form)
+		}
+
+		switch form.Get("Action") + " " + region + " " + form.Get("NextToken") {
+		case "DescribeAddresses eu-central-1 ":
+			_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?>
+<DescribeAddressesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+  <requestId>1</requestId>
+  <addressesSet>
+    <item><publicIp>203.0.113.20</publicIp><allocationId>eipalloc-1</allocationId><domain>vpc</domain>
+      <tagSet><item><key>Env</key><value>prod</value></item><item><key>Name</key><value>bastion</value></item></tagSet></item>
+    <item><publicIp>203.0.113.21</publicIp><allocationId>eipalloc-2</allocationId><domain>vpc</domain></item>
+  </addressesSet>
+</DescribeAddressesResponse>`))
+		case "DescribeAddresses us-west-2 ":
+			_, _ = w.Write([]byte(`<DescribeAddressesResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><addressesSet/></DescribeAddressesResponse>`))
+		case "DescribeNatGateways eu-central-1 ", "DescribeNatGateways us-west-2 ", "DescribeNatGateways us-west-2 page-2":
+			if form.Get("Filter.3.Name") != "state" || form.Get("Filter.3.Value.2") != "available" {
+				t.Errorf("nat gateways requested without state filter: %v", form)
+			}
+			if region == "eu-central-1" {
+				_, _ = w.Write([]byte(`<DescribeNatGatewaysResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/"><natGatewaySet/></DescribeNatGatewaysResponse>`))
+				return
+			}
+			ip, next := "198.51.100.30", "<nextToken>page-2</nextToken>"
+			if form.Get("NextToken") == "page-2" {
+				ip, next = "198.51.100.31", ""
+			}
+			_, _ = w.Write([]byte(`<DescribeNatGatewaysResponse xmlns="http://ec2.amazonaws.com/doc/2016-11-15/">
+  <natGatewaySet>
+    <item><natGatewayId>nat-` + ip + `</natGatewayId><state>available</state>
+      <natGatewayAddressSet><item><allocationId>eipalloc-9</allocationId><privateIp>10.0.0.9</privateIp><publicIp>` + ip + `</publicIp></item></natGatewayAddressSet>
+    </item>
+  </natGatewaySet>` + next + `
+</DescribeNatGatewaysResponse>`))
+		default:
+			t.Errorf("unexpected action %s in %s", form.Get("Action"), region)
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestEC2SourceRegionsAndTags(t *testing.T) {
+	clearAWSEnvironment(t)
+	server := fakeEC2(t, "correct")
+
+	cfg := baseConfig("")
+	cfg.ConfigurationTemplate = `{"http":{"middlewares":{"public_ipwhitelist":{"ipWhiteList":{"sourceRange":{{json .SourceRange}}}},"labels":{"headers":{"customRequestHeaders":{{json .Labels}}}}}}}`
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "ec2",
+		URL:  server.URL,
+		EC2: &traefikdynamicpublicwhitelist.EC2SourceConfig{
+			Regions:         []string{"eu-central-1", "us-west-2"},
+			Tags:            []string{"Env=prod", "egress"},
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "correct",
+		},
+	}}
+
+	configuration, err := newProvider(t, cfg).GenerateConfiguration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ","); got != "203.0.113.20,203.0.113.21,198.51.100.30,198.51.100.31" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+	labels := configuration.HTTP.Middlewares["labels"].Headers.CustomRequestHeaders
+	if labels["203.0.113.20"] != "bastion" || labels["203.0.113.21"] != "eipalloc-2" || labels["198.51.100.31"] != "nat-198.51.100.31" {
+		t.Fatalf("unexpected labels %v", labels)
+	}
+}
+
+func TestEC2SourceErrors(t *testing.T) {
+	clearAWSEnvironment(t)
+	server := fakeEC2(t, "correct")
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "ec2",
+		URL:  server.URL,
+		EC2: &traefikdynamicpublicwhitelist.EC2SourceConfig{
+			Tags:            []string{"Env=prod", "egress"},
+			Resources:       []string{"addresses"},
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "rotated",
+		},
+	}}
+	if _, err := newProvider(t, cfg).GenerateConfiguration(context.Background()); err == nil || !strings.Contains(err.Error(), "AuthFailure") {
+		t.Fatalf("expected authentication error, got %v", err)
+	}
+
+	for name, source := range map[string]traefikdynamicpublicwhitelist.SourceConfig{
+		"missing credentials": {Type: "ec2"},
+		"unknown resource":    {Type: "ec2", EC2: &traefikdynamicpublicwhitelist.EC2SourceConfig{Resources: []string{"instances"}, AccessKeyID: "a", SecretAccessKey: "b"}},
+		"empty tag":           {Type: "ec2", EC2: &traefikdynamicpublicwhitelist.EC2SourceConfig{Tags: []string{"=prod"}, AccessKeyID: "a", SecretAccessKey: "b"}},
+	} {
+		cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{source}
+		if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
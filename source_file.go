@@ -0,0 +1,269 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sourceTypeFile = "file"
+
+	formatText = "text"
+	formatCSV  = "csv"
+	formatJSON = "json"
+	formatYAML = "yaml"
+)
+
+// documentParser turns fetched content into ranges according to a source format.
+type documentParser struct {
+	format string
+	text   *textParser
+	ipv4   *jsonSelector
+	ipv6   *jsonSelector
+}
+
+// newDocumentParser builds the parser for format, detected from path when empty.
+// JSON and YAML documents use the json selectors and default to a top-level list of ranges.
+func newDocumentParser(config SourceConfig, env sourceEnv, path string) (*documentParser, error) {
+	format := strings.ToLower(strings.TrimSpace(config.Format))
+	if format == "" {
+		format = formatFromPath(path)
+	}
+	if format == "yml" {
+		format = formatYAML
+	}
+
+	parser := &documentParser{format: format}
+
+	switch format {
+	case formatText, formatCSV:
+		text, err := newTextParser(config.Text, format == formatCSV)
+		if err != nil {
+			return nil, err
+		}
+		parser.text = text
+	case formatJSON, formatYAML:
+		if config.JSON == nil || (strings.TrimSpace(config.JSON.IPv4) == "" && strings.TrimSpace(config.JSON.IPv6) == "") {
+			parser.ipv4 = &jsonSelector{}
+			break
+		}
+		ipv4, ipv6, err := parseJSONSelectors(config.JSON)
+		if err != nil {
+			return nil, err
+		}
+		if !env.whitelistIPv6 {
+			ipv6 = nil
+		}
+		parser.ipv4, parser.ipv6 = ipv4, ipv6
+	default:
+		return nil, fmt.Errorf("unsupported format %q", config.Format)
+	}
+
+	return parser, nil
+}
+
+func formatFromPath(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return formatJSON
+	case ".yaml", ".yml":
+		return formatYAML
+	case ".csv":
+		return formatCSV
+	default:
+		return formatText
+	}
+}
+
+func (d *documentParser) parse(data []byte) ([]labeledRange, error) {
+	var document interface{}
+
+	switch d.format {
+	case formatJSON:
+		if err := json.Unmarshal(bytes.TrimPrefix(data, []byte("\ufeff")), &document); err != nil {
+			return nil, fmt.Errorf("json: %w", err)
+		}
+	case formatYAML:
+		var err error
+		if document, err = parseYAML(data); err != nil {
+			return nil, err
+		}
+	default:
+		return d.text.parse(data)
+	}
+
+	return unlabeled(selectRanges(document, d.ipv4, d.ipv6)), nil
+}
+
+// fileState identifies a version of a file: mtime and size are checked first, the hash settles touches.
+type fileState struct {
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+}
+
+func (s fileState) sameStat(info os.FileInfo) bool {
+	return s.modTime.Equal(info.ModTime()) && s.size == info.Size()
+}
+
+type fileSource struct {
+	path          string
+	parser        *documentParser
+	watchInterval time.Duration
+
+	mu       sync.Mutex
+	loaded   bool
+	current  fileState
+	ranges   []labeledRange
+	observed fileState
+}
+
+func newFileSource(config SourceConfig, env sourceEnv) (rangeSource, error) {
+	path := strings.TrimSpace(config.Path)
+	if path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+
+	parser, err := newDocumentParser(config, env, path)
+	if err != nil {
+		return nil, err
+	}
+
+	watchInterval, err := parseWatchInterval(config.WatchInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileSource{path: path, parser: parser, watchInterval: watchInterval}, nil
+}
+
+func parseWatchInterval(raw string) (time.Duration, error) {
+	if strings.TrimSpace(raw) == "" {
+		return 0, nil
+	}
+
+	interval, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("watchInterval: %w", err)
+	}
+	if interval <= 0 {
+		return 0, fmt.Errorf("watchInterval must be greater than 0")
+	}
+
+	return interval, nil
+}
+
+// fetch re-parses the file only when its mtime, size or content hash changed since the last read.
+func (s *fileSource) fetch(_ context.Context) ([]labeledRange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if s.loaded && s.current.sameStat(info) {
+		return s.ranges, nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	state := fileState{modTime: info.ModTime(), size: info.Size(), hash: sha256.Sum256(data)}
+	if s.loaded && state.hash == s.current.hash {
+		s.current = state
+		return s.ranges, nil
+	}
+
+	ranges, err := s.parser.parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	s.loaded = true
+	s.current = state
+	s.observed = state
+	s.ranges = ranges
+
+	return ranges, nil
+}
+
+// watch polls the file every watchInterval and notifies once per detected change.
+func (s *fileSource) watch(ctx context.Context, notify func()) {
+	if s.watchInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if s.changed() {
+				notify()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *fileSource) changed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil || s.observed.sameStat(info) {
+		return false
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return false
+	}
+
+	s.observed = fileState{modTime: info.ModTime(), size: info.Size(), hash: sha256.Sum256(data)}
+
+	return !s.loaded || s.observed.hash != s.current.hash
+}
+
+// pollFile notifies whenever the mtime or size of path changes, checking every interval.
+// It suits large files where hashing on every check would be too expensive.
+func pollFile(ctx context.Context, path string, interval time.Duration, notify func()) {
+	if interval <= 0 {
+		return
+	}
+
+	var observed fileState
+	if info, err := os.Stat(path); err == nil {
+		observed = fileState{modTime: info.ModTime(), size: info.Size()}
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			info, err := os.Stat(path)
+			if err != nil || observed.sameStat(info) {
+				continue
+			}
+			observed = fileState{modTime: info.ModTime(), size: info.Size()}
+			notify()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
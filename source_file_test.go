@@ -0,0 +1,128 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+func TestFileSourceFormats(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "office.txt"), "# offices\n198.51.100.0/24 ; hq\n")
+	writeFile(t, filepath.Join(dir, "vpn.json"), `["192.0.2.0/24", "2001:db8::/32"]`)
+	writeFile(t, filepath.Join(dir, "partners.yaml"), `# managed by config management
+partners:
+  - name: "acme"   # primary
+    ranges: [203.0.113.0/25, '203.0.113.128/25']
+  - name: globex
+    ranges:
+      - 100.64.0.0/24
+    enabled: false
+`)
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{
+		{Type: "file", Name: "office", Path: filepath.Join(dir, "office.txt")},
+		{Type: "file", Name: "vpn", Path: filepath.Join(dir, "vpn.json")},
+		{
+			Type: "file",
+			Name: "partners",
+			Path: filepath.Join(dir, "partners.yaml"),
+			JSON: &traefikdynamicpublicwhitelist.JSONSourceConfig{IPv4: `partners[?enabled!=false].ranges`},
+		},
+	}
+
+	configuration := loadOnce(t, cfg)
+
+	got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ",")
+	if got != "198.51.100.0/24,192.0.2.0/24,203.0.113.0/25,203.0.113.128/25" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+}
+
+func TestFileSourceWatchTriggersRefresh(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ranges.txt")
+	writeFile(t, path, "198.51.100.0/24\n")
+
+	cfg := baseConfig("")
+	cfg.PollInterval = "1h"
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "file", Path: path, WatchInterval: "20ms"}}
+
+	provider := newProvider(t, cfg)
+	cfgChan := make(chan json.Marshaler, 1)
+	if err := provider.Provide(cfgChan); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := nextSourceRange(t, cfgChan); got != "198.51.100.0/24" {
+		t.Fatalf("unexpected initial source ranges: %s", got)
+	}
+
+	writeFile(t, path, "198.51.100.0/24\n203.0.113.0/24\n")
+
+	if got := nextSourceRange(t, cfgChan); got != "198.51.100.0/24,203.0.113.0/24" {
+		t.Fatalf("unexpected refreshed source ranges: %s", got)
+	}
+}
+
+func TestFileSourceValidation(t *testing.T) {
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "file"}}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error without path")
+	}
+
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "file", Path: "ranges.txt", Format: "toml"}}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error for unsupported format")
+	}
+
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "file", Path: "ranges.txt", WatchInterval: "soon"}}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error for invalid watchInterval")
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func nextSourceRange(t *testing.T, cfgChan <-chan json.Marshaler) string {
+	t.Helper()
+
+	var data json.Marshaler
+	select {
+	case data = <-cfgChan:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for configuration")
+	}
+
+	raw, err := json.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var document struct {
+		HTTP struct {
+			Middlewares map[string]struct {
+				IPWhiteList struct {
+					SourceRange []string `json:"sourceRange"`
+				} `json:"ipWhiteList"`
+			} `json:"middlewares"`
+		} `json:"http"`
+	}
+	if err := json.Unmarshal(raw, &document); err != nil {
+		t.Fatal(err)
+	}
+
+	return strings.Join(document.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ",")
+}
@@ -0,0 +1,232 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sourceTypeGeofeed = "geofeed"
+
+// GeofeedSourceConfig filters the rows of an RFC 8805 geofeed. Filters are case-insensitive;
+// a row must match every configured filter and any value within one filter.
+type GeofeedSourceConfig struct {
+	// Countries are ISO 3166-1 alpha-2 codes.
+	Countries []string `json:"countries,omitempty"`
+	// Regions are ISO 3166-2 codes such as "US-CA".
+	Regions []string `json:"regions,omitempty"`
+	Cities  []string `json:"cities,omitempty"`
+}
+
+// geofeedSource streams a geofeed from a URL or a local file and aggregates the matching
+// prefixes per country, so feeds with hundreds of thousands of rows collapse into a short list.
+// Local feeds are only re-read when their mtime or size changes.
+type geofeedSource struct {
+	name          string
+	url           string
+	path          string
+	countries     map[string]struct{}
+	regions       map[string]struct{}
+	cities        map[string]struct{}
+	whitelistIPv6 bool
+	watchInterval time.Duration
+	httpOpen      httpOpener
+
+	mu     sync.Mutex
+	loaded bool
+	state  fileState
+	ranges []labeledRange
+}
+
+func newGeofeedSource(name string, config SourceConfig, env sourceEnv) (rangeSource, error) {
+	source := &geofeedSource{
+		name:          name,
+		url:           strings.TrimSpace(config.URL),
+		path:          strings.TrimSpace(config.Path),
+		whitelistIPv6: env.whitelistIPv6,
+		httpOpen:      env.httpOpen,
+	}
+
+	if (source.url == "") == (source.path == "") {
+		return nil, fmt.Errorf("exactly one of url or path is required")
+	}
+
+	if config.Geofeed != nil {
+		for _, country := range config.Geofeed.Countries {
+			if len(strings.TrimSpace(country)) != 2 {
+				return nil, fmt.Errorf("geofeed.countries: invalid ISO code %q", country)
+			}
+		}
+		source.countries = geofeedFilter(config.Geofeed.Countries)
+		source.regions = geofeedFilter(config.Geofeed.Regions)
+		source.cities = geofeedFilter(config.Geofeed.Cities)
+	}
+
+	if source.path != "" {
+		watchInterval, err := parseWatchInterval(config.WatchInterval)
+		if err != nil {
+			return nil, err
+		}
+		source.watchInterval = watchInterval
+	} else if strings.TrimSpace(config.WatchInterval) != "" {
+		return nil, fmt.Errorf("watchInterval requires path")
+	}
+
+	return source, nil
+}
+
+func geofeedFilter(values []string) map[string]struct{} {
+	if len(values) == 0 {
+		return nil
+	}
+
+	filter := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		filter[strings.ToUpper(strings.TrimSpace(value))] = struct{}{}
+	}
+
+	return filter
+}
+
+func (s *geofeedSource) fetch(ctx context.Context) ([]labeledRange, error) {
+	if s.url != "" {
+		body, err := s.httpOpen(ctx, s.url)
+		if err != nil {
+			return nil, err
+		}
+		defer closeBody(body)
+
+		return s.parse(body)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if s.loaded && s.state.sameStat(info) {
+		return s.ranges, nil
+	}
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	ranges, err := s.parse(file)
+	if err != nil {
+		return nil, err
+	}
+
+	s.loaded = true
+	s.state = fileState{modTime: info.ModTime(), size: info.Size()}
+	s.ranges = ranges
+
+	return ranges, nil
+}
+
+func (s *geofeedSource) watch(ctx context.Context, notify func()) {
+	if s.path == "" {
+		return
+	}
+
+	pollFile(ctx, s.path, s.watchInterval, notify)
+}
+
+// parse reads the feed row by row; only the aggregated matches are kept in memory.
+// Rows are "ip_prefix,alpha2code,region,city,postal_code" (RFC 8805 section 2.1.1).
+func (s *geofeedSource) parse(body io.Reader) ([]labeledRange, error) {
+	reader := csv.NewReader(bufio.NewReaderSize(body, 64<<10))
+	reader.Comment = '#'
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+	reader.ReuseRecord = true
+
+	aggregator := newRangeAggregator()
+	invalid := 0
+
+	for {
+		record, err := reader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("geofeed: %w", err)
+		}
+
+		field := func(i int) string {
+			if i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		prefix := strings.TrimPrefix(field(0), "\ufeff")
+		if prefix == "" {
+			continue
+		}
+
+		country := strings.ToUpper(field(1))
+		if !geofeedMatches(s.countries, country) ||
+			!geofeedMatches(s.regions, strings.ToUpper(field(2))) ||
+			!geofeedMatches(s.cities, strings.ToUpper(field(3))) {
+			continue
+		}
+
+		network, err := parseGeofeedPrefix(prefix)
+		if err != nil {
+			invalid++
+			continue
+		}
+		if network.IP.To4() == nil && !s.whitelistIPv6 {
+			continue
+		}
+
+		aggregator.add(country, network)
+	}
+
+	if invalid > 0 {
+		log.Printf("traefik_dynamic_public_whitelist: source %s: skipped %d rows with an invalid prefix", s.name, invalid)
+	}
+
+	return aggregator.ranges(), nil
+}
+
+func geofeedMatches(filter map[string]struct{}, value string) bool {
+	if filter == nil {
+		return true
+	}
+	_, ok := filter[value]
+
+	return ok
+}
+
+// parseGeofeedPrefix accepts a CIDR or a single address.
+func parseGeofeedPrefix(prefix string) (*net.IPNet, error) {
+	if _, network, err := net.ParseCIDR(prefix); err == nil {
+		return network, nil
+	}
+
+	ip := net.ParseIP(prefix)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid prefix %q", prefix)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		return &net.IPNet{IP: ip4, Mask: net.CIDRMask(32, 32)}, nil
+	}
+
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+}
@@ -0,0 +1,127 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+const testGeofeed = `# prefix,country,region,city,postal
+192.0.2.0/25,DE,DE-BE,Berlin,
+192.0.2.128/25,de,DE-BE,Berlin,
+198.51.100.0/24,DE,DE-BY,Munich,
+198.51.101.0/24,DE,DE-BY,"Munich",
+198.51.102.0/24,DE,DE-BY,Munich,
+203.0.113.5,FR,FR-IDF,Paris,
+not-a-prefix,DE,DE-BY,Munich,
+2001:db8::/33,DE,DE-BE,Berlin,
+2001:db8:8000::/33,DE,DE-BE,Berlin,
+`
+
+func TestGeofeedSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geofeed.csv")
+	writeFile(t, path, testGeofeed)
+
+	tests := []struct {
+		name    string
+		ipv6    bool
+		geofeed *traefikdynamicpublicwhitelist.GeofeedSourceConfig
+		want    string
+	}{
+		{
+			name:    "country",
+			geofeed: &traefikdynamicpublicwhitelist.GeofeedSourceConfig{Countries: []string{"de"}},
+			want:    "192.0.2.0/24,198.51.100.0/23,198.51.102.0/24",
+		},
+		{
+			name:    "region and city",
+			geofeed: &traefikdynamicpublicwhitelist.GeofeedSourceConfig{Regions: []string{"de-by"}, Cities: []string{"MUNICH", "Hamburg"}},
+			want:    "198.51.100.0/23,198.51.102.0/24",
+		},
+		{
+			name: "whole feed with ipv6",
+			ipv6: true,
+			want: "192.0.2.0/24,198.51.100.0/23,198.51.102.0/24,203.0.113.5/32,2001:db8::/32",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := baseConfig("")
+			cfg.WhitelistIPv6 = tt.ipv6
+			cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "geofeed", Path: path, Geofeed: tt.geofeed}}
+
+			configuration := loadOnce(t, cfg)
+
+			got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ",")
+			if got != tt.want {
+				t.Fatalf("unexpected source ranges: %s", got)
+			}
+		})
+	}
+}
+
+func TestGeofeedSourceIPv4MappedPrefix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "geofeed.csv")
+	writeFile(t, path, "::ffff:192.0.2.0/120,DE,DE-BE,Berlin,\n::ffff:198.51.100.7,DE,DE-BE,Berlin,\n")
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "geofeed", Path: path}}
+
+	// the mapped prefix used to widen to 0.0.0.0/0 and allow every client
+	configuration := loadOnce(t, cfg)
+	if got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ","); got != "192.0.2.0/24,198.51.100.7/32" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+}
+
+func TestGeofeedSourceAggregatesLargeFeedFromURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		// 65536 single addresses plus two halves of the IPv6 space
+		for i := 0; i < 1<<16; i++ {
+			fmt.Fprintf(w, "100.64.%d.%d,US,US-CA,Los Angeles,\n", i>>8, i&0xff)
+		}
+		fmt.Fprint(w, "::/1,US,US-CA,Los Angeles,\n8000::/1,US,US-CA,Los Angeles,\n")
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := baseConfig("")
+	cfg.WhitelistIPv6 = true
+	cfg.ConfigurationTemplate = `{"http":{"middlewares":{"labels":{"headers":{"customRequestHeaders":{{json .Labels}}}}}}}`
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type:    "geofeed",
+		URL:     srv.URL,
+		Geofeed: &traefikdynamicpublicwhitelist.GeofeedSourceConfig{Countries: []string{"US"}},
+	}}
+
+	configuration := loadOnce(t, cfg)
+
+	labels := configuration.HTTP.Middlewares["labels"].Headers.CustomRequestHeaders
+	if len(labels) != 2 || labels["100.64.0.0/16"] != "US" || labels["::/0"] != "US" {
+		t.Fatalf("unexpected aggregated ranges: %v", labels)
+	}
+}
+
+func TestGeofeedSourceValidation(t *testing.T) {
+	for name, source := range map[string]traefikdynamicpublicwhitelist.SourceConfig{
+		"missing location": {Type: "geofeed"},
+		"url and path":     {Type: "geofeed", URL: "https://example.com/geofeed.csv", Path: "geofeed.csv"},
+		"invalid country": {
+			Type:    "geofeed",
+			Path:    "geofeed.csv",
+			Geofeed: &traefikdynamicpublicwhitelist.GeofeedSourceConfig{Countries: []string{"DEU"}},
+		},
+	} {
+		cfg := baseConfig("")
+		cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{source}
+		if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
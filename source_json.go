@@ -0,0 +1,439 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSONSourceConfig selects the ranges of a JSON document.
+//
+// Selectors are JSONPath-like: dotted keys, [n] indexes, * or [*] wildcards,
+// ['quoted.key'] and [?field=="value" && other!=1] filters, e.g. prefixes[?service=="CLOUDFRONT"].ip_prefix.
+type JSONSourceConfig struct {
+	IPv4 string `json:"ipv4,omitempty"`
+	IPv6 string `json:"ipv6,omitempty"`
+}
+
+type jsonSource struct {
+	url     string
+	ipv4    *jsonSelector
+	ipv6    *jsonSelector
+	httpGet httpGetter
+}
+
+func newJSONSource(config SourceConfig, env sourceEnv) (rangeSource, error) {
+	if strings.TrimSpace(config.URL) == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+
+	ipv4, ipv6, err := parseJSONSelectors(config.JSON)
+	if err != nil {
+		return nil, err
+	}
+
+	if !env.whitelistIPv6 {
+		ipv6 = nil
+	}
+
+	return &jsonSource{
+		url:     strings.TrimSpace(config.URL),
+		ipv4:    ipv4,
+		ipv6:    ipv6,
+		httpGet: env.httpGet,
+	}, nil
+}
+
+func parseJSONSelectors(config *JSONSourceConfig) (*jsonSelector, *jsonSelector, error) {
+	if config == nil || (strings.TrimSpace(config.IPv4) == "" && strings.TrimSpace(config.IPv6) == "") {
+		return nil, nil, fmt.Errorf("json.ipv4 or json.ipv6 selector is required")
+	}
+
+	var ipv4, ipv6 *jsonSelector
+	var err error
+
+	if strings.TrimSpace(config.IPv4) != "" {
+		if ipv4, err = parseJSONSelector(config.IPv4); err != nil {
+			return nil, nil, fmt.Errorf("json.ipv4: %w", err)
+		}
+	}
+	if strings.TrimSpace(config.IPv6) != "" {
+		if ipv6, err = parseJSONSelector(config.IPv6); err != nil {
+			return nil, nil, fmt.Errorf("json.ipv6: %w", err)
+		}
+	}
+
+	return ipv4, ipv6, nil
+}
+
+func (s *jsonSource) fetch(ctx context.Context) ([]labeledRange, error) {
+	body, err := s.httpGet(ctx, s.url)
+	if err != nil {
+		return nil, err
+	}
+
+	ranges, err := selectJSONRanges(body, s.ipv4, s.ipv6)
+	if err != nil {
+		return nil, err
+	}
+
+	return unlabeled(ranges), nil
+}
+
+func selectJSONRanges(body []byte, ipv4, ipv6 *jsonSelector) ([]string, error) {
+	var document interface{}
+	if err := json.Unmarshal(body, &document); err != nil {
+		return nil, fmt.Errorf("json: %w", err)
+	}
+
+	return selectRanges(document, ipv4, ipv6), nil
+}
+
+// selectRanges applies the selectors to a decoded JSON or YAML document.
+func selectRanges(document interface{}, ipv4, ipv6 *jsonSelector) []string {
+	ranges := make([]string, 0)
+	for _, selector := range []*jsonSelector{ipv4, ipv6} {
+		if selector == nil {
+			continue
+		}
+		ranges = append(ranges, selector.strings(document)...)
+	}
+
+	return ranges
+}
+
+const (
+	stepKey = iota
+	stepWildcard
+	stepIndex
+	stepFilter
+)
+
+type jsonSelector struct {
+	steps []selectorStep
+}
+
+type selectorStep struct {
+	kind   int
+	key    string
+	index  int
+	filter []filterCondition
+}
+
+type filterCondition struct {
+	path   []string
+	negate bool
+	value  interface{}
+}
+
+func parseJSONSelector(raw string) (*jsonSelector, error) {
+	expr := strings.TrimSpace(raw)
+	expr = strings.TrimPrefix(expr, "$")
+	expr = strings.TrimPrefix(expr, ".")
+
+	selector := &jsonSelector{}
+
+	for len(expr) > 0 {
+		switch expr[0] {
+		case '.':
+			expr = expr[1:]
+		case '[':
+			end := closingBracket(expr)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated [ in %q", raw)
+			}
+			step, err := parseBracketStep(expr[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("%w in %q", err, raw)
+			}
+			selector.steps = append(selector.steps, step)
+			expr = expr[end+1:]
+		default:
+			end := strings.IndexAny(expr, ".[")
+			if end < 0 {
+				end = len(expr)
+			}
+			key := expr[:end]
+			if key == "*" {
+				selector.steps = append(selector.steps, selectorStep{kind: stepWildcard})
+			} else {
+				selector.steps = append(selector.steps, selectorStep{kind: stepKey, key: key})
+			}
+			expr = expr[end:]
+		}
+	}
+
+	if len(selector.steps) == 0 {
+		return nil, fmt.Errorf("empty selector")
+	}
+
+	return selector, nil
+}
+
+// closingBracket returns the index of the ] closing the [ at expr[0], ignoring quoted text.
+func closingBracket(expr string) int {
+	var quote byte
+	for i := 1; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ']':
+			return i
+		}
+	}
+
+	return -1
+}
+
+func parseBracketStep(inner string) (selectorStep, error) {
+	inner = strings.TrimSpace(inner)
+
+	switch {
+	case inner == "*" || inner == "":
+		return selectorStep{kind: stepWildcard}, nil
+	case strings.HasPrefix(inner, "?"):
+		conditions, err := parseFilter(inner[1:])
+		if err != nil {
+			return selectorStep{}, err
+		}
+		return selectorStep{kind: stepFilter, filter: conditions}, nil
+	case inner[0] == '"' || inner[0] == '\'':
+		key, err := unquoteLiteral(inner)
+		if err != nil {
+			return selectorStep{}, err
+		}
+		return selectorStep{kind: stepKey, key: key}, nil
+	default:
+		index, err := strconv.Atoi(inner)
+		if err != nil {
+			return selectorStep{}, fmt.Errorf("invalid index %q", inner)
+		}
+		return selectorStep{kind: stepIndex, index: index}, nil
+	}
+}
+
+func parseFilter(expr string) ([]filterCondition, error) {
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, "(") && strings.HasSuffix(expr, ")") {
+		expr = expr[1 : len(expr)-1]
+	}
+
+	parts := splitOutsideQuotes(expr, "&&")
+	conditions := make([]filterCondition, 0, len(parts))
+
+	for _, part := range parts {
+		part = strings.TrimSpace(part)
+
+		operator := "=="
+		pos := indexOutsideQuotes(part, "==")
+		if neq := indexOutsideQuotes(part, "!="); neq >= 0 && (pos < 0 || neq < pos) {
+			operator = "!="
+			pos = neq
+		}
+		if pos < 0 {
+			return nil, fmt.Errorf("filter %q must use == or !=", part)
+		}
+
+		field := strings.TrimSpace(part[:pos])
+		field = strings.TrimPrefix(field, "@")
+		field = strings.TrimPrefix(field, ".")
+		if field == "" {
+			return nil, fmt.Errorf("filter %q has no field", part)
+		}
+
+		value, err := parseLiteral(strings.TrimSpace(part[pos+len(operator):]))
+		if err != nil {
+			return nil, err
+		}
+
+		conditions = append(conditions, filterCondition{
+			path:   strings.Split(field, "."),
+			negate: operator == "!=",
+			value:  value,
+		})
+	}
+
+	return conditions, nil
+}
+
+func parseLiteral(raw string) (interface{}, error) {
+	if raw == "" {
+		return nil, fmt.Errorf("filter value is required")
+	}
+	if raw[0] == '"' || raw[0] == '\'' {
+		return unquoteLiteral(raw)
+	}
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(raw), &value); err != nil {
+		return nil, fmt.Errorf("invalid filter value %q", raw)
+	}
+
+	// objects and arrays are not comparable, == on them would panic while matching
+	switch value.(type) {
+	case map[string]interface{}, []interface{}:
+		return nil, fmt.Errorf("filter value %q must be a string, number, boolean or null", raw)
+	}
+
+	return value, nil
+}
+
+func unquoteLiteral(raw string) (string, error) {
+	if len(raw) < 2 || raw[len(raw)-1] != raw[0] {
+		return "", fmt.Errorf("unterminated string %s", raw)
+	}
+	if raw[0] == '\'' {
+		return strings.ReplaceAll(raw[1:len(raw)-1], `\'`, `'`), nil
+	}
+
+	return strconv.Unquote(raw)
+}
+
+func splitOutsideQuotes(expr, sep string) []string {
+	parts := make([]string, 0, 1)
+	for {
+		pos := indexOutsideQuotes(expr, sep)
+		if pos < 0 {
+			return append(parts, expr)
+		}
+		parts = append(parts, expr[:pos])
+		expr = expr[pos+len(sep):]
+	}
+}
+
+func indexOutsideQuotes(expr, needle string) int {
+	var quote byte
+	for i := 0; i < len(expr); i++ {
+		c := expr[i]
+		switch {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case strings.HasPrefix(expr[i:], needle):
+			return i
+		}
+	}
+
+	return -1
+}
+
+// strings evaluates the selector and flattens the matched strings.
+func (s *jsonSelector) strings(document interface{}) []string {
+	nodes := []interface{}{document}
+	for _, step := range s.steps {
+		nodes = step.apply(nodes)
+	}
+
+	values := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		switch v := node.(type) {
+		case string:
+			values = append(values, v)
+		case []interface{}:
+			for _, item := range v {
+				if str, ok := item.(string); ok {
+					values = append(values, str)
+				}
+			}
+		}
+	}
+
+	return values
+}
+
+func (s selectorStep) apply(nodes []interface{}) []interface{} {
+	next := make([]interface{}, 0, len(nodes))
+
+	for _, node := range nodes {
+		switch s.kind {
+		case stepKey:
+			if object, ok := node.(map[string]interface{}); ok {
+				if value, ok := object[s.key]; ok {
+					next = append(next, value)
+				}
+			}
+		case stepIndex:
+			if array, ok := node.([]interface{}); ok {
+				index := s.index
+				if index < 0 {
+					index += len(array)
+				}
+				if index >= 0 && index < len(array) {
+					next = append(next, array[index])
+				}
+			}
+		case stepWildcard, stepFilter:
+			for _, child := range children(node) {
+				if s.kind == stepFilter && !matchesFilter(child, s.filter) {
+					continue
+				}
+				next = append(next, child)
+			}
+		}
+	}
+
+	return next
+}
+
+func children(node interface{}) []interface{} {
+	switch v := node.(type) {
+	case []interface{}:
+		return v
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		values := make([]interface{}, 0, len(v))
+		for _, key := range keys {
+			values = append(values, v[key])
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+func matchesFilter(node interface{}, conditions []filterCondition) bool {
+	for _, condition := range conditions {
+		value, found := lookupPath(node, condition.path)
+		equal := found && value == condition.value
+		if equal == condition.negate {
+			return false
+		}
+	}
+
+	return true
+}
+
+func lookupPath(node interface{}, path []string) (interface{}, bool) {
+	current := node
+	for _, key := range path {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if current, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+
+	return current, true
+}
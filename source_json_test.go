@@ -0,0 +1,105 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+func TestJSONSource(t *testing.T) {
+	payload := `{
+		"prefixes": [
+			{"ip_prefix": "198.51.100.0/24", "service": "EC2", "region": "eu-west-1"},
+			{"ip_prefix": "203.0.113.0/24", "service": "ROUTE53_HEALTHCHECKS", "region": "eu-west-1"},
+			{"ip_prefix": "192.0.2.0/24", "service": "ROUTE53_HEALTHCHECKS", "region": "us-east-1"}
+		],
+		"ipv6_prefixes": [
+			{"ipv6_prefix": "2001:db8::/32", "service": "ROUTE53_HEALTHCHECKS"}
+		]
+	}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assertHeader(t, r, "X-Kes-RequestID")
+		_, _ = w.Write([]byte(payload))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := baseConfig("")
+	cfg.WhitelistIPv6 = true
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "json",
+		Name: "healthchecks",
+		URL:  srv.URL,
+		JSON: &traefikdynamicpublicwhitelist.JSONSourceConfig{
+			IPv4: `prefixes[?service=="ROUTE53_HEALTHCHECKS" && region!='us-east-1'].ip_prefix`,
+			IPv6: `$.ipv6_prefixes[*].ipv6_prefix`,
+		},
+	}}
+
+	configuration := loadOnce(t, cfg)
+
+	got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ",")
+	if got != "203.0.113.0/24,2001:db8::/32" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+}
+
+func TestJSONSourceIndexesAndWildcards(t *testing.T) {
+	payload := `{"regions": {"eu": {"cidrs": ["198.51.100.0/24", "not-a-cidr"]}, "us": {"cidrs": ["192.0.2.0/24", "2001:db8::/32"]}}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(payload))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := baseConfig("")
+	cfg.AdditionalSourceRange = []string{"10.0.0.0/8"}
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "json",
+		URL:  srv.URL,
+		JSON: &traefikdynamicpublicwhitelist.JSONSourceConfig{IPv4: "regions.*.cidrs"},
+	}}
+
+	configuration := loadOnce(t, cfg)
+
+	got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ",")
+	if got != "10.0.0.0/8,198.51.100.0/24,192.0.2.0/24" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+}
+
+func TestJSONSourceValidation(t *testing.T) {
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "json",
+		URL:  "http://127.0.0.1/ranges.json",
+		JSON: &traefikdynamicpublicwhitelist.JSONSourceConfig{IPv4: `prefixes[?service=="X"`},
+	}}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error for unterminated selector")
+	}
+
+	// comparing an object or array field with == panicked while matching valid documents
+	for _, selector := range []string{`prefixes[?meta=={}].ip_prefix`, `prefixes[?tags!=["edge"]].ip_prefix`} {
+		cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+			Type: "json",
+			URL:  "http://127.0.0.1/ranges.json",
+			JSON: &traefikdynamicpublicwhitelist.JSONSourceConfig{IPv4: selector},
+		}}
+		if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+			t.Fatalf("expected error for composite filter value in %s", selector)
+		}
+	}
+
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "json", URL: "http://127.0.0.1/ranges.json"}}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error without selectors")
+	}
+
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "unknown"}}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error for unsupported source type")
+	}
+}
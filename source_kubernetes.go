@@ -0,0 +1,214 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	sourceTypeKubernetes = "kubernetes"
+
+	kubeResourceNodes      = "nodes"
+	kubeResourceServices   = "services"
+	kubeResourceConfigMaps = "configmaps"
+)
+
+// KubernetesSourceConfig selects the cluster objects whose addresses are allowed.
+type KubernetesSourceConfig struct {
+	// Kubeconfig is the path of a kubeconfig file, the pod's service account is used when empty.
+	Kubeconfig string `json:"kubeconfig,omitempty"`
+	// Context overrides the kubeconfig current-context.
+	Context string `json:"context,omitempty"`
+	// Namespace limits services and ConfigMaps, defaults to all namespaces.
+	Namespace string `json:"namespace,omitempty"`
+	// Resources lists what to read: "nodes" (ExternalIP addresses), "services" (LoadBalancer
+	// ingress IPs) and "configmaps". Defaults to nodes and services, plus configmaps when
+	// ConfigMapSelector is set.
+	Resources []string `json:"resources,omitempty"`
+	// LabelSelector filters nodes and services.
+	LabelSelector string `json:"labelSelector,omitempty"`
+	// ConfigMapSelector selects the ConfigMaps whose data values list ranges.
+	ConfigMapSelector string `json:"configMapSelector,omitempty"`
+}
+
+type kubeObjectMeta struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace"`
+}
+
+type kubeNode struct {
+	Metadata kubeObjectMeta `json:"metadata"`
+	Status   struct {
+		Addresses []struct {
+			Type    string `json:"type"`
+			Address string `json:"address"`
+		} `json:"addresses"`
+	} `json:"status"`
+}
+
+type kubeService struct {
+	Metadata kubeObjectMeta `json:"metadata"`
+	Status   struct {
+		LoadBalancer struct {
+			Ingress []struct {
+				IP string `json:"ip"`
+			} `json:"ingress"`
+		} `json:"loadBalancer"`
+	} `json:"status"`
+}
+
+type kubeConfigMap struct {
+	Metadata kubeObjectMeta    `json:"metadata"`
+	Data     map[string]string `json:"data"`
+}
+
+// kubernetesSource lists node external IPs, LoadBalancer ingress IPs and ConfigMap ranges.
+// Ranges are labelled with the object they come from, e.g. "node/worker-1".
+type kubernetesSource struct {
+	client            *kubeClient
+	namespace         string
+	nodes             bool
+	services          bool
+	configMaps        bool
+	labelSelector     string
+	configMapSelector string
+}
+
+func newKubernetesSource(config SourceConfig) (rangeSource, error) {
+	settings := config.Kubernetes
+	if settings == nil {
+		settings = &KubernetesSourceConfig{}
+	}
+
+	source := &kubernetesSource{
+		namespace:         strings.TrimSpace(settings.Namespace),
+		labelSelector:     strings.TrimSpace(settings.LabelSelector),
+		configMapSelector: strings.TrimSpace(settings.ConfigMapSelector),
+	}
+
+	resources := settings.Resources
+	if len(resources) == 0 {
+		resources = []string{kubeResourceNodes, kubeResourceServices}
+		if source.configMapSelector != "" {
+			resources = append(resources, kubeResourceConfigMaps)
+		}
+	}
+	for _, resource := range resources {
+		switch strings.ToLower(strings.TrimSpace(resource)) {
+		case kubeResourceNodes:
+			source.nodes = true
+		case kubeResourceServices:
+			source.services = true
+		case kubeResourceConfigMaps:
+			source.configMaps = true
+		default:
+			return nil, fmt.Errorf("kubernetes.resources: unsupported resource %q", resource)
+		}
+	}
+	if source.configMaps && source.configMapSelector == "" {
+		return nil, fmt.Errorf("kubernetes.configMapSelector is required to read configmaps")
+	}
+
+	var err error
+	if kubeconfig := strings.TrimSpace(settings.Kubeconfig); kubeconfig != "" {
+		source.client, err = newKubeconfigClient(kubeconfig, strings.TrimSpace(settings.Context))
+	} else {
+		source.client, err = newInClusterKubeClient()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return source, nil
+}
+
+// allowsEmpty reports that deleted nodes, services and configmaps empty the allowlist.
+func (s *kubernetesSource) allowsEmpty() bool {
+	return true
+}
+
+func (s *kubernetesSource) fetch(ctx context.Context) ([]labeledRange, error) {
+	ranges := make([]labeledRange, 0)
+
+	if s.nodes {
+		err := s.client.list(ctx, "/api/v1/nodes", s.labelSelector, func(item json.RawMessage) error {
+			var node kubeNode
+			if err := json.Unmarshal(item, &node); err != nil {
+				return err
+			}
+			for _, address := range node.Status.Addresses {
+				if address.Type == "ExternalIP" && address.Address != "" {
+					ranges = append(ranges, labeledRange{CIDR: address.Address, Label: "node/" + node.Metadata.Name})
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.services {
+		err := s.client.list(ctx, s.namespacedPath("services"), s.labelSelector, func(item json.RawMessage) error {
+			var service kubeService
+			if err := json.Unmarshal(item, &service); err != nil {
+				return err
+			}
+			// hostname-only ingress entries (e.g. AWS ELB) carry no address
+			for _, ingress := range service.Status.LoadBalancer.Ingress {
+				if ingress.IP != "" {
+					label := "service/" + service.Metadata.Namespace + "/" + service.Metadata.Name
+					ranges = append(ranges, labeledRange{CIDR: ingress.IP, Label: label})
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if s.configMaps {
+		parser := &textParser{comment: defaultCommentPrefix}
+		err := s.client.list(ctx, s.namespacedPath("configmaps"), s.configMapSelector, func(item json.RawMessage) error {
+			var configMap kubeConfigMap
+			if err := json.Unmarshal(item, &configMap); err != nil {
+				return err
+			}
+			label := "configmap/" + configMap.Metadata.Namespace + "/" + configMap.Metadata.Name
+			keys := make([]string, 0, len(configMap.Data))
+			for key := range configMap.Data {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			for _, key := range keys {
+				// without a delimiter or regex the text parser cannot fail
+				entries, _ := parser.parse([]byte(configMap.Data[key]))
+				for _, entry := range entries {
+					if entry.Label == "" {
+						entry.Label = label
+					}
+					ranges = append(ranges, entry)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ranges, nil
+}
+
+func (s *kubernetesSource) namespacedPath(resource string) string {
+	if s.namespace == "" {
+		return "/api/v1/" + resource
+	}
+
+	return "/api/v1/namespaces/" + s.namespace + "/" + resource
+}
@@ -0,0 +1,197 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+func TestKubernetesSource(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"kind":"Status","message":"Unauthorized"}`))
+			return
+		}
+
+		query := r.URL.Query()
+		switch r.URL.Path {
+		case "/api/v1/nodes":
+			if got := query.Get("labelSelector"); got != "pool=edge" {
+				t.Errorf("unexpected node selector %q", got)
+			}
+			// the second node is served on its own page
+			if query.Get("continue") == "" {
+				_, _ = w.Write([]byte(`{"metadata":{"continue":"page-2"},"items":[{"metadata":{"name":"edge-1"},"status":{"addresses":[
+					{"type":"InternalIP","address":"10.0.0.1"},{"type":"ExternalIP","address":"192.0.2.10"}]}}]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"metadata":{},"items":[{"metadata":{"name":"edge-2"},"status":{"addresses":[
+				{"type":"ExternalIP","address":"192.0.2.11"},{"type":"Hostname","address":"edge-2"}]}}]}`))
+		case "/api/v1/namespaces/ingress/services":
+			_, _ = w.Write([]byte(`{"metadata":{},"items":[
+				{"metadata":{"name":"gateway","namespace":"ingress"},"status":{"loadBalancer":{"ingress":[{"ip":"198.51.100.7"},{"hostname":"lb.example.com"}]}}},
+				{"metadata":{"name":"internal","namespace":"ingress"},"status":{"loadBalancer":{}}}]}`))
+		case "/api/v1/namespaces/ingress/configmaps":
+			if got := query.Get("labelSelector"); got != "whitelist=true" {
+				t.Errorf("unexpected configmap selector %q", got)
+			}
+			_, _ = w.Write([]byte(`{"metadata":{},"items":[{"metadata":{"name":"partners","namespace":"ingress"},"data":{
+				"ranges":"# partner networks\n203.0.113.0/24 ; partner-a\n2001:db8::/32\n"}}]}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	writeFile(t, kubeconfig, fmt.Sprintf(`apiVersion: v1
+kind: Config
+current-context: other
+clusters:
+- cluster:
+    certificate-authority-data: %s
+    server: %s
+  name: test
+- cluster:
+    server: https://127.0.0.1:1
+  name: other
+contexts:
+- context:
+    cluster: test
+    user: robot
+  name: test
+- context:
+    cluster: other
+    user: robot
+  name: other
+users:
+- name: robot
+  user:
+    token: test-token
+`, base64.StdEncoding.EncodeToString(ca), srv.URL))
+
+	cfg := baseConfig("")
+	cfg.ConfigurationTemplate = `{"http":{"middlewares":{"labels":{"headers":{"customRequestHeaders":{{json .Labels}}}}}}}`
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "kubernetes",
+		Kubernetes: &traefikdynamicpublicwhitelist.KubernetesSourceConfig{
+			Kubeconfig:        kubeconfig,
+			Context:           "test",
+			Namespace:         "ingress",
+			LabelSelector:     "pool=edge",
+			ConfigMapSelector: "whitelist=true",
+		},
+	}}
+
+	configuration := loadOnce(t, cfg)
+
+	labels := configuration.HTTP.Middlewares["labels"].Headers.CustomRequestHeaders
+	want := map[string]string{
+		"192.0.2.10":     "node/edge-1",
+		"192.0.2.11":     "node/edge-2",
+		"198.51.100.7":   "service/ingress/gateway",
+		"203.0.113.0/24": "partner-a",
+	}
+	if len(labels) != len(want) {
+		t.Fatalf("unexpected labels: %v", labels)
+	}
+	for cidr, label := range want {
+		if labels[cidr] != label {
+			t.Fatalf("unexpected label for %s: %v", cidr, labels)
+		}
+	}
+}
+
+func TestKubernetesSourceConfigMapLabel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/configmaps" {
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+		if user, password, ok := r.BasicAuth(); !ok || user != "admin" || password != "secret" {
+			t.Errorf("missing basic auth")
+		}
+		_, _ = w.Write([]byte(`{"metadata":{},"items":[{"metadata":{"name":"office","namespace":"default"},"data":{"cidrs":"192.0.2.0/24"}}]}`))
+	}))
+	t.Cleanup(srv.Close)
+
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	writeFile(t, kubeconfig, `current-context: local
+clusters:
+  - name: local
+    cluster:
+      server: `+srv.URL+`
+contexts:
+  - name: local
+    context: {cluster: local, user: admin}
+users:
+  - name: admin
+    user:
+      username: admin
+      password: "secret"
+`)
+
+	cfg := baseConfig("")
+	cfg.ConfigurationTemplate = `{"http":{"middlewares":{"labels":{"headers":{"customRequestHeaders":{{json .Labels}}}}}}}`
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "kubernetes",
+		Kubernetes: &traefikdynamicpublicwhitelist.KubernetesSourceConfig{
+			Kubeconfig:        kubeconfig,
+			Resources:         []string{"configmaps"},
+			ConfigMapSelector: "whitelist",
+		},
+	}}
+
+	configuration := loadOnce(t, cfg)
+
+	labels := configuration.HTTP.Middlewares["labels"].Headers.CustomRequestHeaders
+	if len(labels) != 1 || labels["192.0.2.0/24"] != "configmap/default/office" {
+		t.Fatalf("unexpected labels: %v", labels)
+	}
+}
+
+func TestKubernetesSourceValidation(t *testing.T) {
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+
+	kubeconfig := filepath.Join(t.TempDir(), "kubeconfig")
+	writeFile(t, kubeconfig, `current-context: eks
+clusters:
+- name: eks
+  cluster: {server: "https://eks.example.com"}
+contexts:
+- name: eks
+  context: {cluster: eks, user: aws}
+users:
+- name: aws
+  user:
+    exec:
+      command: aws
+`)
+
+	for name, settings := range map[string]*traefikdynamicpublicwhitelist.KubernetesSourceConfig{
+		"not in cluster":     nil,
+		"unknown resource":   {Kubeconfig: kubeconfig, Resources: []string{"pods"}},
+		"missing selector":   {Kubeconfig: kubeconfig, Resources: []string{"configmaps"}},
+		"missing context":    {Kubeconfig: kubeconfig, Context: "missing"},
+		"exec plugin":        {Kubeconfig: kubeconfig},
+		"missing kubeconfig": {Kubeconfig: filepath.Join(t.TempDir(), "missing")},
+	} {
+		cfg := baseConfig("")
+		cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "kubernetes", Kubernetes: settings}}
+		if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+			t.Fatalf("%s: expected error", name)
+		} else if !strings.Contains(err.Error(), "kubernetes") {
+			t.Fatalf("%s: error does not name the source: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const sourceTypeMMDB = "mmdb"
+
+// MMDBSourceConfig selects the countries allowed from a GeoIP2/GeoLite2/DB-IP country database.
+type MMDBSourceConfig struct {
+	// Countries are ISO 3166-1 alpha-2 codes matched against country and registered_country.
+	Countries []string `json:"countries,omitempty"`
+}
+
+// mmdbSource emits every network of a MaxMind DB whose country matches.
+// The database is only re-read when its mtime or size changes.
+type mmdbSource struct {
+	path          string
+	countries     map[string]struct{}
+	whitelistIPv6 bool
+	watchInterval time.Duration
+
+	mu     sync.Mutex
+	loaded bool
+	state  fileState
+	ranges []labeledRange
+}
+
+func newMMDBSource(config SourceConfig, env sourceEnv) (rangeSource, error) {
+	path := strings.TrimSpace(config.Path)
+	if path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	if config.MMDB == nil || len(config.MMDB.Countries) == 0 {
+		return nil, fmt.Errorf("mmdb.countries is required")
+	}
+
+	countries := make(map[string]struct{}, len(config.MMDB.Countries))
+	for _, country := range config.MMDB.Countries {
+		code := strings.ToUpper(strings.TrimSpace(country))
+		if len(code) != 2 {
+			return nil, fmt.Errorf("mmdb.countries: invalid ISO code %q", country)
+		}
+		countries[code] = struct{}{}
+	}
+
+	watchInterval, err := parseWatchInterval(config.WatchInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mmdbSource{
+		path:          path,
+		countries:     countries,
+		whitelistIPv6: env.whitelistIPv6,
+		watchInterval: watchInterval,
+	}, nil
+}
+
+func (s *mmdbSource) fetch(_ context.Context) ([]labeledRange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if s.loaded && s.state.sameStat(info) {
+		return s.ranges, nil
+	}
+
+	file, err := os.ReadFile(s.path)
+	if err != nil {
+		return nil, err
+	}
+
+	reader, err := openMMDB(file)
+	if err != nil {
+		return nil, err
+	}
+
+	ranges, err := s.match(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	s.loaded = true
+	s.state = fileState{modTime: info.ModTime(), size: info.Size()}
+	s.ranges = ranges
+
+	return ranges, nil
+}
+
+func (s *mmdbSource) watch(ctx context.Context, notify func()) {
+	pollFile(ctx, s.path, s.watchInterval, notify)
+}
+
+// match walks the tree, decoding each distinct data record once, and merges adjacent
+// networks of the same country.
+func (s *mmdbSource) match(reader *mmdbReader) ([]labeledRange, error) {
+	countries := make(map[int]string)
+	aggregator := newRangeAggregator()
+
+	err := reader.networks(s.whitelistIPv6, func(network mmdbNetwork) error {
+		if network.network.IP.To4() == nil && !s.whitelistIPv6 {
+			return nil
+		}
+
+		country, ok := countries[network.dataOffset]
+		if !ok {
+			record, _, err := reader.data.decode(network.dataOffset, 0)
+			if err != nil {
+				return fmt.Errorf("mmdb: record at %d: %w", network.dataOffset, err)
+			}
+			country = s.matchingCountry(record)
+			countries[network.dataOffset] = country
+		}
+
+		if country != "" {
+			aggregator.add(country, network.network)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return aggregator.ranges(), nil
+}
+
+// matchingCountry returns the configured ISO code of the record's country or registered country.
+func (s *mmdbSource) matchingCountry(record interface{}) string {
+	fields, _ := record.(map[string]interface{})
+	for _, key := range []string{"country", "registered_country"} {
+		country, _ := fields[key].(map[string]interface{})
+		code, _ := country["iso_code"].(string)
+		if _, ok := s.countries[strings.ToUpper(code)]; ok && code != "" {
+			return strings.ToUpper(code)
+		}
+	}
+
+	return ""
+}
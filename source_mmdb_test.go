@@ -0,0 +1,303 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+type testMMDBEntry struct {
+	cidr       string
+	country    string
+	registered string
+}
+
+type testMMDBNode struct {
+	// children hold a *testMMDBNode, a data offset (int) or nil
+	children [2]interface{}
+}
+
+func TestMMDBSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+	writeTestMMDB(t, path, []testMMDBEntry{
+		{cidr: "192.0.2.0/24", country: "DE", registered: "DE"},
+		{cidr: "198.51.100.0/24", country: "FR", registered: "AT"},
+		{cidr: "198.51.101.0/24", country: "DE", registered: "DE"},
+		{cidr: "203.0.113.0/24", country: "US", registered: "US"},
+		{cidr: "2001:db8::/32", country: "CH", registered: "CH"},
+	})
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "mmdb",
+		Path: path,
+		MMDB: &traefikdynamicpublicwhitelist.MMDBSourceConfig{Countries: []string{"de", "AT", "CH"}},
+	}}
+
+	provider := newProvider(t, cfg)
+	sourceRange := func() string {
+		t.Helper()
+		configuration, err := provider.GenerateConfiguration(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ",")
+	}
+
+	if got := sourceRange(); got != "192.0.2.0/24,198.51.100.0/24,198.51.101.0/24" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+
+	// the database is reloaded when the file changes
+	writeTestMMDB(t, path, []testMMDBEntry{{cidr: "203.0.113.0/24", country: "AT", registered: "AT"}})
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := sourceRange(); got != "203.0.113.0/24" {
+		t.Fatalf("database not reloaded: %s", got)
+	}
+}
+
+func TestMMDBSourceIPv6SkipsIPv4Aliases(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	writeTestMMDB(t, path, []testMMDBEntry{
+		{cidr: "192.0.2.0/24", country: "DE", registered: "DE"},
+		{cidr: "2001:db8::/32", country: "CH", registered: "CH"},
+	})
+
+	cfg := baseConfig("")
+	cfg.WhitelistIPv6 = true
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "mmdb",
+		Path: path,
+		MMDB: &traefikdynamicpublicwhitelist.MMDBSourceConfig{Countries: []string{"DE", "CH"}},
+	}}
+
+	configuration := loadOnce(t, cfg)
+
+	got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ",")
+	if got != "192.0.2.0/24,2001:db8::/32" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+}
+
+func TestMMDBSourceAggregatesAdjacentNetworks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	writeTestMMDB(t, path, []testMMDBEntry{
+		{cidr: "198.51.100.0/25", country: "DE", registered: "DE"},
+		{cidr: "198.51.100.128/26", country: "DE", registered: "DE"},
+		{cidr: "198.51.100.192/26", country: "DE", registered: "DE"},
+		{cidr: "198.51.101.0/24", country: "AT", registered: "AT"},
+		{cidr: "2001:db8::/33", country: "DE", registered: "DE"},
+		{cidr: "2001:db8:8000::/33", country: "DE", registered: "DE"},
+	})
+
+	for _, tt := range []struct {
+		ipv6 bool
+		want string
+	}{
+		{want: "198.51.100.0/24,198.51.101.0/24"},
+		{ipv6: true, want: "198.51.100.0/24,198.51.101.0/24,2001:db8::/32"},
+	} {
+		cfg := baseConfig("")
+		cfg.WhitelistIPv6 = tt.ipv6
+		cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+			Type: "mmdb",
+			Path: path,
+			MMDB: &traefikdynamicpublicwhitelist.MMDBSourceConfig{Countries: []string{"DE", "AT"}},
+		}}
+
+		configuration := loadOnce(t, cfg)
+		if got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ","); got != tt.want {
+			t.Fatalf("ipv6 %v: unexpected source ranges: %s", tt.ipv6, got)
+		}
+	}
+}
+
+func TestMMDBSourceValidation(t *testing.T) {
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "mmdb", Path: "country.mmdb"}}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error without countries")
+	}
+
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "mmdb",
+		Path: "country.mmdb",
+		MMDB: &traefikdynamicpublicwhitelist.MMDBSourceConfig{Countries: []string{"DEU"}},
+	}}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error for invalid country code")
+	}
+
+	path := filepath.Join(t.TempDir(), "broken.mmdb")
+	writeFile(t, path, "not a database")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "mmdb",
+		Path: path,
+		MMDB: &traefikdynamicpublicwhitelist.MMDBSourceConfig{Countries: []string{"DE"}},
+	}}
+	provider := newProvider(t, cfg)
+	if _, err := provider.GenerateConfiguration(context.Background()); err == nil {
+		t.Fatal("expected error for invalid database")
+	}
+}
+
+// writeTestMMDB writes an IPv6 MaxMind DB with 28-bit records. IPv4 networks live under ::/96
+// and ::ffff:0:0/96 aliases the IPv4 subtree like real GeoLite2 databases.
+func writeTestMMDB(t *testing.T, path string, entries []testMMDBEntry) {
+	t.Helper()
+
+	var data bytes.Buffer
+	isoCode := data.Len()
+	writeMMDBString(&data, "iso_code")
+
+	offsets := make(map[string]int)
+	root := &testMMDBNode{}
+
+	for _, entry := range entries {
+		key := entry.country + "/" + entry.registered
+		offset, ok := offsets[key]
+		if !ok {
+			offset = data.Len()
+			offsets[key] = offset
+			data.WriteByte(7<<5 | 2) // map with 2 entries
+			for _, field := range [][2]string{{"country", entry.country}, {"registered_country", entry.registered}} {
+				writeMMDBString(&data, field[0])
+				data.WriteByte(7<<5 | 1)
+				data.Write([]byte{1<<5 | byte(isoCode>>8), byte(isoCode)}) // pointer to "iso_code"
+				writeMMDBString(&data, field[1])
+			}
+		}
+
+		_, network, err := net.ParseCIDR(entry.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, bits := network.Mask.Size()
+		ip := make(net.IP, 16)
+		if bits == 32 {
+			copy(ip[12:], network.IP.To4())
+			ones += 96
+		} else {
+			copy(ip, network.IP)
+		}
+
+		insertMMDBNetwork(root, ip, ones, offset)
+	}
+
+	// alias ::ffff:0:0/96 to the ::/96 subtree
+	ipv4Node := root
+	for depth := 0; depth < 96; depth++ {
+		ipv4Node, _ = ipv4Node.children[0].(*testMMDBNode)
+	}
+	mapped := make(net.IP, 16)
+	mapped[10], mapped[11] = 0xff, 0xff
+	node := root
+	for depth := 0; depth < 95; depth++ {
+		node = childMMDBNode(node, mmdbBit(mapped, depth))
+	}
+	node.children[1] = ipv4Node
+
+	// number nodes breadth first
+	index := map[*testMMDBNode]int{root: 0}
+	order := []*testMMDBNode{root}
+	for i := 0; i < len(order); i++ {
+		for _, child := range order[i].children {
+			if next, ok := child.(*testMMDBNode); ok {
+				if _, seen := index[next]; !seen {
+					index[next] = len(order)
+					order = append(order, next)
+				}
+			}
+		}
+	}
+	nodeCount := len(order)
+
+	var file bytes.Buffer
+	for _, current := range order {
+		var records [2]uint32
+		for bit, child := range current.children {
+			switch value := child.(type) {
+			case *testMMDBNode:
+				records[bit] = uint32(index[value])
+			case int:
+				records[bit] = uint32(nodeCount + 16 + value)
+			default:
+				records[bit] = uint32(nodeCount)
+			}
+		}
+		left, right := records[0], records[1]
+		file.Write([]byte{
+			byte(left >> 16), byte(left >> 8), byte(left),
+			byte(left>>24)<<4 | byte(right>>24),
+			byte(right >> 16), byte(right >> 8), byte(right),
+		})
+	}
+
+	file.Write(make([]byte, 16))
+	file.Write(data.Bytes())
+	file.WriteString("\xab\xcd\xefMaxMind.com")
+
+	file.WriteByte(7<<5 | 6) // metadata map with 6 entries
+	writeMMDBString(&file, "node_count")
+	writeMMDBUint(&file, 6, uint64(nodeCount), 4)
+	writeMMDBString(&file, "record_size")
+	writeMMDBUint(&file, 5, 28, 2)
+	writeMMDBString(&file, "ip_version")
+	writeMMDBUint(&file, 5, 6, 2)
+	writeMMDBString(&file, "binary_format_major_version")
+	writeMMDBUint(&file, 5, 2, 2)
+	writeMMDBString(&file, "database_type")
+	writeMMDBString(&file, "GeoLite2-Country")
+	writeMMDBString(&file, "build_epoch")
+	file.Write([]byte{8, 9 - 7}) // extended type uint64 of 8 bytes
+	_ = binary.Write(&file, binary.BigEndian, uint64(1700000000))
+
+	if err := os.WriteFile(path, file.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func insertMMDBNetwork(root *testMMDBNode, ip net.IP, ones, offset int) {
+	node := root
+	for depth := 0; depth < ones-1; depth++ {
+		node = childMMDBNode(node, mmdbBit(ip, depth))
+	}
+	node.children[mmdbBit(ip, ones-1)] = offset
+}
+
+func childMMDBNode(node *testMMDBNode, bit int) *testMMDBNode {
+	if child, ok := node.children[bit].(*testMMDBNode); ok {
+		return child
+	}
+	child := &testMMDBNode{}
+	node.children[bit] = child
+	return child
+}
+
+func mmdbBit(ip net.IP, depth int) int {
+	return int(ip[depth/8]>>(7-uint(depth%8))) & 1
+}
+
+func writeMMDBString(buf *bytes.Buffer, value string) {
+	buf.WriteByte(2<<5 | byte(len(value)))
+	buf.WriteString(value)
+}
+
+func writeMMDBUint(buf *bytes.Buffer, kind byte, value uint64, size int) {
+	buf.WriteByte(kind<<5 | byte(size))
+	for i := size - 1; i >= 0; i-- {
+		buf.WriteByte(byte(value >> (8 * uint(i))))
+	}
+}
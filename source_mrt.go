@@ -0,0 +1,363 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sourceTypeMRT = "mrt"
+
+	mrtTypeTableDumpV2 = 13
+
+	mrtSubtypeRIBIPv4Unicast        = 2
+	mrtSubtypeRIBIPv4Multicast      = 3
+	mrtSubtypeRIBIPv6Unicast        = 4
+	mrtSubtypeRIBIPv6Multicast      = 5
+	mrtSubtypeRIBIPv4UnicastAddPath = 8
+	mrtSubtypeRIBIPv6UnicastAddPath = 10
+
+	bgpAttrASPath     = 2
+	bgpAttrExtended   = 0x10
+	bgpASPathSet      = 1
+	bgpASPathSequence = 2
+
+	// mrtMaxRecordSize rejects corrupt length fields before allocating.
+	mrtMaxRecordSize = 16 << 20
+)
+
+// MRTSourceConfig selects the origin ASes whose prefixes are read from an MRT RIB dump.
+type MRTSourceConfig struct {
+	// ASNs accepts "AS13335" or "13335".
+	ASNs []string `json:"asns,omitempty"`
+}
+
+// mrtSource streams a TABLE_DUMP_V2 RIB dump (plain, gzip or bzip2) and keeps the prefixes
+// originated by the configured ASes. The dump is only re-read when its mtime or size changes.
+type mrtSource struct {
+	path          string
+	asns          map[uint32]struct{}
+	whitelistIPv6 bool
+	watchInterval time.Duration
+
+	mu     sync.Mutex
+	loaded bool
+	state  fileState
+	ranges []labeledRange
+}
+
+func newMRTSource(config SourceConfig, env sourceEnv) (rangeSource, error) {
+	path := strings.TrimSpace(config.Path)
+	if path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+	if config.MRT == nil || len(config.MRT.ASNs) == 0 {
+		return nil, fmt.Errorf("mrt.asns is required")
+	}
+
+	asns := make(map[uint32]struct{}, len(config.MRT.ASNs))
+	for _, raw := range config.MRT.ASNs {
+		asn, err := parseASN(raw)
+		if err != nil {
+			return nil, fmt.Errorf("mrt.asns: %w", err)
+		}
+		asns[asn] = struct{}{}
+	}
+
+	watchInterval, err := parseWatchInterval(config.WatchInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	return &mrtSource{
+		path:          path,
+		asns:          asns,
+		whitelistIPv6: env.whitelistIPv6,
+		watchInterval: watchInterval,
+	}, nil
+}
+
+func (s *mrtSource) fetch(_ context.Context) ([]labeledRange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, err
+	}
+	if s.loaded && s.state.sameStat(info) {
+		return s.ranges, nil
+	}
+
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = file.Close() }()
+
+	reader, err := decompress(bufio.NewReaderSize(file, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+
+	byOrigin, err := s.index(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	s.loaded = true
+	s.state = fileState{modTime: info.ModTime(), size: info.Size()}
+	s.ranges = byOrigin
+
+	return byOrigin, nil
+}
+
+func (s *mrtSource) watch(ctx context.Context, notify func()) {
+	pollFile(ctx, s.path, s.watchInterval, notify)
+}
+
+// decompress detects gzip and bzip2 streams by their magic bytes.
+func decompress(reader *bufio.Reader) (io.Reader, error) {
+	magic, err := reader.Peek(3)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	switch {
+	case len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		return gzip.NewReader(reader)
+	case len(magic) == 3 && string(magic) == "BZh":
+		return bzip2.NewReader(reader), nil
+	default:
+		return reader, nil
+	}
+}
+
+// index reads the dump record by record, indexing the prefixes of the configured
+// origin ASes. Only matching prefixes are kept in memory.
+func (s *mrtSource) index(reader io.Reader) ([]labeledRange, error) {
+	byOrigin := make(map[uint32]map[string]struct{}, len(s.asns))
+
+	var header [12]byte
+	body := make([]byte, 0, 4096)
+
+	for {
+		if _, err := io.ReadFull(reader, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("mrt: %w", err)
+		}
+
+		recordType := binary.BigEndian.Uint16(header[4:])
+		subtype := binary.BigEndian.Uint16(header[6:])
+		length := binary.BigEndian.Uint32(header[8:])
+		if length > mrtMaxRecordSize {
+			return nil, fmt.Errorf("mrt: record of %d bytes exceeds the size limit", length)
+		}
+
+		ipv6, addPath, ok := ribSubtype(subtype)
+		if recordType != mrtTypeTableDumpV2 || !ok || (ipv6 && !s.whitelistIPv6) {
+			if _, err := io.CopyN(io.Discard, reader, int64(length)); err != nil {
+				return nil, fmt.Errorf("mrt: %w", err)
+			}
+			continue
+		}
+
+		if cap(body) < int(length) {
+			body = make([]byte, length)
+		}
+		body = body[:length]
+		if _, err := io.ReadFull(reader, body); err != nil {
+			return nil, fmt.Errorf("mrt: %w", err)
+		}
+
+		prefix, origins, err := parseRIBRecord(body, ipv6, addPath)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, origin := range origins {
+			if _, ok := s.asns[origin]; !ok {
+				continue
+			}
+			if byOrigin[origin] == nil {
+				byOrigin[origin] = make(map[string]struct{})
+			}
+			byOrigin[origin][prefix] = struct{}{}
+		}
+	}
+
+	origins := make([]uint32, 0, len(byOrigin))
+	for origin := range byOrigin {
+		origins = append(origins, origin)
+	}
+	sort.Slice(origins, func(i, j int) bool { return origins[i] < origins[j] })
+
+	ranges := make([]labeledRange, 0)
+	for _, origin := range origins {
+		prefixes := make([]string, 0, len(byOrigin[origin]))
+		for prefix := range byOrigin[origin] {
+			prefixes = append(prefixes, prefix)
+		}
+		sort.Strings(prefixes)
+
+		label := "AS" + strconv.FormatUint(uint64(origin), 10)
+		for _, prefix := range prefixes {
+			ranges = append(ranges, labeledRange{CIDR: prefix, Label: label})
+		}
+	}
+
+	return ranges, nil
+}
+
+func ribSubtype(subtype uint16) (bool, bool, bool) {
+	switch subtype {
+	case mrtSubtypeRIBIPv4Unicast, mrtSubtypeRIBIPv4Multicast:
+		return false, false, true
+	case mrtSubtypeRIBIPv6Unicast, mrtSubtypeRIBIPv6Multicast:
+		return true, false, true
+	case mrtSubtypeRIBIPv4UnicastAddPath, mrtSubtypeRIBIPv4UnicastAddPath + 1:
+		return false, true, true
+	case mrtSubtypeRIBIPv6UnicastAddPath, mrtSubtypeRIBIPv6UnicastAddPath + 1:
+		return true, true, true
+	default:
+		return false, false, false
+	}
+}
+
+// parseRIBRecord decodes a RIB_IPV4/IPV6 record (RFC 6396 section 4.3.2), returning the
+// prefix and the origin AS of every RIB entry.
+func parseRIBRecord(body []byte, ipv6, addPath bool) (string, []uint32, error) {
+	if len(body) < 5 {
+		return "", nil, fmt.Errorf("mrt: truncated RIB record")
+	}
+
+	bits := int(body[4])
+	size := net.IPv4len
+	if ipv6 {
+		size = net.IPv6len
+	}
+	if bits > size*8 {
+		return "", nil, fmt.Errorf("mrt: invalid prefix length %d", bits)
+	}
+
+	octets := (bits + 7) / 8
+	offset := 5 + octets
+	if len(body) < offset+2 {
+		return "", nil, fmt.Errorf("mrt: truncated RIB record")
+	}
+
+	ip := make(net.IP, size)
+	copy(ip, body[5:offset])
+	mask := net.CIDRMask(bits, size*8)
+	prefix := (&net.IPNet{IP: ip.Mask(mask), Mask: mask}).String()
+
+	count := int(binary.BigEndian.Uint16(body[offset:]))
+	offset += 2
+
+	origins := make([]uint32, 0, 1)
+	for i := 0; i < count; i++ {
+		// peer index (2) and originated time (4), plus the path identifier with ADD-PATH
+		offset += 6
+		if addPath {
+			offset += 4
+		}
+		if len(body) < offset+2 {
+			return "", nil, fmt.Errorf("mrt: truncated RIB entry")
+		}
+		attrLength := int(binary.BigEndian.Uint16(body[offset:]))
+		offset += 2
+		if len(body) < offset+attrLength {
+			return "", nil, fmt.Errorf("mrt: truncated RIB entry attributes")
+		}
+
+		entryOrigins, err := originASes(body[offset : offset+attrLength])
+		if err != nil {
+			return "", nil, err
+		}
+		origins = append(origins, entryOrigins...)
+		offset += attrLength
+	}
+
+	return prefix, origins, nil
+}
+
+// originASes returns the last AS of the AS_PATH, or every member of a trailing AS_SET.
+// AS numbers are always 4 bytes wide in TABLE_DUMP_V2.
+func originASes(attributes []byte) ([]uint32, error) {
+	for offset := 0; offset < len(attributes); {
+		if len(attributes) < offset+3 {
+			return nil, fmt.Errorf("mrt: truncated path attribute")
+		}
+		flags := attributes[offset]
+		attrType := attributes[offset+1]
+
+		length := int(attributes[offset+2])
+		offset += 3
+		if flags&bgpAttrExtended != 0 {
+			if len(attributes) < offset+1 {
+				return nil, fmt.Errorf("mrt: truncated path attribute")
+			}
+			length = int(binary.BigEndian.Uint16(attributes[offset-1:]))
+			offset++
+		}
+		if len(attributes) < offset+length {
+			return nil, fmt.Errorf("mrt: truncated path attribute")
+		}
+
+		if attrType == bgpAttrASPath {
+			return lastASPathSegment(attributes[offset : offset+length])
+		}
+		offset += length
+	}
+
+	return nil, nil
+}
+
+func lastASPathSegment(path []byte) ([]uint32, error) {
+	var last []uint32
+
+	for offset := 0; offset < len(path); {
+		if len(path) < offset+2 {
+			return nil, fmt.Errorf("mrt: truncated AS_PATH")
+		}
+		segmentType := path[offset]
+		count := int(path[offset+1])
+		offset += 2
+		if len(path) < offset+4*count {
+			return nil, fmt.Errorf("mrt: truncated AS_PATH")
+		}
+
+		members := make([]uint32, count)
+		for i := range members {
+			members[i] = binary.BigEndian.Uint32(path[offset+4*i:])
+		}
+		offset += 4 * count
+
+		if count == 0 {
+			continue
+		}
+		switch segmentType {
+		case bgpASPathSequence:
+			last = members[count-1:]
+		case bgpASPathSet:
+			last = members
+		}
+	}
+
+	return last, nil
+}
@@ -0,0 +1,188 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+// testRIBEntry is one peer's route: AS_PATH sequence, plus an optional trailing AS_SET.
+type testRIBEntry struct {
+	sequence []uint32
+	set      []uint32
+}
+
+func TestMRTSource(t *testing.T) {
+	dump := buildTestRIB(t)
+	dir := t.TempDir()
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(dump); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string][]byte{
+		"rib.mrt":    dump,
+		"rib.mrt.gz": compressed.Bytes(),
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), content, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	paths := []string{
+		filepath.Join(dir, "rib.mrt"),
+		filepath.Join(dir, "rib.mrt.gz"),
+		// bzip2 has no stdlib writer, the fixture holds the same dump
+		filepath.Join("testdata", "rib.mrt.bz2"),
+	}
+
+	for _, path := range paths {
+		cfg := baseConfig("")
+		cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+			Type: "mrt",
+			Path: path,
+			MRT:  &traefikdynamicpublicwhitelist.MRTSourceConfig{ASNs: []string{"AS64496", "64511"}},
+		}}
+
+		configuration := loadOnce(t, cfg)
+
+		got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ",")
+		if got != "192.0.2.0/24,198.51.100.0/24,203.0.113.0/24" {
+			t.Fatalf("%s: unexpected source ranges: %s", path, got)
+		}
+	}
+}
+
+func TestMRTSourceIPv6(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rib.mrt")
+	if err := os.WriteFile(path, buildTestRIB(t), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := baseConfig("")
+	cfg.WhitelistIPv6 = true
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "mrt",
+		Path: path,
+		MRT:  &traefikdynamicpublicwhitelist.MRTSourceConfig{ASNs: []string{"AS64496"}},
+	}}
+
+	configuration := loadOnce(t, cfg)
+
+	got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ",")
+	if got != "192.0.2.0/24,198.51.100.0/24,2001:db8::/32" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+}
+
+func TestMRTSourceValidation(t *testing.T) {
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "mrt", Path: "rib.mrt"}}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error without asns")
+	}
+
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "mrt",
+		MRT:  &traefikdynamicpublicwhitelist.MRTSourceConfig{ASNs: []string{"AS64496"}},
+	}}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error without path")
+	}
+}
+
+// buildTestRIB encodes a small TABLE_DUMP_V2 dump; testdata/rib.mrt.bz2 is its bzip2 form.
+func buildTestRIB(t *testing.T) []byte {
+	t.Helper()
+
+	var dump bytes.Buffer
+
+	// PEER_INDEX_TABLE, skipped by the parser
+	writeMRTRecord(&dump, 13, 1, []byte{192, 0, 2, 1, 0, 0, 0, 0})
+	// BGP4MP message, skipped by the parser
+	writeMRTRecord(&dump, 16, 4, []byte{1, 2, 3, 4})
+
+	writeRIB(t, &dump, "192.0.2.0/24", []testRIBEntry{{sequence: []uint32{64500, 64496}}})
+	writeRIB(t, &dump, "198.51.100.0/24", []testRIBEntry{
+		{sequence: []uint32{64500, 64497}},
+		{sequence: []uint32{64501, 64496}},
+	})
+	writeRIB(t, &dump, "203.0.113.0/24", []testRIBEntry{{sequence: []uint32{64500}, set: []uint32{64510, 64511}}})
+	writeRIB(t, &dump, "100.64.0.0/10", []testRIBEntry{{sequence: []uint32{64500, 64499}}})
+	writeRIB(t, &dump, "2001:db8::/32", []testRIBEntry{{sequence: []uint32{64500, 64496}}})
+
+	return dump.Bytes()
+}
+
+func writeRIB(t *testing.T, dump *bytes.Buffer, cidr string, entries []testRIBEntry) {
+	t.Helper()
+
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bits, size := network.Mask.Size()
+	subtype := uint16(2)
+	if size == 128 {
+		subtype = 4
+	}
+
+	var body bytes.Buffer
+	_ = binary.Write(&body, binary.BigEndian, uint32(1)) // sequence number
+	body.WriteByte(byte(bits))
+	ip := network.IP.To4()
+	if ip == nil {
+		ip = network.IP
+	}
+	body.Write(ip[:(bits+7)/8])
+	_ = binary.Write(&body, binary.BigEndian, uint16(len(entries)))
+
+	for i, entry := range entries {
+		var path bytes.Buffer
+		for _, segment := range []struct {
+			kind    byte
+			members []uint32
+		}{{2, entry.sequence}, {1, entry.set}} {
+			if len(segment.members) == 0 {
+				continue
+			}
+			path.WriteByte(segment.kind)
+			path.WriteByte(byte(len(segment.members)))
+			_ = binary.Write(&path, binary.BigEndian, segment.members)
+		}
+
+		var attributes bytes.Buffer
+		attributes.Write([]byte{0x40, 1, 1, 0})                                    // ORIGIN IGP
+		attributes.Write([]byte{0x50, 2, byte(path.Len() >> 8), byte(path.Len())}) // AS_PATH, extended length
+		attributes.Write(path.Bytes())
+
+		_ = binary.Write(&body, binary.BigEndian, uint16(i))
+		_ = binary.Write(&body, binary.BigEndian, uint32(1700000000))
+		_ = binary.Write(&body, binary.BigEndian, uint16(attributes.Len()))
+		body.Write(attributes.Bytes())
+	}
+
+	writeMRTRecord(dump, 13, subtype, body.Bytes())
+}
+
+func writeMRTRecord(dump *bytes.Buffer, recordType, subtype uint16, body []byte) {
+	_ = binary.Write(dump, binary.BigEndian, uint32(1700000000))
+	_ = binary.Write(dump, binary.BigEndian, recordType)
+	_ = binary.Write(dump, binary.BigEndian, subtype)
+	_ = binary.Write(dump, binary.BigEndian, uint32(len(body)))
+	dump.Write(body)
+}
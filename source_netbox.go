@@ -0,0 +1,187 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	sourceTypeNetBox = "netbox"
+
+	netboxObjectPrefixes    = "prefixes"
+	netboxObjectIPAddresses = "ip-addresses"
+
+	netboxTimeout  = 10 * time.Second
+	netboxPageSize = 1000
+	// netboxMaxPages stops a misbehaving server from paging forever.
+	netboxMaxPages = 1000
+)
+
+// NetBoxSourceConfig selects the NetBox IPAM objects whose ranges are allowed.
+// The filters list NetBox slugs and are combined as NetBox does: an object needs all of the
+// tags and one of the values of every other filter.
+type NetBoxSourceConfig struct {
+	Token string `json:"token,omitempty"`
+	// Objects are "prefixes" (default) and/or "ip-addresses".
+	Objects []string `json:"objects,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+	Roles   []string `json:"roles,omitempty"`
+	// Sites only applies to prefixes, NetBox does not filter IP addresses by site.
+	Sites   []string `json:"sites,omitempty"`
+	Tenants []string `json:"tenants,omitempty"`
+}
+
+type netboxPage struct {
+	Next    *string `json:"next"`
+	Results []struct {
+		Prefix      string `json:"prefix"`
+		Address     string `json:"address"`
+		Description string `json:"description"`
+	} `json:"results"`
+}
+
+// netboxSource pages through the IPAM prefixes and IP addresses matching the filters and
+// labels every range with its NetBox description.
+type netboxSource struct {
+	base    *url.URL
+	token   string
+	objects []string
+	filters url.Values
+	client  *http.Client
+}
+
+func newNetBoxSource(config SourceConfig) (rangeSource, error) {
+	settings := config.NetBox
+	if settings == nil || strings.TrimSpace(settings.Token) == "" {
+		return nil, fmt.Errorf("netbox.token is required")
+	}
+
+	base, err := url.Parse(strings.TrimSuffix(strings.TrimSpace(config.URL), "/"))
+	if err != nil || base.Host == "" || (base.Scheme != "http" && base.Scheme != "https") {
+		return nil, fmt.Errorf("url: a NetBox http(s) URL is required")
+	}
+
+	source := &netboxSource{
+		base:    base,
+		token:   strings.TrimSpace(settings.Token),
+		filters: url.Values{},
+		client:  &http.Client{Timeout: netboxTimeout},
+	}
+
+	objects := settings.Objects
+	if len(objects) == 0 {
+		objects = []string{netboxObjectPrefixes}
+	}
+	for _, object := range objects {
+		object = strings.ToLower(strings.TrimSpace(object))
+		switch object {
+		case netboxObjectPrefixes, netboxObjectIPAddresses:
+			source.objects = append(source.objects, object)
+		default:
+			return nil, fmt.Errorf("netbox.objects: unsupported object %q", object)
+		}
+		if object == netboxObjectIPAddresses && len(settings.Sites) > 0 {
+			return nil, fmt.Errorf("netbox.sites only applies to prefixes")
+		}
+	}
+
+	for name, values := range map[string][]string{"tag": settings.Tags, "role": settings.Roles, "site": settings.Sites, "tenant": settings.Tenants} {
+		for _, value := range values {
+			if value = strings.TrimSpace(value); value != "" {
+				source.filters.Add(name, value)
+			}
+		}
+	}
+
+	return source, nil
+}
+
+func (s *netboxSource) fetch(ctx context.Context) ([]labeledRange, error) {
+	ranges := make([]labeledRange, 0)
+	for _, object := range s.objects {
+		query := url.Values{}
+		for name, values := range s.filters {
+			query[name] = values
+		}
+		query.Set("limit", strconv.Itoa(netboxPageSize))
+
+		next := s.base.Path + "/api/ipam/" + object + "/?" + query.Encode()
+		for pages := 0; next != ""; pages++ {
+			if pages == netboxMaxPages {
+				return nil, fmt.Errorf("netbox: %s: more than %d pages", object, netboxMaxPages)
+			}
+
+			page, err := s.page(ctx, next)
+			if err != nil {
+				return nil, fmt.Errorf("netbox: %s: %w", object, err)
+			}
+
+			for _, result := range page.Results {
+				if cidr := netboxRange(result.Prefix, result.Address); cidr != "" {
+					ranges = append(ranges, labeledRange{CIDR: cidr, Label: strings.TrimSpace(result.Description)})
+				}
+			}
+
+			next = ""
+			if page.Next != nil && *page.Next != "" {
+				// NetBox behind a proxy often links the wrong scheme or host, only keep the path
+				// and query so the token is never sent elsewhere
+				link, err := url.Parse(*page.Next)
+				if err != nil {
+					return nil, fmt.Errorf("netbox: %s: invalid next link %q", object, *page.Next)
+				}
+				next = link.RequestURI()
+			}
+		}
+	}
+
+	return ranges, nil
+}
+
+// netboxRange returns a prefix as is, and an IP address ("192.0.2.7/24", the mask is the
+// interface's subnet) as the single host.
+func netboxRange(prefix, address string) string {
+	if prefix != "" {
+		return prefix
+	}
+
+	ip, _, err := net.ParseCIDR(address)
+	if err != nil {
+		return address
+	}
+
+	return ip.String()
+}
+
+func (s *netboxSource) page(ctx context.Context, requestURI string) (*netboxPage, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.base.Scheme+"://"+s.base.Host+requestURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Token "+s.token)
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	var page netboxPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
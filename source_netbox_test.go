@@ -0,0 +1,94 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+func TestNetBoxSourcePagesPrefixesAndAddresses(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Token 0123456789abcdef" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		query := r.URL.Query()
+		if tags := query["tag"]; len(tags) != 1 || tags[0] != "trusted" {
+			t.Errorf("unexpected tag filter %v", tags)
+		}
+		if tenants := query["tenant"]; len(tenants) != 2 || tenants[0] != "acme" || tenants[1] != "acme-labs" {
+			t.Errorf("unexpected tenant filter %v", tenants)
+		}
+
+		switch r.URL.Path + "?offset=" + query.Get("offset") {
+		case "/netbox/api/ipam/prefixes/?offset=":
+			// proxied NetBox instances often link the internal address
+			_, _ = w.Write([]byte(`{"count": 3, "next": "http://netbox.internal:8080/netbox/api/ipam/prefixes/?limit=1000&offset=2&tag=trusted&tenant=acme&tenant=acme-labs", "previous": null, "results": [
+				{"id": 1, "prefix": "203.0.113.0/24", "description": "Berlin office"},
+				{"id": 2, "prefix": "2001:db8:10::/48", "description": "Berlin office"}
+			]}`))
+		case "/netbox/api/ipam/prefixes/?offset=2":
+			_, _ = w.Write([]byte(`{"count": 3, "next": null, "previous": null, "results": [
+				{"id": 3, "prefix": "198.51.100.0/25", "description": "VPN concentrators"}
+			]}`))
+		case "/netbox/api/ipam/ip-addresses/?offset=":
+			_, _ = w.Write([]byte(`{"count": 1, "next": null, "previous": null, "results": [
+				{"id": 9, "address": "192.0.2.7/24", "description": "bastion"}
+			]}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := baseConfig("")
+	cfg.ConfigurationTemplate = `{"http":{"middlewares":{"public_ipwhitelist":{"ipWhiteList":{"sourceRange":{{json .SourceRange}}}},"labels":{"headers":{"customRequestHeaders":{{json .Labels}}}}}}}`
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "netbox",
+		URL:  server.URL + "/netbox/",
+		NetBox: &traefikdynamicpublicwhitelist.NetBoxSourceConfig{
+			Token:   "0123456789abcdef",
+			Objects: []string{"prefixes", "ip-addresses"},
+			Tags:    []string{"trusted"},
+			Tenants: []string{"acme", "acme-labs"},
+		},
+	}}
+
+	configuration, err := newProvider(t, cfg).GenerateConfiguration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ","); got != "203.0.113.0/24,198.51.100.0/25,192.0.2.7" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+	labels := configuration.HTTP.Middlewares["labels"].Headers.CustomRequestHeaders
+	if labels["198.51.100.0/25"] != "VPN concentrators" || labels["192.0.2.7"] != "bastion" {
+		t.Fatalf("unexpected labels %v", labels)
+	}
+
+	cfg.Sources[0].NetBox.Token = "revoked"
+	if _, err := newProvider(t, cfg).GenerateConfiguration(context.Background()); err == nil || !strings.Contains(err.Error(), "status 403") {
+		t.Fatalf("expected authorization error, got %v", err)
+	}
+}
+
+func TestNetBoxSourceErrors(t *testing.T) {
+	cfg := baseConfig("")
+	for name, source := range map[string]traefikdynamicpublicwhitelist.SourceConfig{
+		"missing token":      {Type: "netbox", URL: "https://netbox.example.com", NetBox: &traefikdynamicpublicwhitelist.NetBoxSourceConfig{}},
+		"missing url":        {Type: "netbox", NetBox: &traefikdynamicpublicwhitelist.NetBoxSourceConfig{Token: "token"}},
+		"unknown object":     {Type: "netbox", URL: "https://netbox.example.com", NetBox: &traefikdynamicpublicwhitelist.NetBoxSourceConfig{Token: "token", Objects: []string{"vlans"}}},
+		"site on ip-address": {Type: "netbox", URL: "https://netbox.example.com", NetBox: &traefikdynamicpublicwhitelist.NetBoxSourceConfig{Token: "token", Objects: []string{"ip-addresses"}, Sites: []string{"hq"}}},
+	} {
+		cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{source}
+		if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sourceTypeRedis = "redis"
+
+	defaultRedisURL = "redis://127.0.0.1:6379"
+	// redisExpiryCheck is how often the watcher looks for expired sorted set members.
+	redisExpiryCheck = time.Second
+	// redisRetry delays resubscribing after the notification connection failed.
+	redisRetry = 5 * time.Second
+)
+
+// RedisSourceConfig reads ranges from a Redis set, or from a sorted set whose scores are
+// Unix expiry timestamps. Credentials and database may also be given in the url.
+type RedisSourceConfig struct {
+	Key      string `json:"key,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Database int    `json:"database,omitempty"`
+	// KeyspaceNotifications subscribes to the key's keyspace channel and refreshes on every write.
+	// The server must publish them, e.g. notify-keyspace-events "Kgsz".
+	KeyspaceNotifications bool `json:"keyspaceNotifications,omitempty"`
+}
+
+// redisSource reads the members of a set (SMEMBERS) or the unexpired members of a sorted
+// set (ZRANGEBYSCORE). Members may carry an annotation ("203.0.113.7 ticket-42").
+type redisSource struct {
+	name     string
+	key      string
+	options  redisOptions
+	keyspace bool
+
+	mu         sync.Mutex
+	nextExpiry time.Time
+}
+
+func newRedisSource(name string, config SourceConfig) (rangeSource, error) {
+	if config.Redis == nil || strings.TrimSpace(config.Redis.Key) == "" {
+		return nil, fmt.Errorf("redis.key is required")
+	}
+
+	raw := strings.TrimSpace(config.URL)
+	if raw == "" {
+		raw = defaultRedisURL
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("url: %w", err)
+	}
+	if parsed.Scheme != "redis" && parsed.Scheme != "rediss" {
+		return nil, fmt.Errorf("url: unsupported scheme %q, use redis:// or rediss://", parsed.Scheme)
+	}
+
+	options := redisOptions{address: parsed.Host, tls: parsed.Scheme == "rediss"}
+	if parsed.Port() == "" {
+		options.address = net.JoinHostPort(parsed.Hostname(), "6379")
+	}
+	if parsed.User != nil {
+		options.username = parsed.User.Username()
+		options.password, _ = parsed.User.Password()
+	}
+	if database := strings.Trim(parsed.Path, "/"); database != "" {
+		if options.database, err = strconv.Atoi(database); err != nil {
+			return nil, fmt.Errorf("url: invalid database %q", database)
+		}
+	}
+
+	if config.Redis.Username != "" {
+		options.username = config.Redis.Username
+	}
+	if config.Redis.Password != "" {
+		options.password = config.Redis.Password
+	}
+	if config.Redis.Database != 0 {
+		options.database = config.Redis.Database
+	}
+	if options.database < 0 {
+		return nil, fmt.Errorf("redis.database must not be negative")
+	}
+
+	return &redisSource{
+		name:     name,
+		key:      strings.TrimSpace(config.Redis.Key),
+		options:  options,
+		keyspace: config.Redis.KeyspaceNotifications,
+	}, nil
+}
+
+// allowsEmpty reports that an expired or deleted key empties the allowlist.
+func (s *redisSource) allowsEmpty() bool {
+	return true
+}
+
+func (s *redisSource) fetch(ctx context.Context) ([]labeledRange, error) {
+	conn, err := dialRedis(ctx, s.options)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+
+	keyType, err := conn.do("TYPE", s.key)
+	if err != nil {
+		return nil, fmt.Errorf("redis: TYPE: %w", err)
+	}
+
+	var (
+		members    []string
+		nextExpiry time.Time
+	)
+
+	switch keyType {
+	case "set":
+		reply, err := conn.do("SMEMBERS", s.key)
+		if err != nil {
+			return nil, fmt.Errorf("redis: SMEMBERS: %w", err)
+		}
+		if members, err = redisStrings(reply); err != nil {
+			return nil, err
+		}
+	case "zset":
+		now := strconv.FormatInt(time.Now().Unix(), 10)
+		reply, err := conn.do("ZRANGEBYSCORE", s.key, "("+now, "+inf", "WITHSCORES")
+		if err != nil {
+			return nil, fmt.Errorf("redis: ZRANGEBYSCORE: %w", err)
+		}
+		values, err := redisStrings(reply)
+		if err != nil {
+			return nil, err
+		}
+		members, nextExpiry, err = unexpiredMembers(values)
+		if err != nil {
+			return nil, err
+		}
+	case "none":
+		// the key does not exist (yet)
+	default:
+		return nil, fmt.Errorf("redis: key %q is a %v, expected a set or sorted set", s.key, keyType)
+	}
+
+	s.mu.Lock()
+	s.nextExpiry = nextExpiry
+	s.mu.Unlock()
+
+	ranges := make([]labeledRange, 0, len(members))
+	for _, member := range members {
+		value, label := splitAnnotation(strings.TrimSpace(member), defaultCommentPrefix)
+		if value != "" {
+			ranges = append(ranges, labeledRange{CIDR: value, Label: label})
+		}
+	}
+
+	return ranges, nil
+}
+
+// unexpiredMembers splits a WITHSCORES reply (ascending by score) into members and the
+// earliest expiry.
+func unexpiredMembers(values []string) ([]string, time.Time, error) {
+	if len(values)%2 != 0 {
+		return nil, time.Time{}, fmt.Errorf("redis: malformed WITHSCORES reply")
+	}
+
+	members := make([]string, 0, len(values)/2)
+	var earliest time.Time
+	for i := 0; i < len(values); i += 2 {
+		score, err := strconv.ParseFloat(values[i+1], 64)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("redis: invalid score %q", values[i+1])
+		}
+		members = append(members, values[i])
+
+		if i == 0 && !math.IsInf(score, 1) {
+			seconds, fraction := math.Modf(score)
+			earliest = time.Unix(int64(seconds), int64(fraction*1e9))
+		}
+	}
+
+	return members, earliest, nil
+}
+
+// watch refreshes when the earliest sorted set member expires and, with keyspace
+// notifications, whenever the key is written.
+func (s *redisSource) watch(ctx context.Context, notify func()) {
+	if s.keyspace {
+		goRecover(s.name, func() { s.subscribe(ctx, notify) })
+	}
+
+	ticker := time.NewTicker(redisExpiryCheck)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			if s.expired(now) {
+				notify()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *redisSource) expired(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.nextExpiry.IsZero() || now.Before(s.nextExpiry) {
+		return false
+	}
+	s.nextExpiry = time.Time{}
+
+	return true
+}
+
+func (s *redisSource) subscribe(ctx context.Context, notify func()) {
+	for reconnect := false; ; reconnect = true {
+		err := s.listen(ctx, notify, reconnect)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("traefik_dynamic_public_whitelist: source %s: redis keyspace notifications: %v, resubscribing in %s", s.name, err, redisRetry)
+
+		select {
+		case <-time.After(redisRetry):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// listen subscribes to the key's keyspace channel and notifies on every event.
+// After a reconnect it also notifies once since events may have been missed.
+func (s *redisSource) listen(ctx context.Context, notify func(), reconnect bool) error {
+	conn, err := dialRedis(ctx, s.options)
+	if err != nil {
+		return err
+	}
+	defer conn.close()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.close()
+		case <-stop:
+		}
+	}()
+
+	channel := "__keyspace@" + strconv.Itoa(s.options.database) + "__:" + s.key
+	if _, err := conn.do("SUBSCRIBE", channel); err != nil {
+		return err
+	}
+	// the connection now only receives pushed messages
+	if err := conn.conn.SetDeadline(time.Time{}); err != nil {
+		return err
+	}
+	if reconnect {
+		notify()
+	}
+
+	for {
+		reply, err := conn.receive()
+		if err != nil {
+			return err
+		}
+		message, _ := reply.([]interface{})
+		if len(message) == 3 && message[0] == "message" {
+			notify()
+		}
+	}
+}
@@ -0,0 +1,421 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+// fakeRedis implements the few RESP commands used by the redis source.
+type fakeRedis struct {
+	t        *testing.T
+	password string
+
+	mu          sync.Mutex
+	sets        map[string][]string
+	zsets       map[string]map[string]float64
+	subscribers map[string][]net.Conn
+}
+
+func startFakeRedis(t *testing.T, password string) (*fakeRedis, string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := &fakeRedis{
+		t:           t,
+		password:    password,
+		sets:        make(map[string][]string),
+		zsets:       make(map[string]map[string]float64),
+		subscribers: make(map[string][]net.Conn),
+	}
+
+	var conns sync.WaitGroup
+	t.Cleanup(func() {
+		_ = listener.Close()
+		server.mu.Lock()
+		for _, subscribers := range server.subscribers {
+			for _, conn := range subscribers {
+				_ = conn.Close()
+			}
+		}
+		server.mu.Unlock()
+		conns.Wait()
+	})
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			conns.Add(1)
+			go func() {
+				defer conns.Done()
+				server.serve(conn)
+			}()
+		}
+	}()
+
+	return server, listener.Addr().String()
+}
+
+// sadd adds members to a set in db and publishes the keyspace event.
+func (r *fakeRedis) sadd(db int, key string, members ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key = strconv.Itoa(db) + "/" + key
+	r.sets[key] = append(r.sets[key], members...)
+
+	channel := fmt.Sprintf("__keyspace@%d__:%s", db, key[strings.Index(key, "/")+1:])
+	for _, conn := range r.subscribers[channel] {
+		_, _ = io.WriteString(conn, respArray("message", channel, "sadd"))
+	}
+}
+
+func (r *fakeRedis) zadd(db int, key, member string, score float64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key = strconv.Itoa(db) + "/" + key
+	if r.zsets[key] == nil {
+		r.zsets[key] = make(map[string]float64)
+	}
+	r.zsets[key][member] = score
+}
+
+func (r *fakeRedis) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	reader := bufio.NewReader(conn)
+	authenticated := r.password == ""
+	db := 0
+
+	for {
+		args, err := readRESPCommand(reader)
+		if err != nil {
+			return
+		}
+
+		command := strings.ToUpper(args[0])
+		if command != "AUTH" && !authenticated {
+			_, _ = io.WriteString(conn, "-NOAUTH Authentication required.\r\n")
+			continue
+		}
+
+		switch command {
+		case "AUTH":
+			if args[len(args)-1] != r.password {
+				_, _ = io.WriteString(conn, "-WRONGPASS invalid username-password pair\r\n")
+				continue
+			}
+			authenticated = true
+			_, _ = io.WriteString(conn, "+OK\r\n")
+		case "SELECT":
+			db, _ = strconv.Atoi(args[1])
+			_, _ = io.WriteString(conn, "+OK\r\n")
+		case "TYPE":
+			_, _ = io.WriteString(conn, "+"+r.keyType(db, args[1])+"\r\n")
+		case "SMEMBERS":
+			r.mu.Lock()
+			members := append([]string(nil), r.sets[strconv.Itoa(db)+"/"+args[1]]...)
+			r.mu.Unlock()
+			_, _ = io.WriteString(conn, respArray(members...))
+		case "ZRANGEBYSCORE":
+			if len(args) != 5 || args[3] != "+inf" || args[4] != "WITHSCORES" || !strings.HasPrefix(args[2], "(") {
+				r.t.Errorf("unexpected ZRANGEBYSCORE %v", args)
+			}
+			_, _ = io.WriteString(conn, respArray(r.zrange(db, args[1], args[2][1:])...))
+		case "SUBSCRIBE":
+			r.mu.Lock()
+			r.subscribers[args[1]] = append(r.subscribers[args[1]], conn)
+			_, _ = io.WriteString(conn, "*3\r\n$9\r\nsubscribe\r\n"+respBulk(args[1])+":1\r\n")
+			r.mu.Unlock()
+		default:
+			r.t.Errorf("unexpected command %v", args)
+			_, _ = io.WriteString(conn, "-ERR unknown command\r\n")
+		}
+	}
+}
+
+func (r *fakeRedis) keyType(db int, key string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key = strconv.Itoa(db) + "/" + key
+	if _, ok := r.sets[key]; ok {
+		return "set"
+	}
+	if _, ok := r.zsets[key]; ok {
+		return "zset"
+	}
+
+	return "none"
+}
+
+func (r *fakeRedis) zrange(db int, key, exclusiveMin string) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	min, _ := strconv.ParseFloat(exclusiveMin, 64)
+	members := make([]string, 0)
+	for member, score := range r.zsets[strconv.Itoa(db)+"/"+key] {
+		if score > min {
+			members = append(members, member)
+		}
+	}
+	scores := r.zsets[strconv.Itoa(db)+"/"+key]
+	sort.Slice(members, func(i, j int) bool { return scores[members[i]] < scores[members[j]] })
+
+	reply := make([]string, 0, 2*len(members))
+	for _, member := range members {
+		reply = append(reply, member, strconv.FormatFloat(scores[member], 'f', -1, 64))
+	}
+
+	return reply
+}
+
+func readRESPCommand(reader *bufio.Reader) ([]string, error) {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || line[0] != '*' {
+		return nil, fmt.Errorf("unexpected command %q", line)
+	}
+
+	args := make([]string, 0, count)
+	for i := 0; i < count; i++ {
+		header, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(header[1:]))
+		if err != nil {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(reader, data); err != nil {
+			return nil, err
+		}
+		args = append(args, string(data[:size]))
+	}
+
+	return args, nil
+}
+
+func respArray(items ...string) string {
+	reply := "*" + strconv.Itoa(len(items)) + "\r\n"
+	for _, item := range items {
+		reply += respBulk(item)
+	}
+
+	return reply
+}
+
+func respBulk(value string) string {
+	return "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+}
+
+func TestRedisSourceSetWithKeyspaceNotifications(t *testing.T) {
+	server, addr := startFakeRedis(t, "secret")
+	server.sadd(2, "allowlist", "203.0.113.7 ticket-42", "198.51.100.0/24")
+	server.sadd(0, "allowlist", "192.0.2.1")
+
+	cfg := baseConfig("")
+	cfg.PollInterval = "1h"
+	cfg.ConfigurationTemplate = `{"http":{"middlewares":{"public_ipwhitelist":{"ipWhiteList":{"sourceRange":{{json .SourceRange}}}},"labels":{"headers":{"customRequestHeaders":{{json .Labels}}}}}}}`
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "redis",
+		URL:  "redis://:secret@" + addr + "/2",
+		Redis: &traefikdynamicpublicwhitelist.RedisSourceConfig{
+			Key:                   "allowlist",
+			KeyspaceNotifications: true,
+		},
+	}}
+
+	provider := newProvider(t, cfg)
+	configuration, err := provider.GenerateConfiguration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label := configuration.HTTP.Middlewares["labels"].Headers.CustomRequestHeaders["203.0.113.7"]; label != "ticket-42" {
+		t.Fatalf("unexpected label %q", label)
+	}
+
+	cfgChan := make(chan json.Marshaler, 1)
+	if err := provider.Provide(cfgChan); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := nextSourceRange(t, cfgChan); got != "203.0.113.7,198.51.100.0/24" {
+		t.Fatalf("unexpected initial source ranges: %s", got)
+	}
+
+	// wait for the subscription before writing, the fake server does not buffer events
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		server.mu.Lock()
+		subscribed := len(server.subscribers["__keyspace@2__:allowlist"])
+		server.mu.Unlock()
+		if subscribed > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("source did not subscribe to keyspace notifications")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	server.sadd(2, "allowlist", "192.0.2.50")
+
+	if got := nextSourceRange(t, cfgChan); got != "203.0.113.7,198.51.100.0/24,192.0.2.50" {
+		t.Fatalf("unexpected refreshed source ranges: %s", got)
+	}
+}
+
+func TestRedisSourceSortedSetExpiry(t *testing.T) {
+	server, addr := startFakeRedis(t, "")
+	now := float64(time.Now().Unix())
+	server.zadd(0, "temporary", "192.0.2.1", now-60)
+	server.zadd(0, "temporary", "192.0.2.2", now+1)
+	server.zadd(0, "temporary", "192.0.2.3", now+3600)
+
+	cfg := baseConfig("")
+	cfg.PollInterval = "1h"
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type:  "redis",
+		URL:   "redis://" + addr,
+		Redis: &traefikdynamicpublicwhitelist.RedisSourceConfig{Key: "temporary"},
+	}}
+
+	provider := newProvider(t, cfg)
+	cfgChan := make(chan json.Marshaler, 1)
+	if err := provider.Provide(cfgChan); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := nextSourceRange(t, cfgChan); got != "192.0.2.2,192.0.2.3" {
+		t.Fatalf("unexpected initial source ranges: %s", got)
+	}
+
+	// the earliest member expires and the source refreshes on its own
+	if got := nextSourceRange(t, cfgChan); got != "192.0.2.3" {
+		t.Fatalf("unexpected source ranges after expiry: %s", got)
+	}
+}
+
+func TestRedisSourceErrors(t *testing.T) {
+	server, addr := startFakeRedis(t, "secret")
+	server.sadd(0, "allowlist", "192.0.2.1")
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type:  "redis",
+		URL:   "redis://" + addr,
+		Redis: &traefikdynamicpublicwhitelist.RedisSourceConfig{Key: "allowlist", Password: "wrong"},
+	}}
+
+	provider := newProvider(t, cfg)
+	if _, err := provider.GenerateConfiguration(context.Background()); err == nil || !strings.Contains(err.Error(), "WRONGPASS") {
+		t.Fatalf("expected authentication error, got %v", err)
+	}
+
+	for name, source := range map[string]traefikdynamicpublicwhitelist.SourceConfig{
+		"missing key":    {Type: "redis"},
+		"invalid scheme": {Type: "redis", URL: "http://" + addr, Redis: &traefikdynamicpublicwhitelist.RedisSourceConfig{Key: "allowlist"}},
+		"invalid db":     {Type: "redis", URL: "redis://" + addr + "/first", Redis: &traefikdynamicpublicwhitelist.RedisSourceConfig{Key: "allowlist"}},
+		"negative db":    {Type: "redis", Redis: &traefikdynamicpublicwhitelist.RedisSourceConfig{Key: "allowlist", Database: -1}},
+	} {
+		cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{source}
+		if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
+
+func TestRedisSourceExpiresLastMember(t *testing.T) {
+	server, addr := startFakeRedis(t, "")
+	server.zadd(0, "temporary", "192.0.2.9", float64(time.Now().Unix()+2))
+
+	cfg := baseConfig("")
+	cfg.PollInterval = "1h"
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type:  "redis",
+		URL:   "redis://" + addr,
+		Redis: &traefikdynamicpublicwhitelist.RedisSourceConfig{Key: "temporary"},
+	}}
+
+	provider := newProvider(t, cfg)
+	cfgChan := make(chan json.Marshaler, 1)
+	if err := provider.Provide(cfgChan); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := nextSourceRange(t, cfgChan); got != "192.0.2.9" {
+		t.Fatalf("unexpected initial source ranges: %s", got)
+	}
+
+	// the expired address must not stay allowed, every client is denied instead
+	if got := nextSourceRange(t, cfgChan); got != "0.0.0.0/32" {
+		t.Fatalf("unexpected source ranges after expiry: %s", got)
+	}
+}
+
+func TestRedisSourceRejectsOversizedReplies(t *testing.T) {
+	for name, reply := range map[string]string{
+		"array":  "*2000000000\r\n",
+		"bulk":   "*1\r\n$2000000000\r\n",
+		"nested": strings.Repeat("*1\r\n", 64) + "$1\r\na\r\n",
+	} {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = listener.Close() })
+
+		// answers TYPE truthfully, then sends the hostile SMEMBERS reply and hangs up
+		go func(reply string) {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+			reader := bufio.NewReader(conn)
+			if _, err := readRESPCommand(reader); err != nil {
+				return
+			}
+			_, _ = io.WriteString(conn, "+set\r\n")
+			if _, err := readRESPCommand(reader); err != nil {
+				return
+			}
+			_, _ = io.WriteString(conn, reply)
+		}(reply)
+
+		cfg := baseConfig("")
+		cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+			Type:  "redis",
+			URL:   "redis://" + listener.Addr().String(),
+			Redis: &traefikdynamicpublicwhitelist.RedisSourceConfig{Key: "allowlist"},
+		}}
+		if _, err := newProvider(t, cfg).GenerateConfiguration(context.Background()); err == nil {
+			t.Fatalf("%s: expected the reply to be rejected", name)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sourceTypeS3 = "s3"
+
+	s3Timeout = 10 * time.Second
+)
+
+// S3SourceConfig locates an object in S3 or an S3-compatible store (MinIO, R2, Ceph).
+// The body is parsed according to format, detected from the key when empty.
+type S3SourceConfig struct {
+	Bucket string `json:"bucket,omitempty"`
+	Key    string `json:"key,omitempty"`
+	// Region defaults to AWS_REGION, then us-east-1.
+	Region string `json:"region,omitempty"`
+	// Endpoint replaces the AWS endpoint, e.g. "https://minio.internal:9000".
+	Endpoint string `json:"endpoint,omitempty"`
+	// PathStyle addresses the bucket in the path instead of the host name.
+	PathStyle bool `json:"pathStyle,omitempty"`
+
+	// Static credentials, default to AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY/AWS_SESSION_TOKEN.
+	AccessKeyID     string `json:"accessKeyID,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+	// Web identity credentials, default to AWS_ROLE_ARN/AWS_WEB_IDENTITY_TOKEN_FILE (IRSA).
+	RoleARN              string `json:"roleARN,omitempty"`
+	WebIdentityTokenFile string `json:"webIdentityTokenFile,omitempty"`
+	STSEndpoint          string `json:"stsEndpoint,omitempty"`
+}
+
+// s3Source downloads an object with SigV4 authentication. Conditional requests on the ETag
+// skip the download and parsing while the object is unchanged.
+type s3Source struct {
+	name          string
+	url           string
+	region        string
+	credentials   *awsCredentialProvider
+	parser        *documentParser
+	client        *http.Client
+	watchInterval time.Duration
+
+	mu     sync.Mutex
+	etag   string
+	ranges []labeledRange
+}
+
+func newS3Source(name string, config SourceConfig, env sourceEnv) (rangeSource, error) {
+	settings := config.S3
+	if settings == nil || strings.TrimSpace(settings.Bucket) == "" || strings.Trim(strings.TrimSpace(settings.Key), "/") == "" {
+		return nil, fmt.Errorf("s3.bucket and s3.key are required")
+	}
+
+	region := strings.TrimSpace(settings.Region)
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = defaultAWSRegion
+	}
+
+	objectURL, err := s3ObjectURL(settings, region)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: s3Timeout}
+	credentials, err := newAWSCredentialProvider(awsAuthSettings{
+		accessKeyID:          settings.AccessKeyID,
+		secretAccessKey:      settings.SecretAccessKey,
+		sessionToken:         settings.SessionToken,
+		roleARN:              settings.RoleARN,
+		webIdentityTokenFile: settings.WebIdentityTokenFile,
+		stsEndpoint:          settings.STSEndpoint,
+		region:               region,
+	}, client)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+
+	parser, err := newDocumentParser(config, env, settings.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	watchInterval, err := parseWatchInterval(config.WatchInterval)
+	if err != nil {
+		return nil, err
+	}
+
+	return &s3Source{
+		name:          name,
+		url:           objectURL,
+		region:        region,
+		credentials:   credentials,
+		parser:        parser,
+		client:        client,
+		watchInterval: watchInterval,
+	}, nil
+}
+
+// s3ObjectURL builds a virtual-hosted or path-style object URL.
+func s3ObjectURL(settings *S3SourceConfig, region string) (string, error) {
+	endpoint := strings.TrimSpace(settings.Endpoint)
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+
+	base, err := url.Parse(endpoint)
+	if err != nil || base.Host == "" {
+		return "", fmt.Errorf("s3.endpoint: invalid endpoint %q", settings.Endpoint)
+	}
+
+	bucket := strings.TrimSpace(settings.Bucket)
+	key := strings.TrimLeft(strings.TrimSpace(settings.Key), "/")
+
+	object := &url.URL{Scheme: base.Scheme, Host: base.Host}
+	if settings.PathStyle {
+		object.Path = strings.TrimSuffix(base.Path, "/") + "/" + bucket + "/" + key
+	} else {
+		object.Host = bucket + "." + base.Host
+		object.Path = strings.TrimSuffix(base.Path, "/") + "/" + key
+	}
+	// send the path exactly as it is signed
+	object.RawPath = awsCanonicalPath(object.Path)
+
+	return object.String(), nil
+}
+
+func (s *s3Source) fetch(ctx context.Context) ([]labeledRange, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp, err := s.request(ctx, http.MethodGet, s.etag)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp.Body)
+
+	if resp.StatusCode == http.StatusNotModified && s.etag != "" {
+		return s.ranges, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("s3: GET %s: %s", s.url, awsErrorMessage(resp.StatusCode, body))
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	ranges, err := s.parser.parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	s.etag = resp.Header.Get("ETag")
+	s.ranges = ranges
+
+	return ranges, nil
+}
+
+// watch polls the object's ETag with HEAD requests and refreshes when it changes.
+func (s *s3Source) watch(ctx context.Context, notify func()) {
+	if s.watchInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.watchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if s.changed(ctx) {
+				notify()
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (s *s3Source) changed(ctx context.Context) bool {
+	s.mu.Lock()
+	etag := s.etag
+	s.mu.Unlock()
+
+	resp, err := s.request(ctx, http.MethodHead, etag)
+	if err != nil {
+		if ctx.Err() == nil {
+			log.Printf("traefik_dynamic_public_whitelist: source %s: s3 HEAD: %v", s.name, err)
+		}
+		return false
+	}
+	closeBody(resp.Body)
+
+	return resp.StatusCode == http.StatusOK && resp.Header.Get("ETag") != etag
+}
+
+// request sends a signed request, conditional on etag when set.
+func (s *s3Source) request(ctx context.Context, method, etag string) (*http.Response, error) {
+	credentials, err := s.credentials.retrieve(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("s3: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	signAWSRequest(req, credentials, s.region, "s3", awsEmptyPayloadHash, time.Now())
+
+	return s.client.Do(req)
+}
@@ -0,0 +1,314 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+// fakeS3 serves one object and verifies the SigV4 signature of every request.
+type fakeS3 struct {
+	t            *testing.T
+	path         string
+	region       string
+	accessKeyID  string
+	secret       string
+	sessionToken string
+
+	mu          sync.Mutex
+	body        string
+	etag        string
+	notModified int
+}
+
+func (s *fakeS3) put(body, etag string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.body, s.etag = body, etag
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.verify(r) {
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(`<?xml version="1.0" encoding="UTF-8"?><Error><Code>SignatureDoesNotMatch</Code><Message>The request signature we calculated does not match the signature you provided.</Message></Error>`))
+		return
+	}
+	if r.URL.EscapedPath() != s.path {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`<Error><Code>NoSuchKey</Code><Message>The specified key does not exist.</Message></Error>`))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	w.Header().Set("ETag", s.etag)
+	if r.Header.Get("If-None-Match") == s.etag {
+		s.notModified++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if r.Method == http.MethodGet {
+		_, _ = w.Write([]byte(s.body))
+	}
+}
+
+// verify checks the session token and the signature.
+func (s *fakeS3) verify(r *http.Request) bool {
+	if got := r.Header.Get("X-Amz-Security-Token"); got != s.sessionToken {
+		s.t.Errorf("unexpected session token %q", got)
+	}
+
+	return verifySigV4(s.t, r, s.accessKeyID, s.secret, s.region, "s3")
+}
+
+// verifySigV4 recomputes the Signature Version 4 of a request as received.
+func verifySigV4(t *testing.T, r *http.Request, accessKeyID, secret, region, service string) bool {
+	fields := map[string]string{}
+	for _, field := range strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 "), ", ") {
+		if key, value, ok := strings.Cut(field, "="); ok {
+			fields[key] = value
+		}
+	}
+	credential := strings.Split(fields["Credential"], "/")
+	if len(credential) != 5 || credential[0] != accessKeyID || credential[2] != region || credential[3] != service {
+		t.Errorf("unexpected credential scope %q", fields["Credential"])
+		return false
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	if !strings.HasPrefix(amzDate, credential[1]) {
+		t.Errorf("X-Amz-Date %q does not match the scope date %q", amzDate, credential[1])
+		return false
+	}
+
+	var canonical strings.Builder
+	canonical.WriteString(r.Method + "\n" + r.URL.EscapedPath() + "\n" + r.URL.RawQuery + "\n")
+	signed := strings.Split(fields["SignedHeaders"], ";")
+	if !sort.StringsAreSorted(signed) {
+		t.Errorf("signed headers are not sorted: %v", signed)
+	}
+	for _, name := range signed {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonical.WriteString(name + ":" + value + "\n")
+	}
+	canonical.WriteString("\n" + fields["SignedHeaders"] + "\n" + r.Header.Get("X-Amz-Content-Sha256"))
+
+	scope := strings.Join(credential[1:], "/")
+	key := []byte("AWS4" + secret)
+	for _, part := range credential[1:] {
+		key = hmacSum(key, part)
+	}
+	hash := sha256.Sum256([]byte(canonical.String()))
+	expected := hex.EncodeToString(hmacSum(key, "AWS4-HMAC-SHA256\n"+amzDate+"\n"+scope+"\n"+hex.EncodeToString(hash[:])))
+
+	return hmac.Equal([]byte(expected), []byte(fields["Signature"]))
+}
+
+func hmacSum(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// clearAWSEnvironment keeps credentials of the machine running the tests out of the sources.
+func clearAWSEnvironment(t *testing.T) {
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_ROLE_ARN", "AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_REGION"} {
+		t.Setenv(name, "")
+	}
+}
+
+func TestS3SourcePathStyleWithStaticCredentials(t *testing.T) {
+	clearAWSEnvironment(t)
+
+	object := &fakeS3{
+		t:           t,
+		path:        "/allowlists/office%20ranges/current.txt",
+		region:      "eu-central-1",
+		accessKeyID: "AKIDEXAMPLE",
+		secret:      "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	object.put("203.0.113.0/24 # berlin\n198.51.100.7\n", `"v1"`)
+	server := httptest.NewServer(object)
+	t.Cleanup(server.Close)
+
+	cfg := baseConfig("")
+	cfg.PollInterval = "1h"
+	cfg.ConfigurationTemplate = `{"http":{"middlewares":{"public_ipwhitelist":{"ipWhiteList":{"sourceRange":{{json .SourceRange}}}},"labels":{"headers":{"customRequestHeaders":{{json .Labels}}}}}}}`
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type:          "s3",
+		WatchInterval: "50ms",
+		S3: &traefikdynamicpublicwhitelist.S3SourceConfig{
+			Bucket:          "allowlists",
+			Key:             "office ranges/current.txt",
+			Region:          "eu-central-1",
+			Endpoint:        server.URL,
+			PathStyle:       true,
+			AccessKeyID:     "AKIDEXAMPLE",
+			SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+		},
+	}}
+
+	provider := newProvider(t, cfg)
+	configuration, err := provider.GenerateConfiguration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label := configuration.HTTP.Middlewares["labels"].Headers.CustomRequestHeaders["203.0.113.0/24"]; label != "berlin" {
+		t.Fatalf("unexpected label %q", label)
+	}
+
+	// an unchanged object is answered from the cache
+	configuration, err = provider.GenerateConfiguration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ","); got != "203.0.113.0/24,198.51.100.7" {
+		t.Fatalf("unexpected cached source ranges: %s", got)
+	}
+	object.mu.Lock()
+	notModified := object.notModified
+	object.mu.Unlock()
+	if notModified == 0 {
+		t.Fatal("second fetch was not conditional on the ETag")
+	}
+
+	cfgChan := make(chan json.Marshaler, 1)
+	if err := provider.Provide(cfgChan); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := nextSourceRange(t, cfgChan); got != "203.0.113.0/24,198.51.100.7" {
+		t.Fatalf("unexpected initial source ranges: %s", got)
+	}
+
+	object.put("192.0.2.0/24\n", `"v2"`)
+
+	if got := nextSourceRange(t, cfgChan); got != "192.0.2.0/24" {
+		t.Fatalf("unexpected source ranges after the object changed: %s", got)
+	}
+}
+
+func TestS3SourceWebIdentity(t *testing.T) {
+	clearAWSEnvironment(t)
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	writeFile(t, tokenFile, "eyJhbGciOiJSUzI1NiJ9.service-account\n")
+
+	object := &fakeS3{
+		t:            t,
+		path:         "/network/egress.json",
+		region:       "us-east-1",
+		accessKeyID:  "ASIATEMPORARY",
+		secret:       "temporary-secret",
+		sessionToken: "temporary-session-token",
+	}
+	object.put(`{"ranges":["203.0.113.9"]}`, `"a1"`)
+
+	var stsCalls int
+	mux := http.NewServeMux()
+	mux.Handle("/network/", object)
+	mux.HandleFunc("/sts/", func(w http.ResponseWriter, r *http.Request) {
+		stsCalls++
+		if err := r.ParseForm(); err != nil {
+			t.Error(err)
+		}
+		if r.Method != http.MethodPost || r.PostForm.Get("Action") != "AssumeRoleWithWebIdentity" ||
+			r.PostForm.Get("RoleArn") != "arn:aws:iam::123456789012:role/whitelist" ||
+			r.PostForm.Get("WebIdentityToken") != "eyJhbGciOiJSUzI1NiJ9.service-account" {
+			t.Errorf("unexpected STS request %s %v", r.Method, r.PostForm)
+		}
+		_, _ = w.Write([]byte(`<AssumeRoleWithWebIdentityResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleWithWebIdentityResult>
+    <Credentials>
+      <AccessKeyId>ASIATEMPORARY</AccessKeyId>
+      <SecretAccessKey>temporary-secret</SecretAccessKey>
+      <SessionToken>temporary-session-token</SessionToken>
+      <Expiration>2099-01-01T00:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleWithWebIdentityResult>
+</AssumeRoleWithWebIdentityResponse>`))
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	t.Setenv("AWS_ROLE_ARN", "arn:aws:iam::123456789012:role/whitelist")
+	t.Setenv("AWS_WEB_IDENTITY_TOKEN_FILE", tokenFile)
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "s3",
+		JSON: &traefikdynamicpublicwhitelist.JSONSourceConfig{IPv4: "ranges"},
+		S3: &traefikdynamicpublicwhitelist.S3SourceConfig{
+			Bucket:      "network",
+			Key:         "egress.json",
+			Endpoint:    server.URL,
+			PathStyle:   true,
+			STSEndpoint: server.URL + "/sts",
+		},
+	}}
+
+	provider := newProvider(t, cfg)
+	for i := 0; i < 2; i++ {
+		configuration, err := provider.GenerateConfiguration(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ","); got != "203.0.113.9" {
+			t.Fatalf("unexpected source ranges: %s", got)
+		}
+	}
+	if stsCalls != 1 {
+		t.Fatalf("expected the temporary credentials to be cached, got %d STS calls", stsCalls)
+	}
+}
+
+func TestS3SourceErrors(t *testing.T) {
+	clearAWSEnvironment(t)
+
+	object := &fakeS3{t: t, path: "/allowlists/current.txt", region: "us-east-1", accessKeyID: "AKIDEXAMPLE", secret: "correct"}
+	object.put("192.0.2.1\n", `"v1"`)
+	server := httptest.NewServer(object)
+	t.Cleanup(server.Close)
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "s3",
+		S3: &traefikdynamicpublicwhitelist.S3SourceConfig{
+			Bucket: "allowlists", Key: "current.txt", Endpoint: server.URL, PathStyle: true,
+			AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wrong",
+		},
+	}}
+
+	provider := newProvider(t, cfg)
+	if _, err := provider.GenerateConfiguration(context.Background()); err == nil || !strings.Contains(err.Error(), "SignatureDoesNotMatch") {
+		t.Fatalf("expected signature error, got %v", err)
+	}
+
+	for name, source := range map[string]traefikdynamicpublicwhitelist.SourceConfig{
+		"missing bucket":      {Type: "s3", S3: &traefikdynamicpublicwhitelist.S3SourceConfig{Key: "current.txt", AccessKeyID: "a", SecretAccessKey: "b"}},
+		"missing key":         {Type: "s3", S3: &traefikdynamicpublicwhitelist.S3SourceConfig{Bucket: "allowlists", AccessKeyID: "a", SecretAccessKey: "b"}},
+		"missing credentials": {Type: "s3", S3: &traefikdynamicpublicwhitelist.S3SourceConfig{Bucket: "allowlists", Key: "current.txt"}},
+		"half credentials":    {Type: "s3", S3: &traefikdynamicpublicwhitelist.S3SourceConfig{Bucket: "allowlists", Key: "current.txt", AccessKeyID: "a"}},
+		"invalid endpoint":    {Type: "s3", S3: &traefikdynamicpublicwhitelist.S3SourceConfig{Bucket: "allowlists", Key: "current.txt", Endpoint: "http://[::1", AccessKeyID: "a", SecretAccessKey: "b"}},
+	} {
+		cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{source}
+		if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
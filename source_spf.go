@@ -0,0 +1,334 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	sourceTypeSPF = "spf"
+
+	// spfLookupLimit is the RFC 7208 section 4.6.4 limit of DNS-querying terms.
+	spfLookupLimit = 10
+	// spfMXLimit bounds the MX hosts resolved by a single mx mechanism.
+	spfMXLimit = 10
+)
+
+// SPFSourceConfig lists the domains whose SPF record is expanded into ranges.
+type SPFSourceConfig struct {
+	Domains []string `json:"domains,omitempty"`
+	// Server is the DNS server (host or host:port), defaults to the system resolver.
+	Server string `json:"server,omitempty"`
+}
+
+// spfSource expands the pass mechanisms of SPF records (ip4, ip6, a, mx, include, redirect).
+type spfSource struct {
+	name          string
+	domains       []string
+	client        *dnsClient
+	whitelistIPv6 bool
+}
+
+// spfExpansion tracks the state of one domain expansion.
+type spfExpansion struct {
+	source  *spfSource
+	lookups int
+	stack   map[string]struct{}
+	ranges  []labeledRange
+}
+
+func newSPFSource(name string, config SourceConfig, env sourceEnv) (rangeSource, error) {
+	if config.SPF == nil || len(config.SPF.Domains) == 0 {
+		return nil, fmt.Errorf("spf.domains is required")
+	}
+
+	domains := make([]string, 0, len(config.SPF.Domains))
+	for _, domain := range config.SPF.Domains {
+		domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+		if _, err := encodeDNSName(domain); err != nil {
+			return nil, fmt.Errorf("spf.domains: %w", err)
+		}
+		domains = append(domains, domain)
+	}
+
+	return &spfSource{
+		name:          name,
+		domains:       domains,
+		client:        newDNSClient(config.SPF.Server),
+		whitelistIPv6: env.whitelistIPv6,
+	}, nil
+}
+
+func (s *spfSource) fetch(ctx context.Context) ([]labeledRange, error) {
+	ranges := make([]labeledRange, 0)
+
+	for _, domain := range s.domains {
+		expansion := &spfExpansion{source: s, stack: make(map[string]struct{})}
+		if err := expansion.expand(ctx, domain); err != nil {
+			return nil, fmt.Errorf("%s: %w", domain, err)
+		}
+		ranges = append(ranges, expansion.ranges...)
+	}
+
+	return ranges, nil
+}
+
+func (e *spfExpansion) countLookup() error {
+	e.lookups++
+	if e.lookups > spfLookupLimit {
+		return fmt.Errorf("more than %d DNS lookups", spfLookupLimit)
+	}
+
+	return nil
+}
+
+func (e *spfExpansion) expand(ctx context.Context, domain string) error {
+	if _, ok := e.stack[domain]; ok {
+		return fmt.Errorf("include loop at %s", domain)
+	}
+	e.stack[domain] = struct{}{}
+	defer delete(e.stack, domain)
+
+	record, err := e.lookupRecord(ctx, domain)
+	if err != nil {
+		return err
+	}
+
+	redirect := ""
+	hasAll := false
+
+terms:
+	for _, term := range strings.Fields(record)[1:] {
+		lower := strings.ToLower(term)
+
+		if eq := strings.Index(lower, "="); eq > 0 && !strings.ContainsAny(lower[:eq], ":/") {
+			// redirect is the only modifier affecting the ranges, exp= and unknown ones are ignored
+			if lower[:eq] == "redirect" {
+				redirect = strings.TrimSuffix(term[eq+1:], ".")
+			}
+			continue
+		}
+
+		qualifier := byte('+')
+		if strings.ContainsRune("+-~?", rune(term[0])) {
+			qualifier = term[0]
+			term = term[1:]
+			lower = lower[1:]
+		}
+
+		mechanism, argument := lower, ""
+		if pos := strings.IndexAny(lower, ":/"); pos >= 0 {
+			mechanism = lower[:pos]
+			argument = term[pos:]
+		}
+
+		if strings.Contains(argument, "%") {
+			log.Printf("traefik_dynamic_public_whitelist: source %s: %s: skipping unsupported macro %q", e.source.name, domain, term)
+			if mechanism != "ip4" && mechanism != "ip6" && mechanism != "all" {
+				if err := e.countLookup(); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		switch mechanism {
+		case "all":
+			if qualifier == '+' {
+				// every host passes, the explicit ranges alone under-represent the record
+				log.Printf("traefik_dynamic_public_whitelist: source %s: %s: ignoring +all, only the listed ranges are allowed", e.source.name, domain)
+			}
+			// mechanisms after all are never tested (RFC 7208 section 5.1)
+			hasAll = true
+			break terms
+		case "ip4", "ip6":
+			if qualifier == '+' {
+				e.add(strings.TrimPrefix(argument, ":"), domain)
+			}
+		case "a", "mx":
+			if err := e.countLookup(); err != nil {
+				return err
+			}
+			target, cidr4, cidr6, err := parseSPFTarget(argument, domain)
+			if err != nil {
+				return fmt.Errorf("%s: %w", term, err)
+			}
+			if qualifier != '+' {
+				continue
+			}
+			hosts := []string{target}
+			if mechanism == "mx" {
+				if hosts, err = e.lookupMX(ctx, target); err != nil {
+					return err
+				}
+			}
+			for _, host := range hosts {
+				if err := e.addHost(ctx, host, cidr4, cidr6, domain); err != nil {
+					return err
+				}
+			}
+		case "include":
+			if err := e.countLookup(); err != nil {
+				return err
+			}
+			target := strings.TrimSuffix(strings.TrimPrefix(argument, ":"), ".")
+			if target == "" {
+				return fmt.Errorf("include without a domain")
+			}
+			if qualifier != '+' {
+				continue
+			}
+			if err := e.expand(ctx, strings.ToLower(target)); err != nil {
+				return err
+			}
+		case "exists", "ptr":
+			// match on the connecting client, they cannot be expanded into ranges
+			if err := e.countLookup(); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown mechanism %q", term)
+		}
+	}
+
+	if redirect != "" && !hasAll {
+		if err := e.countLookup(); err != nil {
+			return err
+		}
+		return e.expand(ctx, strings.ToLower(redirect))
+	}
+
+	return nil
+}
+
+// lookupRecord returns the single v=spf1 TXT record of domain.
+func (e *spfExpansion) lookupRecord(ctx context.Context, domain string) (string, error) {
+	records, err := e.source.client.query(ctx, domain, dnsTypeTXT)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", domain, err)
+	}
+
+	found := ""
+	for _, record := range records {
+		text := strings.TrimSpace(record.Text)
+		lower := strings.ToLower(text)
+		if lower != "v=spf1" && !strings.HasPrefix(lower, "v=spf1 ") {
+			continue
+		}
+		if found != "" {
+			return "", fmt.Errorf("%s: multiple SPF records", domain)
+		}
+		found = text
+	}
+
+	if found == "" {
+		return "", fmt.Errorf("%s: no SPF record", domain)
+	}
+
+	return found, nil
+}
+
+func (e *spfExpansion) lookupMX(ctx context.Context, domain string) ([]string, error) {
+	records, err := e.source.client.query(ctx, domain, dnsTypeMX)
+	if err != nil && !errors.Is(err, errDNSNotFound) {
+		return nil, fmt.Errorf("%s: %w", domain, err)
+	}
+	if len(records) > spfMXLimit {
+		return nil, fmt.Errorf("%s: more than %d MX records", domain, spfMXLimit)
+	}
+
+	hosts := make([]string, 0, len(records))
+	for _, record := range records {
+		// a null MX (RFC 7505) declares that the domain accepts no mail
+		if host := strings.TrimSuffix(record.Host, "."); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+
+	return hosts, nil
+}
+
+// addHost adds the A (and AAAA) addresses of host with the mechanism prefix lengths.
+func (e *spfExpansion) addHost(ctx context.Context, host string, cidr4, cidr6 int, domain string) error {
+	qtypes := []uint16{dnsTypeA}
+	if e.source.whitelistIPv6 {
+		qtypes = append(qtypes, dnsTypeAAAA)
+	}
+
+	for _, qtype := range qtypes {
+		records, err := e.source.client.query(ctx, host, qtype)
+		if errors.Is(err, errDNSNotFound) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %w", host, err)
+		}
+
+		for _, record := range records {
+			bits, size := cidr4, 32
+			if qtype == dnsTypeAAAA {
+				bits, size = cidr6, 128
+			}
+			if bits == size {
+				e.add(record.IP.String(), domain)
+				continue
+			}
+			e.add((&net.IPNet{IP: record.IP.Mask(net.CIDRMask(bits, size)), Mask: net.CIDRMask(bits, size)}).String(), domain)
+		}
+	}
+
+	return nil
+}
+
+func (e *spfExpansion) add(cidr, domain string) {
+	if cidr == "" {
+		return
+	}
+	e.ranges = append(e.ranges, labeledRange{CIDR: cidr, Label: domain})
+}
+
+// parseSPFTarget parses the ":domain/cidr4//cidr6" argument of a and mx mechanisms.
+func parseSPFTarget(argument, domain string) (string, int, int, error) {
+	target := domain
+	cidr4, cidr6 := 32, 128
+
+	spec := argument
+	if strings.HasPrefix(spec, ":") {
+		spec = spec[1:]
+		pos := strings.Index(spec, "/")
+		if pos < 0 {
+			pos = len(spec)
+		}
+		target = strings.ToLower(strings.TrimSuffix(spec[:pos], "."))
+		spec = spec[pos:]
+	}
+
+	if pos := strings.Index(spec, "//"); pos >= 0 {
+		bits, err := strconv.Atoi(spec[pos+2:])
+		if err != nil || bits < 0 || bits > 128 {
+			return "", 0, 0, fmt.Errorf("invalid ip6 prefix length")
+		}
+		cidr6 = bits
+		spec = spec[:pos]
+	}
+	if strings.HasPrefix(spec, "/") {
+		bits, err := strconv.Atoi(spec[1:])
+		if err != nil || bits < 0 || bits > 32 {
+			return "", 0, 0, fmt.Errorf("invalid ip4 prefix length")
+		}
+		cidr4 = bits
+	} else if spec != "" {
+		return "", 0, 0, fmt.Errorf("invalid argument %q", argument)
+	}
+
+	if target == "" {
+		return "", 0, 0, fmt.Errorf("empty domain")
+	}
+
+	return target, cidr4, cidr6, nil
+}
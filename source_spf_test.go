@@ -0,0 +1,153 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+func TestSPFSource(t *testing.T) {
+	server, _ := startDNSServer(t, map[string][]testDNSRecord{
+		"vendor.test": {
+			{Type: testDNSTypeTXT, TTL: 300, Value: "google-site-verification=abc"},
+			{Type: testDNSTypeTXT, TTL: 300, Value: "v=spf1 ip4:192.0.2.0/24 include:_spf.vendor.test a:mail.vendor.test/28 mx -ip4:10.0.0.0/8 exp=explain.vendor.test ~all"},
+			{Type: testDNSTypeMX, TTL: 300, Value: "mx1.vendor.test"},
+		},
+		"_spf.vendor.test": {
+			{Type: testDNSTypeTXT, TTL: 300, Value: "v=spf1 ip6:2001:db8::/32 redirect=_spf2.vendor.test"},
+		},
+		"_spf2.vendor.test": {
+			{Type: testDNSTypeTXT, TTL: 300, Value: "v=spf1 +ip4:198.51.100.0/24 -all"},
+		},
+		"mail.vendor.test": {
+			{Type: testDNSTypeA, TTL: 300, Value: "203.0.113.77"},
+		},
+		"mx1.vendor.test": {
+			{Type: testDNSTypeA, TTL: 300, Value: "203.0.113.200"},
+		},
+	})
+
+	cfg := baseConfig("")
+	cfg.WhitelistIPv6 = true
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "spf",
+		SPF:  &traefikdynamicpublicwhitelist.SPFSourceConfig{Domains: []string{"vendor.test"}, Server: server},
+	}}
+	cfg.ConfigurationTemplate = `{"http":{"middlewares":{"labels":{"headers":{"customRequestHeaders":{{json .Labels}}}}}}}`
+
+	middlewares := emittedMiddlewares(t, cfg)
+	headers := middlewareSection(t, middlewares, "labels", "headers")
+	labels, _ := headers["customRequestHeaders"].(map[string]interface{})
+
+	expected := map[string]string{
+		"192.0.2.0/24":    "vendor.test",
+		"2001:db8::/32":   "_spf.vendor.test",
+		"198.51.100.0/24": "_spf2.vendor.test",
+		"203.0.113.64/28": "vendor.test",
+		"203.0.113.200":   "vendor.test",
+	}
+	if len(labels) != len(expected) {
+		t.Fatalf("unexpected ranges: %v", labels)
+	}
+	for cidr, label := range expected {
+		if labels[cidr] != label {
+			t.Fatalf("label of %s: got %v want %q", cidr, labels[cidr], label)
+		}
+	}
+}
+
+func TestSPFSourceIgnoresTermsAfterAll(t *testing.T) {
+	server, _ := startDNSServer(t, map[string][]testDNSRecord{
+		"vendor.test": {{Type: testDNSTypeTXT, TTL: 300, Value: "v=spf1 ip4:192.0.2.0/24 -all ip4:198.51.100.0/24 include:missing.test"}},
+	})
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "spf",
+		SPF:  &traefikdynamicpublicwhitelist.SPFSourceConfig{Domains: []string{"vendor.test"}, Server: server},
+	}}
+
+	// the include would fail the lookup if it was evaluated
+	configuration, err := newProvider(t, cfg).GenerateConfiguration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ","); got != "192.0.2.0/24" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+}
+
+func TestSPFSourceNullMXAndPassAll(t *testing.T) {
+	server, _ := startDNSServer(t, map[string][]testDNSRecord{
+		"vendor.test": {
+			{Type: testDNSTypeTXT, TTL: 300, Value: "v=spf1 mx ip4:192.0.2.0/24 +all"},
+			{Type: testDNSTypeMX, TTL: 300, Value: "."},
+		},
+	})
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "spf",
+		SPF:  &traefikdynamicpublicwhitelist.SPFSourceConfig{Domains: []string{"vendor.test"}, Server: server},
+	}}
+
+	configuration, err := newProvider(t, cfg).GenerateConfiguration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ","); got != "192.0.2.0/24" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+	if !strings.Contains(logs.String(), "ignoring +all") {
+		t.Fatalf("expected a warning about +all, got %q", logs.String())
+	}
+}
+
+func TestSPFSourceLimits(t *testing.T) {
+	zone := map[string][]testDNSRecord{
+		"loop-a.test": {{Type: testDNSTypeTXT, TTL: 300, Value: "v=spf1 ip4:192.0.2.1 include:loop-b.test -all"}},
+		"loop-b.test": {{Type: testDNSTypeTXT, TTL: 300, Value: "v=spf1 include:loop-a.test -all"}},
+	}
+	for i := 0; i < 11; i++ {
+		zone[fmt.Sprintf("chain%d.test", i)] = []testDNSRecord{{
+			Type: testDNSTypeTXT, TTL: 300, Value: fmt.Sprintf("v=spf1 ip4:198.51.100.%d include:chain%d.test -all", i, i+1),
+		}}
+	}
+	zone["chain11.test"] = []testDNSRecord{{Type: testDNSTypeTXT, TTL: 300, Value: "v=spf1 -all"}}
+	server, _ := startDNSServer(t, zone)
+
+	for domain, message := range map[string]string{
+		"loop-a.test": "include loop",
+		"chain0.test": "more than 10 DNS lookups",
+	} {
+		cfg := baseConfig("")
+		cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+			Type: "spf",
+			SPF:  &traefikdynamicpublicwhitelist.SPFSourceConfig{Domains: []string{domain}, Server: server},
+		}}
+
+		provider := newProvider(t, cfg)
+		_, err := provider.GenerateConfiguration(context.Background())
+		if err == nil || !strings.Contains(err.Error(), message) {
+			t.Fatalf("%s: expected %q error, got %v", domain, message, err)
+		}
+	}
+}
+
+func TestSPFSourceValidation(t *testing.T) {
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "spf"}}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error without domains")
+	}
+}
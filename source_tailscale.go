@@ -0,0 +1,290 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	sourceTypeTailscale = "tailscale"
+
+	tailscaleAPILocal     = "local"
+	tailscaleAPITailscale = "tailscale"
+	tailscaleAPIHeadscale = "headscale"
+
+	defaultTailscaleSocket = "/var/run/tailscale/tailscaled.sock"
+	defaultTailscaleURL    = "https://api.tailscale.com"
+	tailscaleTimeout       = 10 * time.Second
+)
+
+// TailscaleSourceConfig selects tailnet peers whose addresses are allowed.
+type TailscaleSourceConfig struct {
+	// API is "local" (tailscaled local API, default), "tailscale" (control API) or "headscale".
+	// The control APIs are reached at the source url.
+	API string `json:"api,omitempty"`
+	// Socket is the tailscaled local API socket.
+	Socket string `json:"socket,omitempty"`
+	// Tailnet is the Tailscale control API tailnet, defaults to the API key's tailnet ("-").
+	Tailnet string `json:"tailnet,omitempty"`
+	APIKey  string `json:"apiKey,omitempty"`
+	// Tags keeps the peers carrying one of the tags ("tag:admin" or "admin"); all peers when empty.
+	Tags []string `json:"tags,omitempty"`
+	// Endpoints also allows the peers' public WireGuard endpoints. Headscale does not report them.
+	Endpoints bool `json:"endpoints,omitempty"`
+}
+
+// tailscalePeer is a peer as reported by any of the APIs.
+type tailscalePeer struct {
+	name      string
+	addresses []string
+	endpoints []string
+	tags      []string
+}
+
+// tailscaleSource lists the tailnet peers and emits their tailnet addresses, and optionally
+// their public endpoints, labelled with the peer's host name.
+type tailscaleSource struct {
+	api       string
+	url       string
+	apiKey    string
+	client    *http.Client
+	tags      map[string]struct{}
+	endpoints bool
+}
+
+func newTailscaleSource(config SourceConfig) (rangeSource, error) {
+	settings := config.Tailscale
+	if settings == nil {
+		settings = &TailscaleSourceConfig{}
+	}
+
+	source := &tailscaleSource{
+		api:       strings.ToLower(strings.TrimSpace(settings.API)),
+		apiKey:    strings.TrimSpace(settings.APIKey),
+		tags:      make(map[string]struct{}, len(settings.Tags)),
+		endpoints: settings.Endpoints,
+	}
+	for _, tag := range settings.Tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		if !strings.HasPrefix(tag, "tag:") {
+			tag = "tag:" + tag
+		}
+		source.tags[tag] = struct{}{}
+	}
+
+	switch source.api {
+	case "", tailscaleAPILocal:
+		source.api = tailscaleAPILocal
+		socket := strings.TrimSpace(settings.Socket)
+		if socket == "" {
+			socket = defaultTailscaleSocket
+		}
+		// tailscaled only answers requests addressed to this host name
+		source.url = "http://local-tailscaled.sock/localapi/v0/status"
+		source.client = &http.Client{Timeout: tailscaleTimeout, Transport: unixSocketTransport(socket)}
+		return source, nil
+	case tailscaleAPITailscale:
+		base := strings.TrimSuffix(strings.TrimSpace(config.URL), "/")
+		if base == "" {
+			base = defaultTailscaleURL
+		}
+		tailnet := strings.TrimSpace(settings.Tailnet)
+		if tailnet == "" {
+			tailnet = "-"
+		}
+		source.url = base + "/api/v2/tailnet/" + url.PathEscape(tailnet) + "/devices?fields=all"
+	case tailscaleAPIHeadscale:
+		base := strings.TrimSuffix(strings.TrimSpace(config.URL), "/")
+		if base == "" {
+			return nil, fmt.Errorf("url is required for the headscale API")
+		}
+		if settings.Endpoints {
+			return nil, fmt.Errorf("tailscale.endpoints is not supported by the headscale API")
+		}
+		source.url = base + "/api/v1/node"
+	default:
+		return nil, fmt.Errorf("tailscale.api: unsupported API %q", settings.API)
+	}
+
+	if source.apiKey == "" {
+		return nil, fmt.Errorf("tailscale.apiKey is required for the %s API", source.api)
+	}
+	source.client = &http.Client{Timeout: tailscaleTimeout}
+
+	return source, nil
+}
+
+func (s *tailscaleSource) fetch(ctx context.Context) ([]labeledRange, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if s.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: list peers: status %d", s.api, resp.StatusCode)
+	}
+
+	var peers []tailscalePeer
+	switch s.api {
+	case tailscaleAPILocal:
+		peers, err = decodeTailscaleStatus(resp)
+	case tailscaleAPITailscale:
+		peers, err = decodeTailscaleDevices(resp)
+	default:
+		peers, err = decodeHeadscaleNodes(resp)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: list peers: %w", s.api, err)
+	}
+
+	ranges := make([]labeledRange, 0)
+	for _, peer := range peers {
+		if !s.selected(peer) {
+			continue
+		}
+		for _, address := range peer.addresses {
+			ranges = append(ranges, labeledRange{CIDR: address, Label: peer.name})
+		}
+		if !s.endpoints {
+			continue
+		}
+		for _, endpoint := range peer.endpoints {
+			if ip := publicEndpointIP(endpoint); ip != "" {
+				ranges = append(ranges, labeledRange{CIDR: ip, Label: peer.name})
+			}
+		}
+	}
+
+	return ranges, nil
+}
+
+func (s *tailscaleSource) selected(peer tailscalePeer) bool {
+	if len(s.tags) == 0 {
+		return true
+	}
+	for _, tag := range peer.tags {
+		if _, ok := s.tags[tag]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// publicEndpointIP returns the host of an "ip:port" endpoint when it is publicly routable,
+// LAN, CGNAT and link-local endpoints are of no use to an allowlist.
+func publicEndpointIP(endpoint string) string {
+	host, _, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		host = endpoint
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() || sharedAddressSpace.Contains(ip) {
+		return ""
+	}
+
+	return ip.String()
+}
+
+// sharedAddressSpace is the CGNAT range (RFC 6598) tailnet addresses are taken from.
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func decodeTailscaleStatus(resp *http.Response) ([]tailscalePeer, error) {
+	var status struct {
+		Peer map[string]struct {
+			HostName     string   `json:"HostName"`
+			TailscaleIPs []string `json:"TailscaleIPs"`
+			Tags         []string `json:"Tags"`
+			CurAddr      string   `json:"CurAddr"`
+			Addrs        []string `json:"Addrs"`
+		} `json:"Peer"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+		return nil, err
+	}
+
+	peers := make([]tailscalePeer, 0, len(status.Peer))
+	for _, peer := range status.Peer {
+		endpoints := peer.Addrs
+		if peer.CurAddr != "" {
+			endpoints = append([]string{peer.CurAddr}, endpoints...)
+		}
+		peers = append(peers, tailscalePeer{name: peer.HostName, addresses: peer.TailscaleIPs, endpoints: endpoints, tags: peer.Tags})
+	}
+	// the peers are keyed by node key, keep the emitted order stable
+	sort.Slice(peers, func(i, j int) bool { return peers[i].name < peers[j].name })
+
+	return peers, nil
+}
+
+func decodeTailscaleDevices(resp *http.Response) ([]tailscalePeer, error) {
+	var response struct {
+		Devices []struct {
+			Hostname           string   `json:"hostname"`
+			Addresses          []string `json:"addresses"`
+			Tags               []string `json:"tags"`
+			ClientConnectivity struct {
+				Endpoints []string `json:"endpoints"`
+			} `json:"clientConnectivity"`
+		} `json:"devices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+
+	peers := make([]tailscalePeer, 0, len(response.Devices))
+	for _, device := range response.Devices {
+		peers = append(peers, tailscalePeer{
+			name:      device.Hostname,
+			addresses: device.Addresses,
+			endpoints: device.ClientConnectivity.Endpoints,
+			tags:      device.Tags,
+		})
+	}
+
+	return peers, nil
+}
+
+func decodeHeadscaleNodes(resp *http.Response) ([]tailscalePeer, error) {
+	var response struct {
+		Nodes []struct {
+			GivenName   string   `json:"givenName"`
+			IPAddresses []string `json:"ipAddresses"`
+			ForcedTags  []string `json:"forcedTags"`
+			ValidTags   []string `json:"validTags"`
+		} `json:"nodes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, err
+	}
+
+	peers := make([]tailscalePeer, 0, len(response.Nodes))
+	for _, node := range response.Nodes {
+		peers = append(peers, tailscalePeer{
+			name:      node.GivenName,
+			addresses: node.IPAddresses,
+			tags:      append(append([]string(nil), node.ForcedTags...), node.ValidTags...),
+		})
+	}
+
+	return peers, nil
+}
@@ -0,0 +1,135 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+func TestTailscaleSourceLocalAPI(t *testing.T) {
+	socket := startUnixHTTPServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "local-tailscaled.sock" || r.URL.Path != "/localapi/v0/status" {
+			t.Errorf("unexpected request %s%s", r.Host, r.URL.Path)
+		}
+		_, _ = w.Write([]byte(`{
+			"Self": {"HostName": "traefik", "TailscaleIPs": ["100.64.0.1"], "Tags": ["tag:admin"]},
+			"Peer": {
+				"nodekey:b": {"HostName": "laptop-bob", "TailscaleIPs": ["100.64.0.3", "fd7a:115c:a1e0::3"], "Tags": ["tag:admin"],
+					"CurAddr": "", "Addrs": ["192.168.1.20:41641", "100.100.1.1:41641", "198.51.100.23:41641"]},
+				"nodekey:a": {"HostName": "laptop-alice", "TailscaleIPs": ["100.64.0.2"], "Tags": ["tag:admin"],
+					"CurAddr": "203.0.113.50:41641", "Addrs": ["203.0.113.50:41641", "10.0.0.5:41641"]},
+				"nodekey:c": {"HostName": "build-runner", "TailscaleIPs": ["100.64.0.4"], "Tags": ["tag:ci"], "CurAddr": "192.0.2.77:41641"}
+			}
+		}`))
+	}))
+
+	cfg := baseConfig("")
+	cfg.ConfigurationTemplate = `{"http":{"middlewares":{"public_ipwhitelist":{"ipWhiteList":{"sourceRange":{{json .SourceRange}}}},"labels":{"headers":{"customRequestHeaders":{{json .Labels}}}}}}}`
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "tailscale",
+		Tailscale: &traefikdynamicpublicwhitelist.TailscaleSourceConfig{
+			Socket:    socket,
+			Tags:      []string{"admin"},
+			Endpoints: true,
+		},
+	}}
+
+	configuration, err := newProvider(t, cfg).GenerateConfiguration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// private, CGNAT and duplicate endpoints are dropped, IPv6 is disabled
+	if got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ","); got != "100.64.0.2,203.0.113.50,100.64.0.3,198.51.100.23" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+	if label := configuration.HTTP.Middlewares["labels"].Headers.CustomRequestHeaders["198.51.100.23"]; label != "laptop-bob" {
+		t.Fatalf("unexpected label %q", label)
+	}
+}
+
+func TestTailscaleSourceControlAPIs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("Authorization"); got != "Bearer api-key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/api/v2/tailnet/example.com/devices":
+			if r.URL.Query().Get("fields") != "all" {
+				t.Errorf("devices listed without endpoints")
+			}
+			_, _ = w.Write([]byte(`{"devices": [
+				{"hostname": "laptop-alice", "addresses": ["100.64.0.2"], "tags": ["tag:admin"],
+					"clientConnectivity": {"endpoints": ["203.0.113.50:41641", "[fe80::1]:41641"]}},
+				{"hostname": "printer", "addresses": ["100.64.0.9"]}
+			]}`))
+		case "/api/v1/node":
+			_, _ = w.Write([]byte(`{"nodes": [
+				{"givenName": "laptop-alice", "ipAddresses": ["100.64.0.2"], "forcedTags": [], "validTags": ["tag:admin"]},
+				{"givenName": "jump-host", "ipAddresses": ["100.64.0.5"], "forcedTags": ["tag:admin"]},
+				{"givenName": "printer", "ipAddresses": ["100.64.0.9"]}
+			]}`))
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	for name, test := range map[string]struct {
+		source   traefikdynamicpublicwhitelist.TailscaleSourceConfig
+		expected string
+	}{
+		"tailscale": {
+			source:   traefikdynamicpublicwhitelist.TailscaleSourceConfig{API: "tailscale", Tailnet: "example.com", APIKey: "api-key", Tags: []string{"tag:admin"}, Endpoints: true},
+			expected: "100.64.0.2,203.0.113.50",
+		},
+		"headscale": {
+			source:   traefikdynamicpublicwhitelist.TailscaleSourceConfig{API: "headscale", APIKey: "api-key", Tags: []string{"admin"}},
+			expected: "100.64.0.2,100.64.0.5",
+		},
+	} {
+		source := test.source
+		cfg := baseConfig("")
+		cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "tailscale", URL: server.URL, Tailscale: &source}}
+
+		configuration, err := newProvider(t, cfg).GenerateConfiguration(context.Background())
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ","); got != test.expected {
+			t.Fatalf("%s: unexpected source ranges: %s", name, got)
+		}
+	}
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type:      "tailscale",
+		URL:       server.URL,
+		Tailscale: &traefikdynamicpublicwhitelist.TailscaleSourceConfig{API: "headscale", APIKey: "revoked"},
+	}}
+	if _, err := newProvider(t, cfg).GenerateConfiguration(context.Background()); err == nil || !strings.Contains(err.Error(), "status 401") {
+		t.Fatalf("expected authorization error, got %v", err)
+	}
+}
+
+func TestTailscaleSourceErrors(t *testing.T) {
+	cfg := baseConfig("")
+	for name, source := range map[string]traefikdynamicpublicwhitelist.SourceConfig{
+		"unknown api":         {Type: "tailscale", Tailscale: &traefikdynamicpublicwhitelist.TailscaleSourceConfig{API: "zerotier"}},
+		"missing api key":     {Type: "tailscale", Tailscale: &traefikdynamicpublicwhitelist.TailscaleSourceConfig{API: "tailscale"}},
+		"missing url":         {Type: "tailscale", Tailscale: &traefikdynamicpublicwhitelist.TailscaleSourceConfig{API: "headscale", APIKey: "api-key"}},
+		"headscale endpoints": {Type: "tailscale", URL: "https://headscale.example.com", Tailscale: &traefikdynamicpublicwhitelist.TailscaleSourceConfig{API: "headscale", APIKey: "api-key", Endpoints: true}},
+	} {
+		cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{source}
+		if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const sourceTypeTerraform = "terraform"
+
+// TerraformSourceConfig selects the values read from a Terraform state (format version 4).
+type TerraformSourceConfig struct {
+	// Outputs are root module output names; IPs and CIDRs nested in lists, maps and objects are collected.
+	Outputs []string `json:"outputs,omitempty"`
+	// Resources are "[module.<name>.][data.]<type>.<name>.<attribute>" selectors, e.g.
+	// "aws_eip.*.public_ip" or "module.vpc.aws_nat_gateway.this.public_ip". Names may be "*"
+	// and the attribute may be a dotted path into nested blocks.
+	Resources []string `json:"resources,omitempty"`
+}
+
+// terraformSelector is a parsed resource selector; "*" matches any segment.
+type terraformSelector struct {
+	modules   []string
+	mode      string
+	kind      string
+	name      string
+	attribute []string
+}
+
+type terraformState struct {
+	Version int `json:"version"`
+	Outputs map[string]struct {
+		Value interface{} `json:"value"`
+	} `json:"outputs"`
+	Resources []struct {
+		Module    string `json:"module"`
+		Mode      string `json:"mode"`
+		Type      string `json:"type"`
+		Name      string `json:"name"`
+		Instances []struct {
+			IndexKey   interface{}            `json:"index_key"`
+			Attributes map[string]interface{} `json:"attributes"`
+		} `json:"instances"`
+	} `json:"resources"`
+}
+
+// terraformSource reads a state file, or a state from an HTTP backend, and emits the selected
+// outputs labelled with their name and resource attributes labelled with the instance address.
+type terraformSource struct {
+	url           string
+	path          string
+	outputs       []string
+	resources     []terraformSelector
+	watchInterval time.Duration
+	httpOpen      httpOpener
+}
+
+func newTerraformSource(config SourceConfig, env sourceEnv) (rangeSource, error) {
+	source := &terraformSource{
+		url:      strings.TrimSpace(config.URL),
+		path:     strings.TrimSpace(config.Path),
+		httpOpen: env.httpOpen,
+	}
+
+	if (source.url == "") == (source.path == "") {
+		return nil, fmt.Errorf("exactly one of url or path is required")
+	}
+	if config.Terraform == nil || (len(config.Terraform.Outputs) == 0 && len(config.Terraform.Resources) == 0) {
+		return nil, fmt.Errorf("terraform.outputs or terraform.resources is required")
+	}
+
+	for _, output := range config.Terraform.Outputs {
+		if output = strings.TrimSpace(output); output != "" {
+			source.outputs = append(source.outputs, output)
+		}
+	}
+	for _, raw := range config.Terraform.Resources {
+		selector, err := parseTerraformSelector(raw)
+		if err != nil {
+			return nil, err
+		}
+		source.resources = append(source.resources, selector)
+	}
+
+	if source.path != "" {
+		watchInterval, err := parseWatchInterval(config.WatchInterval)
+		if err != nil {
+			return nil, err
+		}
+		source.watchInterval = watchInterval
+	} else if strings.TrimSpace(config.WatchInterval) != "" {
+		return nil, fmt.Errorf("watchInterval requires path")
+	}
+
+	return source, nil
+}
+
+func parseTerraformSelector(raw string) (terraformSelector, error) {
+	parts := strings.Split(strings.TrimSpace(raw), ".")
+
+	var selector terraformSelector
+	for len(parts) >= 2 && parts[0] == "module" {
+		selector.modules = append(selector.modules, parts[1])
+		parts = parts[2:]
+	}
+	selector.mode = "managed"
+	if len(parts) > 0 && parts[0] == "data" {
+		selector.mode = "data"
+		parts = parts[1:]
+	}
+
+	if len(parts) < 3 {
+		return terraformSelector{}, fmt.Errorf("terraform.resources: invalid selector %q, expected <type>.<name>.<attribute>", raw)
+	}
+	for _, part := range parts {
+		if part == "" {
+			return terraformSelector{}, fmt.Errorf("terraform.resources: invalid selector %q", raw)
+		}
+	}
+	selector.kind, selector.name, selector.attribute = parts[0], parts[1], parts[2:]
+
+	return selector, nil
+}
+
+func (s *terraformSource) fetch(ctx context.Context) ([]labeledRange, error) {
+	var (
+		body io.ReadCloser
+		err  error
+	)
+	if s.url != "" {
+		body, err = s.httpOpen(ctx, s.url)
+	} else {
+		body, err = os.Open(s.path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closeBody(body)
+
+	var state terraformState
+	if err := json.NewDecoder(body).Decode(&state); err != nil {
+		return nil, fmt.Errorf("terraform: %w", err)
+	}
+	if state.Version != 4 {
+		return nil, fmt.Errorf("terraform: unsupported state version %d, expected 4", state.Version)
+	}
+
+	ranges := make([]labeledRange, 0)
+	for _, name := range s.outputs {
+		output, ok := state.Outputs[name]
+		if !ok {
+			return nil, fmt.Errorf("terraform: output %q not found", name)
+		}
+		// outputs are often objects mixing addresses with names and IDs, only addresses count
+		for _, value := range terraformStrings(output.Value, nil) {
+			if terraformIsRange(value) {
+				ranges = append(ranges, labeledRange{CIDR: value, Label: name})
+			}
+		}
+	}
+
+	for _, resource := range state.Resources {
+		for _, selector := range s.resources {
+			if !selector.matches(resource.Module, resource.Mode, resource.Type, resource.Name) {
+				continue
+			}
+			for _, instance := range resource.Instances {
+				address := terraformAddress(resource.Module, resource.Mode, resource.Type, resource.Name, instance.IndexKey)
+				for _, value := range terraformStrings(instance.Attributes, selector.attribute) {
+					ranges = append(ranges, labeledRange{CIDR: value, Label: address})
+				}
+			}
+		}
+	}
+
+	return ranges, nil
+}
+
+// watch polls the state file; HTTP backends are refreshed with the poll interval.
+func (s *terraformSource) watch(ctx context.Context, notify func()) {
+	pollFile(ctx, s.path, s.watchInterval, notify)
+}
+
+func (t terraformSelector) matches(module, mode, kind, name string) bool {
+	// "module.vpc[0].module.nat" -> vpc, nat
+	var modules []string
+	if module != "" {
+		parts := strings.Split(module, ".")
+		for i := 1; i < len(parts); i += 2 {
+			segment, _, _ := strings.Cut(parts[i], "[")
+			modules = append(modules, segment)
+		}
+	}
+
+	if len(modules) != len(t.modules) || mode != t.mode {
+		return false
+	}
+	for i, segment := range t.modules {
+		if segment != "*" && segment != modules[i] {
+			return false
+		}
+	}
+
+	return (t.kind == "*" || t.kind == kind) && (t.name == "*" || t.name == name)
+}
+
+// terraformAddress renders an instance address, e.g. module.vpc.aws_eip.nat["a"].
+func terraformAddress(module, mode, kind, name string, indexKey interface{}) string {
+	address := kind + "." + name
+	if mode == "data" {
+		address = "data." + address
+	}
+	if module != "" {
+		address = module + "." + address
+	}
+
+	switch key := indexKey.(type) {
+	case string:
+		address += "[" + strconv.Quote(key) + "]"
+	case float64:
+		address += "[" + strconv.FormatFloat(key, 'f', -1, 64) + "]"
+	}
+
+	return address
+}
+
+// terraformStrings follows path into value and collects every string below it. In lists a
+// path segment is an index or "*", any other segment applies to every item.
+func terraformStrings(value interface{}, path []string) []string {
+	if len(path) > 0 {
+		switch typed := value.(type) {
+		case map[string]interface{}:
+			return terraformStrings(typed[path[0]], path[1:])
+		case []interface{}:
+			if path[0] == "*" {
+				var values []string
+				for _, item := range typed {
+					values = append(values, terraformStrings(item, path[1:])...)
+				}
+				return values
+			}
+			index, err := strconv.Atoi(path[0])
+			if err != nil {
+				// nested blocks are lists, "access_config.nat_ip" reads every block
+				var values []string
+				for _, item := range typed {
+					values = append(values, terraformStrings(item, path)...)
+				}
+				return values
+			}
+			if index < 0 || index >= len(typed) {
+				return nil
+			}
+			return terraformStrings(typed[index], path[1:])
+		default:
+			return nil
+		}
+	}
+
+	switch typed := value.(type) {
+	case string:
+		if typed == "" {
+			return nil
+		}
+		return []string{typed}
+	case []interface{}:
+		var values []string
+		for _, item := range typed {
+			values = append(values, terraformStrings(item, nil)...)
+		}
+		return values
+	case map[string]interface{}:
+		keys := make([]string, 0, len(typed))
+		for key := range typed {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		var values []string
+		for _, key := range keys {
+			values = append(values, terraformStrings(typed[key], nil)...)
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+// terraformIsRange reports whether value is an IP address or CIDR.
+func terraformIsRange(value string) bool {
+	value = strings.TrimSpace(value)
+	if net.ParseIP(value) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(value)
+
+	return err == nil
+}
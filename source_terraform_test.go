@@ -0,0 +1,175 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+const terraformState = `{
+  "version": 4,
+  "terraform_version": "1.6.2",
+  "serial": 42,
+  "lineage": "8f1b7c3e-0000-4000-8000-000000000000",
+  "outputs": {
+    "vpn_egress": {"value": ["203.0.113.10", "203.0.113.11"], "type": ["list", "string"]},
+    "region": {"value": "eu-central-1", "type": "string"}
+  },
+  "resources": [
+    {"mode": "managed", "type": "aws_eip", "name": "nat", "provider": "provider[\"registry.terraform.io/hashicorp/aws\"]",
+     "instances": [
+       {"index_key": 0, "attributes": {"public_ip": "198.51.100.1", "private_ip": "10.0.1.5"}},
+       {"index_key": 1, "attributes": {"public_ip": "198.51.100.2", "private_ip": "10.0.2.5"}}
+     ]},
+    {"module": "module.edge[\"fra\"]", "mode": "managed", "type": "google_compute_instance", "name": "proxy",
+     "instances": [
+       {"attributes": {"network_interface": [{"access_config": [{"nat_ip": "192.0.2.44"}]}]}}
+     ]},
+    {"mode": "data", "type": "aws_eip", "name": "legacy",
+     "instances": [{"attributes": {"public_ip": "192.0.2.99"}}]}
+  ]
+}`
+
+func TestTerraformSourceStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "terraform.tfstate")
+	writeFile(t, path, terraformState)
+
+	cfg := baseConfig("")
+	cfg.PollInterval = "1h"
+	cfg.ConfigurationTemplate = `{"http":{"middlewares":{"public_ipwhitelist":{"ipWhiteList":{"sourceRange":{{json .SourceRange}}}},"labels":{"headers":{"customRequestHeaders":{{json .Labels}}}}}}}`
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type:          "terraform",
+		Path:          path,
+		WatchInterval: "20ms",
+		Terraform: &traefikdynamicpublicwhitelist.TerraformSourceConfig{
+			Outputs:   []string{"vpn_egress"},
+			Resources: []string{"aws_eip.*.public_ip", "module.edge.*.proxy.network_interface.access_config.nat_ip"},
+		},
+	}}
+
+	provider := newProvider(t, cfg)
+	configuration, err := provider.GenerateConfiguration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the data source is not selected by the managed resource selector
+	if got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ","); got != "203.0.113.10,203.0.113.11,198.51.100.1,198.51.100.2,192.0.2.44" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+	labels := configuration.HTTP.Middlewares["labels"].Headers.CustomRequestHeaders
+	if labels["203.0.113.11"] != "vpn_egress" || labels["198.51.100.2"] != "aws_eip.nat[1]" || labels["192.0.2.44"] != `module.edge["fra"].google_compute_instance.proxy` {
+		t.Fatalf("unexpected labels %v", labels)
+	}
+
+	cfgChan := make(chan json.Marshaler, 1)
+	if err := provider.Provide(cfgChan); err != nil {
+		t.Fatal(err)
+	}
+	if got := nextSourceRange(t, cfgChan); got != "203.0.113.10,203.0.113.11,198.51.100.1,198.51.100.2,192.0.2.44" {
+		t.Fatalf("unexpected initial source ranges: %s", got)
+	}
+
+	// a re-apply replaced the NAT addresses
+	writeFile(t, path, strings.NewReplacer("198.51.100.1", "198.51.100.101", "198.51.100.2", "198.51.100.102").Replace(terraformState))
+
+	if got := nextSourceRange(t, cfgChan); got != "203.0.113.10,203.0.113.11,198.51.100.101,198.51.100.102,192.0.2.44" {
+		t.Fatalf("unexpected source ranges after re-apply: %s", got)
+	}
+}
+
+func TestTerraformSourceHTTPBackend(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/state/network" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(terraformState))
+	}))
+	t.Cleanup(server.Close)
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type:      "terraform",
+		URL:       server.URL + "/state/network",
+		Terraform: &traefikdynamicpublicwhitelist.TerraformSourceConfig{Resources: []string{"data.aws_eip.legacy.public_ip"}},
+	}}
+
+	configuration, err := newProvider(t, cfg).GenerateConfiguration(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ","); got != "192.0.2.99" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+
+	cfg.Sources[0].Terraform = &traefikdynamicpublicwhitelist.TerraformSourceConfig{Outputs: []string{"nat_ips"}}
+	if _, err := newProvider(t, cfg).GenerateConfiguration(context.Background()); err == nil || !strings.Contains(err.Error(), `output "nat_ips" not found`) {
+		t.Fatalf("expected missing output error, got %v", err)
+	}
+}
+
+func TestTerraformSourceOutputObjects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "terraform.tfstate")
+	writeFile(t, path, `{"version": 4, "outputs": {"egress": {"value": {
+		"name": "office-nat", "id": "eipalloc-0a1b2c", "region": "eu-central-1",
+		"cidr": "198.51.100.0/28", "hosts": ["203.0.113.10", "vpn.example.com"]
+	}}}}`)
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type:      "terraform",
+		Path:      path,
+		Terraform: &traefikdynamicpublicwhitelist.TerraformSourceConfig{Outputs: []string{"egress"}},
+	}}
+
+	configuration := loadOnce(t, cfg)
+	if got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ","); got != "198.51.100.0/28,203.0.113.10" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+	// names and IDs next to the addresses are not invalid ranges
+	if strings.Contains(logs.String(), "skipping invalid range") {
+		t.Fatalf("unexpected warnings: %s", logs.String())
+	}
+}
+
+func TestTerraformSourceErrors(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "terraform.tfstate")
+	writeFile(t, path, `{"version": 3, "modules": []}`)
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type:      "terraform",
+		Path:      path,
+		Terraform: &traefikdynamicpublicwhitelist.TerraformSourceConfig{Outputs: []string{"vpn_egress"}},
+	}}
+	if _, err := newProvider(t, cfg).GenerateConfiguration(context.Background()); err == nil || !strings.Contains(err.Error(), "unsupported state version 3") {
+		t.Fatalf("expected state version error, got %v", err)
+	}
+
+	for name, source := range map[string]traefikdynamicpublicwhitelist.SourceConfig{
+		"missing selection": {Type: "terraform", Path: path, Terraform: &traefikdynamicpublicwhitelist.TerraformSourceConfig{}},
+		"url and path":      {Type: "terraform", Path: path, URL: "https://example.com/state", Terraform: &traefikdynamicpublicwhitelist.TerraformSourceConfig{Outputs: []string{"a"}}},
+		"short selector":    {Type: "terraform", Path: path, Terraform: &traefikdynamicpublicwhitelist.TerraformSourceConfig{Resources: []string{"aws_eip.public_ip"}}},
+		"empty segment":     {Type: "terraform", Path: path, Terraform: &traefikdynamicpublicwhitelist.TerraformSourceConfig{Resources: []string{"aws_eip..public_ip"}}},
+		"watch over http":   {Type: "terraform", URL: "https://example.com/state", WatchInterval: "1m", Terraform: &traefikdynamicpublicwhitelist.TerraformSourceConfig{Outputs: []string{"a"}}},
+	} {
+		cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{source}
+		if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+	}
+}
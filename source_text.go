@@ -0,0 +1,306 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	sourceTypeText = "text"
+	sourceTypeCSV  = "csv"
+
+	defaultCommentPrefix = "#"
+	// annotationMarkers separate a range from its inline annotation in text lists.
+	annotationMarkers = "#;"
+)
+
+// TextSourceConfig controls how plain text and CSV lists are parsed.
+type TextSourceConfig struct {
+	// Comment is the prefix of comment lines, defaults to "#".
+	Comment string `json:"comment,omitempty"`
+	// Delimiter switches to CSV parsing, defaults to "," for the csv type.
+	Delimiter string `json:"delimiter,omitempty"`
+	// Column (1-based) or Header select the CSV column holding the range.
+	Column int    `json:"column,omitempty"`
+	Header string `json:"header,omitempty"`
+	// LabelColumn (1-based) or LabelHeader select the CSV column kept as label.
+	LabelColumn int    `json:"labelColumn,omitempty"`
+	LabelHeader string `json:"labelHeader,omitempty"`
+	// Regex extracts ranges from each line or CSV field; a "range" named group (or the first group)
+	// holds the range and an optional "label" group the label.
+	Regex string `json:"regex,omitempty"`
+}
+
+// labeledRange is a resolved range with an optional label (annotation or provenance).
+type labeledRange struct {
+	CIDR  string
+	Label string
+}
+
+type textParser struct {
+	comment     string
+	delimiter   rune
+	column      int
+	header      string
+	labelColumn int
+	labelHeader string
+	regex       *regexp.Regexp
+}
+
+type textSource struct {
+	url     string
+	parser  *textParser
+	httpGet httpGetter
+}
+
+func newTextSource(config SourceConfig, env sourceEnv, csvDefaults bool) (rangeSource, error) {
+	if strings.TrimSpace(config.URL) == "" {
+		return nil, fmt.Errorf("url is required")
+	}
+
+	parser, err := newTextParser(config.Text, csvDefaults)
+	if err != nil {
+		return nil, err
+	}
+
+	return &textSource{url: strings.TrimSpace(config.URL), parser: parser, httpGet: env.httpGet}, nil
+}
+
+func newTextParser(config *TextSourceConfig, csvDefaults bool) (*textParser, error) {
+	if config == nil {
+		config = &TextSourceConfig{}
+	}
+
+	parser := &textParser{
+		comment:     config.Comment,
+		column:      config.Column,
+		header:      strings.TrimSpace(config.Header),
+		labelColumn: config.LabelColumn,
+		labelHeader: strings.TrimSpace(config.LabelHeader),
+	}
+
+	if parser.comment == "" {
+		parser.comment = defaultCommentPrefix
+	}
+
+	delimiter := config.Delimiter
+	if delimiter == "" && csvDefaults {
+		delimiter = ","
+	}
+	if delimiter == `\t` {
+		delimiter = "\t"
+	}
+	if delimiter != "" {
+		r, size := utf8.DecodeRuneInString(delimiter)
+		if size != len(delimiter) || r == '"' || r == '\r' || r == '\n' {
+			return nil, fmt.Errorf("text.delimiter must be a single character")
+		}
+		parser.delimiter = r
+	}
+
+	if parser.delimiter == 0 && (parser.column != 0 || parser.header != "" || parser.labelColumn != 0 || parser.labelHeader != "") {
+		return nil, fmt.Errorf("text column selection requires a delimiter")
+	}
+	if parser.column < 0 || parser.labelColumn < 0 {
+		return nil, fmt.Errorf("text columns are 1-based")
+	}
+	if parser.header != "" && parser.column != 0 {
+		return nil, fmt.Errorf("text.column and text.header are mutually exclusive")
+	}
+	if parser.column == 0 {
+		parser.column = 1
+	}
+
+	if strings.TrimSpace(config.Regex) != "" {
+		regex, err := regexp.Compile(config.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("text.regex: %w", err)
+		}
+		parser.regex = regex
+	}
+
+	return parser, nil
+}
+
+func (s *textSource) fetch(ctx context.Context) ([]labeledRange, error) {
+	body, err := s.httpGet(ctx, s.url)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.parser.parse(body)
+}
+
+func (t *textParser) parse(data []byte) ([]labeledRange, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+
+	if t.delimiter != 0 {
+		return t.parseCSV(data)
+	}
+
+	ranges := make([]labeledRange, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, t.comment) {
+			continue
+		}
+
+		if t.regex != nil {
+			ranges = append(ranges, t.extract(line, "")...)
+			continue
+		}
+
+		value, label := splitAnnotation(line, t.comment)
+		if value == "" {
+			continue
+		}
+		ranges = append(ranges, labeledRange{CIDR: value, Label: label})
+	}
+
+	return ranges, nil
+}
+
+// splitAnnotation splits "203.0.113.0/24 ; office" into the range and its annotation.
+// Any text after the first whitespace-separated field also becomes part of the label.
+func splitAnnotation(line, comment string) (string, string) {
+	label := ""
+	cut := strings.IndexAny(line, annotationMarkers)
+	if pos := strings.Index(line, comment); pos >= 0 && (cut < 0 || pos < cut) {
+		cut = pos
+	}
+	if cut >= 0 {
+		label = strings.TrimSpace(strings.TrimLeft(line[cut:], annotationMarkers+comment))
+		line = strings.TrimSpace(line[:cut])
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", label
+	}
+
+	if len(fields) > 1 {
+		rest := strings.Join(fields[1:], " ")
+		if label == "" {
+			label = rest
+		} else {
+			label = rest + " " + label
+		}
+	}
+
+	return fields[0], label
+}
+
+func (t *textParser) parseCSV(data []byte) ([]labeledRange, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.Comma = t.delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	reader.TrimLeadingSpace = true
+
+	column := t.column - 1
+	labelColumn := t.labelColumn - 1
+	needHeader := t.header != "" || t.labelHeader != ""
+
+	ranges := make([]labeledRange, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("csv: %w", err)
+		}
+
+		if len(record) == 0 || strings.HasPrefix(strings.TrimSpace(record[0]), t.comment) {
+			continue
+		}
+
+		if needHeader {
+			needHeader = false
+			if t.header != "" {
+				if column = headerIndex(record, t.header); column < 0 {
+					return nil, fmt.Errorf("csv: header %q not found", t.header)
+				}
+			}
+			if t.labelHeader != "" {
+				if labelColumn = headerIndex(record, t.labelHeader); labelColumn < 0 {
+					return nil, fmt.Errorf("csv: header %q not found", t.labelHeader)
+				}
+			}
+			continue
+		}
+
+		if column >= len(record) {
+			continue
+		}
+
+		label := ""
+		if labelColumn >= 0 && labelColumn < len(record) {
+			label = strings.TrimSpace(record[labelColumn])
+		}
+
+		value := strings.TrimSpace(record[column])
+		if t.regex != nil {
+			ranges = append(ranges, t.extract(value, label)...)
+			continue
+		}
+
+		if value != "" {
+			ranges = append(ranges, labeledRange{CIDR: value, Label: label})
+		}
+	}
+
+	return ranges, nil
+}
+
+func headerIndex(record []string, name string) int {
+	for i, field := range record {
+		if strings.EqualFold(strings.TrimSpace(field), name) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (t *textParser) extract(text, label string) []labeledRange {
+	rangeGroup := t.regex.SubexpIndex("range")
+	if rangeGroup < 0 && t.regex.NumSubexp() > 0 && t.regex.SubexpNames()[1] != "label" {
+		rangeGroup = 1
+	}
+	labelGroup := t.regex.SubexpIndex("label")
+
+	ranges := make([]labeledRange, 0, 1)
+	for _, match := range t.regex.FindAllStringSubmatch(text, -1) {
+		value := match[0]
+		if rangeGroup > 0 {
+			value = match[rangeGroup]
+		}
+
+		matchLabel := label
+		if labelGroup > 0 && match[labelGroup] != "" {
+			matchLabel = strings.TrimSpace(match[labelGroup])
+		}
+
+		if value = strings.TrimSpace(value); value != "" {
+			ranges = append(ranges, labeledRange{CIDR: value, Label: matchLabel})
+		}
+	}
+
+	return ranges
+}
+
+func unlabeled(ranges []string) []labeledRange {
+	labeled := make([]labeledRange, 0, len(ranges))
+	for _, cidr := range ranges {
+		labeled = append(labeled, labeledRange{CIDR: cidr})
+	}
+
+	return labeled
+}
@@ -0,0 +1,117 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+func TestTextSourceAnnotations(t *testing.T) {
+	list := "\ufeff# partner ranges\r\n" +
+		"203.0.113.0/24 ; office\r\n" +
+		"198.51.100.7   # vpn gateway\r\n" +
+		"192.0.2.0/24 branch berlin\r\n" +
+		"not-a-range\r\n" +
+		"\r\n"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(list))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "text", Name: "partners", URL: srv.URL}}
+	cfg.ConfigurationTemplate = `{"http":{"middlewares":{"labels":{"headers":{"customRequestHeaders":{{json .Labels}}}}}}}`
+
+	middlewares := emittedMiddlewares(t, cfg)
+	headers := middlewareSection(t, middlewares, "labels", "headers")
+	labels, _ := headers["customRequestHeaders"].(map[string]interface{})
+
+	expected := map[string]string{
+		"203.0.113.0/24": "office",
+		"198.51.100.7":   "vpn gateway",
+		"192.0.2.0/24":   "branch berlin",
+	}
+	if len(labels) != len(expected) {
+		t.Fatalf("unexpected labels: %v", labels)
+	}
+	for cidr, label := range expected {
+		if labels[cidr] != label {
+			t.Fatalf("label of %s: got %v want %q", cidr, labels[cidr], label)
+		}
+	}
+}
+
+func TestCSVSourceHeaderColumns(t *testing.T) {
+	list := "name,network,owner\n" +
+		"# disabled,10.0.0.0/8,nobody\n" +
+		"office,203.0.113.0/24,it\n" +
+		"\"lab, 2nd floor\",198.51.100.0/24,research\n"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(list))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "csv",
+		URL:  srv.URL,
+		Text: &traefikdynamicpublicwhitelist.TextSourceConfig{Header: "network", LabelHeader: "name"},
+	}}
+
+	configuration := loadOnce(t, cfg)
+
+	got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ",")
+	if got != "203.0.113.0/24,198.51.100.0/24" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+}
+
+func TestTextSourceRegexAndDelimiter(t *testing.T) {
+	list := "id;range\n1;allow from 203.0.113.10 and 203.0.113.11\n2;allow from 198.51.100.1\n"
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(list))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "text",
+		URL:  srv.URL,
+		Text: &traefikdynamicpublicwhitelist.TextSourceConfig{
+			Delimiter: ";",
+			Column:    2,
+			Regex:     `(?P<range>\d+\.\d+\.\d+\.\d+)`,
+		},
+	}}
+
+	configuration := loadOnce(t, cfg)
+
+	got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ",")
+	if got != "203.0.113.10,203.0.113.11,198.51.100.1" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+}
+
+func TestTextSourceValidation(t *testing.T) {
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type: "text",
+		URL:  "http://127.0.0.1/list.txt",
+		Text: &traefikdynamicpublicwhitelist.TextSourceConfig{Column: 2},
+	}}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error for column selection without delimiter")
+	}
+
+	cfg.Sources[0].Text = &traefikdynamicpublicwhitelist.TextSourceConfig{Regex: "("}
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error for invalid regex")
+	}
+}
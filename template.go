@@ -0,0 +1,204 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/traefik/genconf/dynamic"
+)
+
+const (
+	defaultGroup          = "public"
+	defaultMiddlewareName = "{{.Group}}_{{.Kind}}"
+
+	middlewareKindIPWhiteList = "ipwhitelist"
+	middlewareKindIPAllowList = "ipallowlist"
+	middlewareKindRateLimit   = "ratelimit"
+	middlewareKindInFlightReq = "inflightreq"
+	middlewareKindChain       = "chain"
+)
+
+var middlewareKinds = []string{
+	middlewareKindIPWhiteList,
+	middlewareKindIPAllowList,
+	middlewareKindRateLimit,
+	middlewareKindInFlightReq,
+	middlewareKindChain,
+}
+
+// NameTemplateData is the data available to the middlewareName template.
+type NameTemplateData struct {
+	// Name is the plugin provider name.
+	Name  string
+	Group string
+	// Kind is one of ipwhitelist, ipallowlist, ratelimit, inflightreq or chain.
+	Kind string
+}
+
+// TemplateData is the data available to the configurationTemplate template.
+type TemplateData struct {
+	Name                  string
+	Group                 string
+	SourceRange           []string
+	AdditionalSourceRange []string
+	// Providers holds the ranges resolved for each provider, keyed by provider name.
+	Providers map[string][]string
+	// Labels maps ranges to the annotation or provenance recorded by their source.
+	Labels          map[string]string
+	IPStrategy      dynamic.IPStrategy
+	MiddlewareNames map[string]string
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return string(raw), nil
+	},
+	"join": strings.Join,
+}
+
+// resolveMiddlewareNames renders the middleware name template for every kind,
+// requiring the emitted kinds to produce distinct, referenceable names.
+func resolveMiddlewareNames(raw, name, group string, emitted []string) (map[string]string, error) {
+	if strings.TrimSpace(raw) == "" {
+		raw = defaultMiddlewareName
+	}
+
+	tmpl, err := template.New("middlewareName").Option("missingkey=error").Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("middlewareName: %w", err)
+	}
+
+	names := make(map[string]string, len(middlewareKinds))
+	for _, kind := range middlewareKinds {
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, NameTemplateData{Name: name, Group: group, Kind: kind}); err != nil {
+			return nil, fmt.Errorf("middlewareName: %w", err)
+		}
+		names[kind] = strings.TrimSpace(b.String())
+	}
+
+	seen := make(map[string]string, len(emitted))
+	for _, kind := range emitted {
+		rendered := names[kind]
+		if rendered == "" || strings.ContainsAny(rendered, "@ \t\n") {
+			return nil, fmt.Errorf("middlewareName: invalid name %q for %s", rendered, kind)
+		}
+		if other, ok := seen[rendered]; ok {
+			return nil, fmt.Errorf("middlewareName: %s and %s both render to %q, include {{.Kind}}", other, kind, rendered)
+		}
+		seen[rendered] = kind
+	}
+
+	return names, nil
+}
+
+func parseConfigurationTemplate(raw string) (*template.Template, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	tmpl, err := template.New("configurationTemplate").Funcs(templateFuncs).Option("missingkey=error").Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("configurationTemplate: %w", err)
+	}
+
+	return tmpl, nil
+}
+
+// renderConfiguration executes the configuration template and validates the result
+// is a dynamic configuration document.
+func (p *Provider) renderConfiguration(data TemplateData) (*payload, error) {
+	var b bytes.Buffer
+	if err := p.configurationTemplate.Execute(&b, data); err != nil {
+		return nil, fmt.Errorf("configurationTemplate: %w", err)
+	}
+
+	configuration, err := decodeTemplateConfiguration(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("configurationTemplate: rendered output is not a dynamic configuration: %w", err)
+	}
+
+	if configuration.HTTP == nil && configuration.TCP == nil && configuration.UDP == nil && configuration.TLS == nil {
+		return nil, fmt.Errorf("configurationTemplate: rendered configuration is empty")
+	}
+
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, b.Bytes()); err != nil {
+		return nil, fmt.Errorf("configurationTemplate: %w", err)
+	}
+
+	result := newPayload(configuration)
+	result.raw = compact.Bytes()
+
+	return result, nil
+}
+
+// decodeTemplateConfiguration decodes a rendered template, rejecting unknown fields so a
+// misspelled key fails instead of being silently dropped. The v3 ipAllowList genconf cannot
+// model is checked against IPAllowList and removed before decoding the rest.
+func decodeTemplateConfiguration(raw []byte) (*dynamic.Configuration, error) {
+	var document map[string]interface{}
+	if err := strictUnmarshal(raw, &document); err != nil {
+		return nil, err
+	}
+
+	if httpSection, ok := document["http"].(map[string]interface{}); ok {
+		middlewares, _ := httpSection["middlewares"].(map[string]interface{})
+		for name, value := range middlewares {
+			middleware, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			// keys match case-insensitively, like encoding/json does for struct fields
+			for key, allowList := range middleware {
+				if !strings.EqualFold(key, "ipAllowList") {
+					continue
+				}
+				encoded, err := json.Marshal(allowList)
+				if err != nil {
+					return nil, err
+				}
+				if err := strictUnmarshal(encoded, &IPAllowList{}); err != nil {
+					return nil, fmt.Errorf("middleware %s: ipAllowList: %w", name, err)
+				}
+				delete(middleware, key)
+			}
+		}
+	}
+
+	stripped, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
+	}
+
+	configuration := &dynamic.Configuration{}
+	if err := strictUnmarshal(stripped, configuration); err != nil {
+		return nil, err
+	}
+
+	return configuration, nil
+}
+
+// strictUnmarshal is json.Unmarshal with unknown fields and trailing data rejected.
+func strictUnmarshal(raw []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	decoder.UseNumber()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if _, err := decoder.Token(); !errors.Is(err, io.EOF) {
+		return fmt.Errorf("unexpected data after the configuration")
+	}
+
+	return nil
+}
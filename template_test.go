@@ -0,0 +1,118 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+func TestMiddlewareNameTemplate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("198.51.100.7"))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := baseConfig(traefikdynamicpublicwhitelist.ProviderCustom)
+	cfg.IPv4Resolver = srv.URL
+	cfg.Group = "admin"
+	cfg.MiddlewareName = "{{.Name}}_{{.Group}}_{{.Kind}}"
+	cfg.InFlightReq = &traefikdynamicpublicwhitelist.InFlightReqConfig{Amount: 5}
+
+	configuration := loadOnce(t, cfg)
+	middlewares := configuration.HTTP.Middlewares
+
+	if middlewares["test_admin_ipwhitelist"] == nil || middlewares["test_admin_inflightreq"] == nil {
+		t.Fatalf("unexpected middleware names: %v", middlewares)
+	}
+
+	chain := middlewares["test_admin_chain"]
+	if chain == nil || strings.Join(chain.Chain.Middlewares, ",") != "test_admin_ipwhitelist,test_admin_inflightreq" {
+		t.Fatalf("unexpected chain: %+v", chain)
+	}
+}
+
+func TestMiddlewareNameTemplateCollision(t *testing.T) {
+	cfg := baseConfig(traefikdynamicpublicwhitelist.ProviderCustom)
+	cfg.MiddlewareName = "{{.Name}}_{{.Group}}_allow"
+	cfg.OutputSchema = traefikdynamicpublicwhitelist.OutputSchemaBoth
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected error when emitted middlewares share a name")
+	}
+
+	cfg.OutputSchema = traefikdynamicpublicwhitelist.OutputSchemaV2
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err != nil {
+		t.Fatalf("single middleware should accept a constant name: %v", err)
+	}
+}
+
+func TestConfigurationTemplate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("198.51.100.7"))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := baseConfig(traefikdynamicpublicwhitelist.ProviderCustom)
+	cfg.IPv4Resolver = srv.URL
+	cfg.AdditionalSourceRange = []string{"10.0.0.0/8"}
+	cfg.ConfigurationTemplate = `{"http":{"middlewares":{
+		"{{.Name}}_custom":{"ipAllowList":{"sourceRange":{{json (index .Providers "custom")}}}},
+		"{{.Name}}_office":{"ipWhiteList":{"sourceRange":{{json .AdditionalSourceRange}}}}
+	}}}`
+
+	middlewares := emittedMiddlewares(t, cfg)
+
+	custom := middlewareSection(t, middlewares, "test_custom", "ipAllowList")
+	ranges, _ := custom["sourceRange"].([]interface{})
+	if len(ranges) != 1 || ranges[0] != "198.51.100.7" {
+		t.Fatalf("unexpected custom ranges: %v", custom)
+	}
+
+	office := middlewareSection(t, middlewares, "test_office", "ipWhiteList")
+	ranges, _ = office["sourceRange"].([]interface{})
+	if len(ranges) != 1 || ranges[0] != "10.0.0.0/8" {
+		t.Fatalf("unexpected office ranges: %v", office)
+	}
+}
+
+func TestConfigurationTemplateValidation(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte("198.51.100.7"))
+	}))
+	t.Cleanup(srv.Close)
+
+	cfg := baseConfig(traefikdynamicpublicwhitelist.ProviderCustom)
+	cfg.ConfigurationTemplate = "{{.Unclosed"
+	if _, err := traefikdynamicpublicwhitelist.New(context.Background(), cfg, "test"); err == nil {
+		t.Fatal("expected parse error for invalid template")
+	}
+
+	cfg = baseConfig(traefikdynamicpublicwhitelist.ProviderCustom)
+	cfg.IPv4Resolver = srv.URL
+	cfg.ConfigurationTemplate = `{"http": {{.SourceRange}}}`
+
+	provider := newProvider(t, cfg)
+	if _, err := provider.GenerateConfiguration(context.Background()); err == nil {
+		t.Fatal("expected error for invalid rendered configuration")
+	}
+
+	// a misspelled key must fail instead of dropping the allow list
+	for name, tmpl := range map[string]string{
+		"misspelled middleware":  `{"http":{"middlewares":{"office":{"ipWhiteLists":{"sourceRange":{{json .SourceRange}}}}}}}`,
+		"misspelled allow list":  `{"http":{"middlewares":{"office":{"ipAllowList":{"sourceRanges":{{json .SourceRange}}}}}}}`,
+		"data after the payload": `{"http":{"middlewares":{"office":{"ipWhiteList":{"sourceRange":{{json .SourceRange}}}}}}} {}`,
+	} {
+		cfg.ConfigurationTemplate = tmpl
+		provider := newProvider(t, cfg)
+		_, err := provider.GenerateConfiguration(context.Background())
+		if err == nil {
+			t.Fatalf("%s: expected error", name)
+		}
+		if !strings.Contains(err.Error(), "not a dynamic configuration") {
+			t.Fatalf("%s: unexpected error: %v", name, err)
+		}
+	}
+}
@@ -7,13 +7,16 @@ import (
 	"crypto/rand"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/traefik/genconf/dynamic"
@@ -32,6 +35,9 @@ const (
 	defaultCloudflareIPv6Endpoint = "https://www.cloudflare.com/ips-v6/"
 	defaultFastlyEndpoint         = "https://api.fastly.com/public-ip-list"
 	defaultAwsIPRangesEndpoint    = "https://ip-ranges.amazonaws.com/ip-ranges.json"
+
+	// denyAllRange matches no client, it is emitted when every dynamic source is empty.
+	denyAllRange = "0.0.0.0/32"
 )
 
 // Exported provider identifiers for users/tests.
@@ -58,6 +64,8 @@ var (
 
 type httpGetter func(ctx context.Context, url string) ([]byte, error)
 
+type httpOpener func(ctx context.Context, url string) (io.ReadCloser, error)
+
 // Config the plugin configuration.
 type Config struct {
 	Provider              string   `json:"provider,omitempty"`
@@ -68,6 +76,28 @@ type Config struct {
 	WhitelistIPv6         bool     `json:"whitelistIPv6,omitempty"`
 	AdditionalSourceRange []string `json:"additionalSourceRange,omitempty"`
 	IPStrategy            dynamic.IPStrategy
+	// ResolverAuth authenticates the requests of the custom provider to its resolvers.
+	ResolverAuth *HTTPAuthConfig `json:"resolverAuth,omitempty"`
+	// OutputSchema selects the emitted middleware: v2 (ipWhiteList), v3 (ipAllowList) or both.
+	OutputSchema string `json:"outputSchema,omitempty"`
+	// RejectStatusCode and IPv6Subnet are Traefik v3 ipAllowList options.
+	RejectStatusCode int `json:"rejectStatusCode,omitempty"`
+	IPv6Subnet       int `json:"ipv6Subnet,omitempty"`
+	// RateLimit and InFlightReq are chained after the allowlist with the same IP strategy.
+	RateLimit   *RateLimitConfig   `json:"rateLimit,omitempty"`
+	InFlightReq *InFlightReqConfig `json:"inFlightReq,omitempty"`
+	// Routers are generated with the allowlist (or chain) middleware attached.
+	Routers []RouterConfig `json:"routers,omitempty"`
+	// Group and MiddlewareName build the emitted middleware names, see NameTemplateData.
+	Group          string `json:"group,omitempty"`
+	MiddlewareName string `json:"middlewareName,omitempty"`
+	// ConfigurationTemplate renders the whole dynamic configuration as JSON, see TemplateData.
+	ConfigurationTemplate string `json:"configurationTemplate,omitempty"`
+	// ExcludedIPsProviders feed IPStrategy.ExcludedIPs instead of the allowlist,
+	// so requests are matched on the real client behind those proxies.
+	ExcludedIPsProviders []string `json:"excludedIPsProviders,omitempty"`
+	// Sources are configurable range sources merged into the allowlist next to the providers.
+	Sources []SourceConfig `json:"sources,omitempty"`
 }
 
 // CreateConfig creates the default plugin configuration.
@@ -78,6 +108,9 @@ func CreateConfig() *Config {
 		IPv6Resolver:          "https://api6.ipify.org/?format=text",
 		WhitelistIPv6:         false,
 		AdditionalSourceRange: []string{},
+		OutputSchema:          outputSchemaV2,
+		Group:                 defaultGroup,
+		MiddlewareName:        defaultMiddlewareName,
 		IPStrategy: dynamic.IPStrategy{
 			Depth:       0,
 			ExcludedIPs: nil,
@@ -95,7 +128,21 @@ type Provider struct {
 	whitelistIPv6         bool
 	additionalSourceRange []string
 	ipStrategy            dynamic.IPStrategy
+	outputSchema          string
+	rejectStatusCode      int
+	ipv6Subnet            int
+	rateLimit             *RateLimitConfig
+	inFlightReq           *InFlightReqConfig
+	clientIPHeader        string
+	routers               []RouterConfig
+	group                 string
+	middlewareNames       map[string]string
+	configurationTemplate *template.Template
+	excludedIPsProviders  []string
+	sources               []configuredSource
 	httpGet               httpGetter
+	resolverGet           httpGetter
+	refresh               chan struct{}
 
 	baseCtx context.Context
 	cancel  func()
@@ -117,13 +164,21 @@ func New(ctx context.Context, config *Config, name string) (*Provider, error) {
 		return nil, err
 	}
 
-	providerNames, err := mergeProviders(config.Provider, config.Providers)
+	var providerNames []string
+	if hasProviderConfig(config) || (len(config.ExcludedIPsProviders) == 0 && len(config.Sources) == 0) {
+		providerNames, err = mergeProviders(config.Provider, config.Providers)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	excludedIPsProviders, err := parseExcludedIPsProviders(config, providerNames)
 	if err != nil {
 		return nil, err
 	}
 
 	hasCustom := false
-	for _, providerName := range providerNames {
+	for _, providerName := range append(append([]string(nil), providerNames...), excludedIPsProviders...) {
 		if _, ok := supportedProviders[providerName]; !ok {
 			return nil, fmt.Errorf("unsupported provider %q", providerName)
 		}
@@ -139,11 +194,90 @@ func New(ctx context.Context, config *Config, name string) (*Provider, error) {
 		if config.WhitelistIPv6 && strings.TrimSpace(config.IPv6Resolver) == "" {
 			return nil, fmt.Errorf("custom provider requires an ipv6Resolver when whitelistIPv6 is true")
 		}
+	} else if config.ResolverAuth != nil {
+		return nil, fmt.Errorf("resolverAuth requires the custom provider")
+	}
+
+	outputSchema, err := parseOutputSchema(config.OutputSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	if !schemaEmitsV3(outputSchema) && (config.RejectStatusCode != 0 || config.IPv6Subnet != 0) {
+		return nil, fmt.Errorf("rejectStatusCode and ipv6Subnet require outputSchema %q or %q", outputSchemaV3, outputSchemaBoth)
+	}
+	if config.RejectStatusCode != 0 && (config.RejectStatusCode < 100 || config.RejectStatusCode > 599) {
+		return nil, fmt.Errorf("invalid rejectStatusCode %d", config.RejectStatusCode)
+	}
+	if config.IPv6Subnet < 0 || config.IPv6Subnet > 128 {
+		return nil, fmt.Errorf("invalid ipv6Subnet %d", config.IPv6Subnet)
+	}
+
+	clientIPHeader, err := validateChain(config, providerNames, outputSchema)
+	if err != nil {
+		return nil, err
+	}
+
+	group := strings.TrimSpace(config.Group)
+	if group == "" {
+		group = defaultGroup
+	}
+
+	routers, err := validateRouters(config.Routers, outputSchema, group)
+	if err != nil {
+		return nil, err
+	}
+
+	emittedKinds := make([]string, 0, len(middlewareKinds))
+	if schemaEmitsV2(outputSchema) {
+		emittedKinds = append(emittedKinds, middlewareKindIPWhiteList)
+	}
+	if schemaEmitsV3(outputSchema) {
+		emittedKinds = append(emittedKinds, middlewareKindIPAllowList)
+	}
+	if config.RateLimit != nil {
+		emittedKinds = append(emittedKinds, middlewareKindRateLimit)
+	}
+	if config.InFlightReq != nil {
+		emittedKinds = append(emittedKinds, middlewareKindInFlightReq)
+	}
+	if config.RateLimit != nil || config.InFlightReq != nil {
+		emittedKinds = append(emittedKinds, middlewareKindChain)
+	}
+
+	middlewareNames, err := resolveMiddlewareNames(config.MiddlewareName, name, group, emittedKinds)
+	if err != nil {
+		return nil, err
+	}
+
+	configurationTemplate, err := parseConfigurationTemplate(config.ConfigurationTemplate)
+	if err != nil {
+		return nil, err
+	}
+	if configurationTemplate != nil && (len(routers) > 0 || config.RateLimit != nil || config.InFlightReq != nil) {
+		return nil, fmt.Errorf("configurationTemplate cannot be combined with routers, rateLimit or inFlightReq")
 	}
 
 	httpClient := &http.Client{Timeout: 10 * time.Second}
+	httpGet := defaultHTTPGetter(httpClient)
+	httpOpen := defaultHTTPOpener(httpClient)
 
-	return &Provider{
+	resolverGet := httpGet
+	if config.ResolverAuth != nil {
+		auth, err := newHTTPAuth(config.ResolverAuth)
+		if err != nil {
+			return nil, fmt.Errorf("resolverAuth: %w", err)
+		}
+		resolverGet = newHTTPGetter(newHTTPOpener(httpClient, auth))
+	}
+
+	reservedNames := append(append([]string(nil), providerNames...), excludedIPsProviders...)
+	sources, err := newSources(config.Sources, sourceEnv{httpClient: httpClient, httpGet: httpGet, httpOpen: httpOpen, whitelistIPv6: config.WhitelistIPv6}, reservedNames)
+	if err != nil {
+		return nil, err
+	}
+
+	provider := &Provider{
 		name:                  name,
 		providerNames:         providerNames,
 		pollInterval:          pi,
@@ -152,9 +286,32 @@ func New(ctx context.Context, config *Config, name string) (*Provider, error) {
 		whitelistIPv6:         config.WhitelistIPv6,
 		additionalSourceRange: append([]string(nil), config.AdditionalSourceRange...),
 		ipStrategy:            config.IPStrategy,
-		httpGet:               defaultHTTPGetter(httpClient),
+		outputSchema:          outputSchema,
+		rejectStatusCode:      config.RejectStatusCode,
+		ipv6Subnet:            config.IPv6Subnet,
+		clientIPHeader:        clientIPHeader,
+		routers:               routers,
+		group:                 group,
+		middlewareNames:       middlewareNames,
+		configurationTemplate: configurationTemplate,
+		excludedIPsProviders:  excludedIPsProviders,
+		sources:               sources,
+		httpGet:               httpGet,
+		resolverGet:           resolverGet,
+		refresh:               make(chan struct{}, 1),
 		baseCtx:               ctx,
-	}, nil
+	}
+
+	if config.RateLimit != nil {
+		rateLimit := *config.RateLimit
+		provider.rateLimit = &rateLimit
+	}
+	if config.InFlightReq != nil {
+		inFlightReq := *config.InFlightReq
+		provider.inFlightReq = &inFlightReq
+	}
+
+	return provider, nil
 }
 
 // Init the provider.
@@ -189,11 +346,14 @@ func (p *Provider) loadConfiguration(ctx context.Context, cfgChan chan<- json.Ma
 	defer ticker.Stop()
 
 	p.emitConfiguration(ctx, cfgChan)
+	p.startWatchers(ctx)
 
 	for {
 		select {
 		case <-ticker.C:
 			p.emitConfiguration(ctx, cfgChan)
+		case <-p.refresh:
+			p.emitConfiguration(ctx, cfgChan)
 		case <-ctx.Done():
 			return
 		}
@@ -201,13 +361,13 @@ func (p *Provider) loadConfiguration(ctx context.Context, cfgChan chan<- json.Ma
 }
 
 func (p *Provider) emitConfiguration(ctx context.Context, cfgChan chan<- json.Marshaler) {
-	configuration, err := p.generateConfiguration(ctx)
+	configuration, err := p.generatePayload(ctx)
 	if err != nil {
 		log.Printf("traefik_dynamic_public_whitelist: failed to refresh configuration: %v", err)
 		return
 	}
 
-	cfgChan <- &dynamic.JSONPayload{Configuration: configuration}
+	cfgChan <- configuration
 }
 
 // Stop to stop the provider and the related go routines.
@@ -240,11 +400,35 @@ func ipv6ToCIDR(ipv6 string) (string, error) {
 }
 
 func (p *Provider) generateConfiguration(ctx context.Context) (*dynamic.Configuration, error) {
-	sourceRange, err := p.buildSourceRanges(ctx)
+	configuration, err := p.generatePayload(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return configuration.Configuration, nil
+}
+
+func (p *Provider) generatePayload(ctx context.Context) (*payload, error) {
+	resolved, err := p.buildSourceRanges(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	if p.configurationTemplate != nil {
+		return p.renderConfiguration(TemplateData{
+			Name:                  p.name,
+			Group:                 p.group,
+			SourceRange:           resolved.sourceRange,
+			AdditionalSourceRange: p.additionalSourceRange,
+			Providers:             resolved.byProvider,
+			Labels:                resolved.labels,
+			IPStrategy:            dynamic.IPStrategy{Depth: p.ipStrategy.Depth, ExcludedIPs: resolved.excludedIPs},
+			MiddlewareNames:       p.middlewareNames,
+		})
+	}
+
+	sourceRange := resolved.sourceRange
+
 	configuration := &dynamic.Configuration{
 		HTTP: &dynamic.HTTPConfiguration{
 			Routers:           make(map[string]*dynamic.Router),
@@ -266,45 +450,128 @@ func (p *Provider) generateConfiguration(ctx context.Context) (*dynamic.Configur
 		},
 	}
 
-	configuration.HTTP.Middlewares["public_ipwhitelist"] = &dynamic.Middleware{
-		IPWhiteList: &dynamic.IPWhiteList{
-			SourceRange: sourceRange,
-			IPStrategy: &dynamic.IPStrategy{
-				Depth:       p.ipStrategy.Depth,
-				ExcludedIPs: p.ipStrategy.ExcludedIPs,
+	result := newPayload(configuration)
+
+	if schemaEmitsV2(p.outputSchema) {
+		configuration.HTTP.Middlewares[p.middlewareNames[middlewareKindIPWhiteList]] = &dynamic.Middleware{
+			IPWhiteList: &dynamic.IPWhiteList{
+				SourceRange: sourceRange,
+				IPStrategy:  p.ipStrategyV2(resolved),
 			},
-		},
+		}
 	}
 
-	return configuration, nil
+	if schemaEmitsV3(p.outputSchema) {
+		result.setMiddlewareField(p.middlewareNames[middlewareKindIPAllowList], "ipAllowList", &IPAllowList{
+			SourceRange:      sourceRange,
+			IPStrategy:       p.ipStrategyV3(resolved),
+			RejectStatusCode: p.rejectStatusCode,
+		})
+	}
+
+	allowListName := p.middlewareNames[middlewareKindIPWhiteList]
+	if p.outputSchema == outputSchemaV3 {
+		allowListName = p.middlewareNames[middlewareKindIPAllowList]
+	}
+	routerMiddleware := p.addChainMiddlewares(result, resolved, allowListName)
+	p.addRouters(configuration, routerMiddleware)
+
+	return result, nil
+}
+
+func (p *Provider) ipStrategyV2(resolved *resolvedRanges) *dynamic.IPStrategy {
+	return &dynamic.IPStrategy{
+		Depth:       p.ipStrategy.Depth,
+		ExcludedIPs: resolved.excludedIPs,
+	}
+}
+
+func (p *Provider) ipStrategyV3(resolved *resolvedRanges) *IPStrategyV3 {
+	return &IPStrategyV3{
+		Depth:       p.ipStrategy.Depth,
+		ExcludedIPs: resolved.excludedIPs,
+		IPv6Subnet:  p.ipv6Subnet,
+	}
 }
 
 // GenerateConfiguration exposes generateConfiguration for testing and advanced scenarios.
+// Middlewares genconf cannot model (such as the v3 ipAllowList) are missing from the result,
+// GenerateDocument returns the complete configuration.
 func (p *Provider) GenerateConfiguration(ctx context.Context) (*dynamic.Configuration, error) {
 	return p.generateConfiguration(ctx)
 }
 
-func (p *Provider) buildSourceRanges(ctx context.Context) ([]string, error) {
-	providerRanges, err := p.fetchProviderRanges(ctx)
+// GenerateDocument returns the JSON configuration exactly as Provide pushes it to Traefik,
+// including the middlewares genconf cannot model.
+func (p *Provider) GenerateDocument(ctx context.Context) ([]byte, error) {
+	configuration, err := p.generatePayload(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(configuration)
+}
+
+// resolvedRanges is the outcome of one refresh of every provider.
+type resolvedRanges struct {
+	sourceRange []string
+	excludedIPs []string
+	byProvider  map[string][]string
+	labels      map[string]string
+}
+
+func (p *Provider) buildSourceRanges(ctx context.Context) (*resolvedRanges, error) {
+	byProvider := make(map[string][]string, len(p.providerNames)+len(p.excludedIPsProviders))
+
+	providerRanges, err := p.fetchProviderRanges(ctx, p.providerNames, p.whitelistIPv6, byProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make(map[string]string)
+	sourceRanges, err := p.fetchSourceRanges(ctx, byProvider, labels)
 	if err != nil {
 		return nil, err
 	}
 
 	sourceRange := append([]string{}, p.additionalSourceRange...)
 	sourceRange = append(sourceRange, providerRanges...)
+	sourceRange = appendUnique(sourceRange, sourceRanges)
 
 	if len(sourceRange) == 0 {
-		return nil, fmt.Errorf("no source ranges resolved")
+		// only dynamic sources may come back empty; Traefik rejects an empty sourceRange,
+		// so deny every client instead of keeping the previous, stale allowlist
+		if len(p.sources) == 0 {
+			return nil, fmt.Errorf("no source ranges resolved")
+		}
+		log.Printf("traefik_dynamic_public_whitelist: every source is empty, denying all clients")
+		sourceRange = []string{denyAllRange}
+	}
+
+	// proxies reach Traefik over IPv6 even when only IPv4 clients are allowed
+	excludedRanges, err := p.fetchProviderRanges(ctx, p.excludedIPsProviders, true, byProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	excludedIPs := p.ipStrategy.ExcludedIPs
+	if len(excludedRanges) > 0 {
+		excludedIPs = append(append([]string{}, p.ipStrategy.ExcludedIPs...), excludedRanges...)
 	}
 
-	return sourceRange, nil
+	return &resolvedRanges{sourceRange: sourceRange, excludedIPs: excludedIPs, byProvider: byProvider, labels: labels}, nil
 }
 
-func (p *Provider) fetchProviderRanges(ctx context.Context) ([]string, error) {
+// fetchProviderRanges resolves providerNames, including their IPv6 ranges when ipv6 is set.
+func (p *Provider) fetchProviderRanges(ctx context.Context, providerNames []string, ipv6 bool, byProvider map[string][]string) ([]string, error) {
+	if len(providerNames) == 0 {
+		return nil, nil
+	}
+
 	seen := make(map[string]struct{})
 	combined := make([]string, 0)
 
-	for _, providerName := range p.providerNames {
+	for _, providerName := range providerNames {
 		var (
 			ranges []string
 			err    error
@@ -312,13 +579,14 @@ func (p *Provider) fetchProviderRanges(ctx context.Context) ([]string, error) {
 
 		switch providerName {
 		case providerCloudflare:
-			ranges, err = p.fetchCloudflareRanges(ctx)
+			ranges, err = p.fetchCloudflareRanges(ctx, ipv6)
 		case providerFastly:
-			ranges, err = p.fetchFastlyRanges(ctx)
+			ranges, err = p.fetchFastlyRanges(ctx, ipv6)
 		case providerCloudfront:
-			ranges, err = p.fetchCloudfrontRanges(ctx)
+			ranges, err = p.fetchCloudfrontRanges(ctx, ipv6)
 		case providerCustom:
-			ranges, err = p.fetchCustomRanges(ctx)
+			// the ipv6Resolver is only required when IPv6 clients are allowed
+			ranges, err = p.fetchCustomRanges(ctx, ipv6 && (p.whitelistIPv6 || strings.TrimSpace(p.ipv6Resolver) != ""))
 		default:
 			err = fmt.Errorf("unsupported provider %q", providerName)
 		}
@@ -327,27 +595,48 @@ func (p *Provider) fetchProviderRanges(ctx context.Context) ([]string, error) {
 			return nil, err
 		}
 
+		resolved := make([]string, 0, len(ranges))
 		for _, cidr := range ranges {
 			cidr = strings.TrimSpace(cidr)
 			if cidr == "" {
 				continue
 			}
+			resolved = append(resolved, cidr)
 			if _, ok := seen[cidr]; ok {
 				continue
 			}
 			seen[cidr] = struct{}{}
 			combined = append(combined, cidr)
 		}
+		byProvider[providerName] = resolved
 	}
 
 	if len(combined) == 0 {
-		return nil, fmt.Errorf("no ranges resolved from providers %v", p.providerNames)
+		return nil, fmt.Errorf("no ranges resolved from providers %v", providerNames)
 	}
 
 	return combined, nil
 }
 
-func (p *Provider) fetchCloudflareRanges(ctx context.Context) ([]string, error) {
+// appendUnique appends the ranges of extra not already present in ranges.
+func appendUnique(ranges, extra []string) []string {
+	seen := make(map[string]struct{}, len(ranges))
+	for _, cidr := range ranges {
+		seen[cidr] = struct{}{}
+	}
+
+	for _, cidr := range extra {
+		if _, ok := seen[cidr]; ok {
+			continue
+		}
+		seen[cidr] = struct{}{}
+		ranges = append(ranges, cidr)
+	}
+
+	return ranges
+}
+
+func (p *Provider) fetchCloudflareRanges(ctx context.Context, ipv6 bool) ([]string, error) {
 	body, err := p.httpGet(ctx, cloudflareIPv4Endpoint)
 	if err != nil {
 		return nil, err
@@ -358,7 +647,7 @@ func (p *Provider) fetchCloudflareRanges(ctx context.Context) ([]string, error)
 		return nil, fmt.Errorf("cloudflare: empty IPv4 range list")
 	}
 
-	if p.whitelistIPv6 {
+	if ipv6 {
 		body6, err := p.httpGet(ctx, cloudflareIPv6Endpoint)
 		if err != nil {
 			return nil, err
@@ -369,7 +658,7 @@ func (p *Provider) fetchCloudflareRanges(ctx context.Context) ([]string, error)
 	return ranges, nil
 }
 
-func (p *Provider) fetchFastlyRanges(ctx context.Context) ([]string, error) {
+func (p *Provider) fetchFastlyRanges(ctx context.Context, ipv6 bool) ([]string, error) {
 	body, err := p.httpGet(ctx, fastlyEndpoint)
 	if err != nil {
 		return nil, err
@@ -389,14 +678,14 @@ func (p *Provider) fetchFastlyRanges(ctx context.Context) ([]string, error) {
 		return nil, fmt.Errorf("fastly: empty IPv4 addresses list")
 	}
 
-	if p.whitelistIPv6 {
+	if ipv6 {
 		ranges = append(ranges, payload.IPv6Addresses...)
 	}
 
 	return ranges, nil
 }
 
-func (p *Provider) fetchCloudfrontRanges(ctx context.Context) ([]string, error) {
+func (p *Provider) fetchCloudfrontRanges(ctx context.Context, ipv6 bool) ([]string, error) {
 	body, err := p.httpGet(ctx, awsIPRangesEndpoint)
 	if err != nil {
 		return nil, err
@@ -428,7 +717,7 @@ func (p *Provider) fetchCloudfrontRanges(ctx context.Context) ([]string, error)
 		return nil, fmt.Errorf("cloudfront: empty IPv4 prefix set")
 	}
 
-	if p.whitelistIPv6 {
+	if ipv6 {
 		for _, prefix := range payload.IPv6Prefixes {
 			if prefix.Service == awsCloudfrontLabel {
 				ranges = append(ranges, strings.TrimSpace(prefix.IPv6Prefix))
@@ -439,12 +728,12 @@ func (p *Provider) fetchCloudfrontRanges(ctx context.Context) ([]string, error)
 	return ranges, nil
 }
 
-func (p *Provider) fetchCustomRanges(ctx context.Context) ([]string, error) {
+func (p *Provider) fetchCustomRanges(ctx context.Context, ipv6 bool) ([]string, error) {
 	if strings.TrimSpace(p.ipv4Resolver) == "" {
 		return nil, fmt.Errorf("custom provider requires an ipv4Resolver")
 	}
 
-	body, err := p.httpGet(ctx, p.ipv4Resolver)
+	body, err := p.resolverGet(ctx, p.ipv4Resolver)
 	if err != nil {
 		return nil, err
 	}
@@ -456,12 +745,12 @@ func (p *Provider) fetchCustomRanges(ctx context.Context) ([]string, error) {
 
 	ranges := []string{ipv4}
 
-	if p.whitelistIPv6 {
+	if ipv6 {
 		if strings.TrimSpace(p.ipv6Resolver) == "" {
 			return nil, fmt.Errorf("custom provider requires an ipv6Resolver when whitelistIPv6 is true")
 		}
 
-		body6, err := p.httpGet(ctx, p.ipv6Resolver)
+		body6, err := p.resolverGet(ctx, p.ipv6Resolver)
 		if err != nil {
 			return nil, err
 		}
@@ -483,44 +772,74 @@ func (p *Provider) fetchCustomRanges(ctx context.Context) ([]string, error) {
 }
 
 func parseLineList(data []byte) []string {
-	lines := strings.Split(string(data), "\n")
-	results := make([]string, 0, len(lines))
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		results = append(results, line)
+	parser := &textParser{comment: defaultCommentPrefix}
+
+	// without a delimiter or regex the text parser cannot fail
+	ranges, _ := parser.parse(data)
+
+	results := make([]string, 0, len(ranges))
+	for _, entry := range ranges {
+		results = append(results, entry.CIDR)
 	}
 
 	return results
 }
 
 func defaultHTTPGetter(client *http.Client) httpGetter {
+	return newHTTPGetter(defaultHTTPOpener(client))
+}
+
+// newHTTPGetter reads the whole response body of open.
+func newHTTPGetter(open httpOpener) httpGetter {
 	return func(ctx context.Context, url string) ([]byte, error) {
-		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		body, err := open(ctx, url)
 		if err != nil {
 			return nil, err
 		}
+		defer closeBody(body)
 
-		req.Header.Set("X-Kes-RequestID", requestIDGenerator())
+		return io.ReadAll(body)
+	}
+}
 
-		resp, err := client.Do(req)
+// defaultHTTPOpener returns the response body unread so large documents can be streamed.
+func defaultHTTPOpener(client *http.Client) httpOpener {
+	return newHTTPOpener(client, nil)
+}
+
+// newHTTPOpener is defaultHTTPOpener with requests authenticated by auth, when set.
+// Errors never carry the secrets of auth nor credentials of the URL.
+func newHTTPOpener(client *http.Client, auth *httpAuth) httpOpener {
+	if auth != nil {
+		client = auth.client(client)
+	}
+
+	return func(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
 		if err != nil {
-			return nil, err
+			return nil, &redactedError{message: auth.redact(err.Error()), err: err}
 		}
-		defer closeBody(resp.Body)
 
-		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-			return nil, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, url)
+		req.Header.Set("X-Kes-RequestID", requestIDGenerator())
+		if auth != nil {
+			auth.apply(req, nil, time.Now())
 		}
 
-		body, err := io.ReadAll(resp.Body)
+		resp, err := client.Do(req)
 		if err != nil {
-			return nil, err
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				urlErr.URL = redactURL(urlErr.URL)
+			}
+			return nil, &redactedError{message: auth.redact(err.Error()), err: err}
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			closeBody(resp.Body)
+			return nil, fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, redactURL(rawURL))
 		}
 
-		return body, nil
+		return resp.Body, nil
 	}
 }
 
@@ -0,0 +1,478 @@
+package traefik_dynamic_public_whitelist
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlLine is a significant line of a YAML document.
+type yamlLine struct {
+	number int
+	indent int
+	text   string
+	raw    string
+}
+
+// parseYAML decodes the YAML subset used by range files and kubeconfigs into the same
+// generic tree encoding/json produces: block mappings and sequences, plain/quoted scalars,
+// flow sequences and mappings, literal/folded block scalars and comments.
+// Anchors, aliases, tags, duplicate keys and multi-document streams are rejected.
+func parseYAML(data []byte) (interface{}, error) {
+	text := strings.TrimPrefix(string(data), "\ufeff")
+	rawLines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	lines := make([]yamlLine, 0, len(rawLines))
+	for i, raw := range rawLines {
+		content := strings.TrimRight(stripYAMLComment(raw), " \t")
+		trimmed := strings.TrimLeft(content, " ")
+		if trimmed == "---" && len(lines) > 0 {
+			return nil, fmt.Errorf("yaml: line %d: multi-document streams are not supported", i+1)
+		}
+		if trimmed == "" || trimmed == "---" || trimmed == "..." {
+			if trimmed == "" && len(lines) > 0 {
+				// blank lines only matter inside block scalars
+				lines = append(lines, yamlLine{number: i + 1, indent: -1, raw: raw})
+			}
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("yaml: line %d: tabs are not allowed for indentation", i+1)
+		}
+		lines = append(lines, yamlLine{number: i + 1, indent: len(content) - len(trimmed), text: trimmed, raw: raw})
+	}
+
+	parser := &yamlParser{lines: lines}
+	parser.skipBlank()
+	if parser.pos >= len(parser.lines) {
+		return nil, nil
+	}
+
+	value, err := parser.parseNode(parser.lines[parser.pos].indent)
+	if err != nil {
+		return nil, err
+	}
+
+	parser.skipBlank()
+	if parser.pos < len(parser.lines) {
+		return nil, fmt.Errorf("yaml: line %d: unexpected content", parser.lines[parser.pos].number)
+	}
+
+	return value, nil
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func (y *yamlParser) skipBlank() {
+	for y.pos < len(y.lines) && y.lines[y.pos].indent < 0 {
+		y.pos++
+	}
+}
+
+func (y *yamlParser) parseNode(indent int) (interface{}, error) {
+	y.skipBlank()
+	line := y.lines[y.pos]
+
+	if isYAMLSequenceItem(line.text) {
+		return y.parseSequence(indent)
+	}
+	if _, _, ok := splitYAMLKey(line.text); ok {
+		return y.parseMapping(indent)
+	}
+
+	y.pos++
+	return parseYAMLScalar(line.text, line.number)
+}
+
+func (y *yamlParser) parseSequence(indent int) (interface{}, error) {
+	items := make([]interface{}, 0)
+
+	for {
+		y.skipBlank()
+		if y.pos >= len(y.lines) {
+			break
+		}
+		line := y.lines[y.pos]
+		if line.indent != indent || !isYAMLSequenceItem(line.text) {
+			if line.indent > indent {
+				return nil, fmt.Errorf("yaml: line %d: unexpected indentation", line.number)
+			}
+			break
+		}
+
+		content := strings.TrimLeft(line.text[1:], " ")
+		if content == "" {
+			y.pos++
+			value, err := y.parseChild(indent, false)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+			continue
+		}
+
+		// "- key: value" and "- - nested" open a node indented at the item content
+		offset := len(line.text) - len(content)
+		y.lines[y.pos].indent = indent + offset
+		y.lines[y.pos].text = content
+
+		value, err := y.parseNode(indent + offset)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, value)
+	}
+
+	return items, nil
+}
+
+func (y *yamlParser) parseMapping(indent int) (interface{}, error) {
+	mapping := make(map[string]interface{})
+
+	for {
+		y.skipBlank()
+		if y.pos >= len(y.lines) {
+			break
+		}
+		line := y.lines[y.pos]
+		if line.indent != indent {
+			if line.indent > indent {
+				return nil, fmt.Errorf("yaml: line %d: unexpected indentation", line.number)
+			}
+			break
+		}
+
+		key, rest, ok := splitYAMLKey(line.text)
+		if !ok {
+			return nil, fmt.Errorf("yaml: line %d: expected a mapping key", line.number)
+		}
+		y.pos++
+
+		var (
+			value interface{}
+			err   error
+		)
+
+		switch {
+		case rest == "":
+			value, err = y.parseChild(indent, true)
+		case rest[0] == '|' || rest[0] == '>':
+			value = y.parseBlockScalar(indent, rest)
+		default:
+			value, err = parseYAMLScalar(rest, line.number)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := mapping[key]; ok {
+			return nil, fmt.Errorf("yaml: line %d: duplicate key %q", line.number, key)
+		}
+		mapping[key] = value
+	}
+
+	return mapping, nil
+}
+
+// parseChild parses the block nested under a key or an empty sequence item.
+// Mapping values may hold a sequence at the same indentation as the key.
+func (y *yamlParser) parseChild(indent int, allowSameIndentSequence bool) (interface{}, error) {
+	y.skipBlank()
+	if y.pos >= len(y.lines) {
+		return nil, nil
+	}
+
+	next := y.lines[y.pos]
+	if next.indent > indent || (allowSameIndentSequence && next.indent == indent && isYAMLSequenceItem(next.text)) {
+		return y.parseNode(next.indent)
+	}
+
+	return nil, nil
+}
+
+func (y *yamlParser) parseBlockScalar(indent int, header string) string {
+	folded := header[0] == '>'
+	keep := strings.Contains(header, "+")
+	strip := strings.Contains(header, "-")
+
+	blockLines := make([]string, 0)
+	blockIndent := -1
+
+	for y.pos < len(y.lines) {
+		line := y.lines[y.pos]
+		if line.indent >= 0 && line.indent <= indent {
+			break
+		}
+		y.pos++
+
+		if line.indent < 0 {
+			blockLines = append(blockLines, "")
+			continue
+		}
+		if blockIndent < 0 {
+			blockIndent = line.indent
+		}
+
+		raw := strings.TrimRight(line.raw, "\r")
+		if len(raw) >= blockIndent {
+			raw = raw[blockIndent:]
+		}
+		blockLines = append(blockLines, raw)
+	}
+
+	trailing := 0
+	for len(blockLines) > 0 && blockLines[len(blockLines)-1] == "" {
+		blockLines = blockLines[:len(blockLines)-1]
+		trailing++
+	}
+
+	separator := "\n"
+	if folded {
+		separator = " "
+	}
+	value := strings.Join(blockLines, separator)
+
+	switch {
+	case strip:
+	case keep:
+		value += strings.Repeat("\n", trailing+1)
+	default:
+		value += "\n"
+	}
+
+	return value
+}
+
+func isYAMLSequenceItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits "key: value" outside quotes and flow collections.
+func splitYAMLKey(text string) (string, string, bool) {
+	i := yamlKeyColon(text)
+	if i < 0 {
+		return "", "", false
+	}
+
+	key := strings.TrimSpace(text[:i])
+	if unquoted, err := unquoteYAML(key); err == nil {
+		key = unquoted
+	}
+
+	return key, strings.TrimSpace(text[i+1:]), true
+}
+
+// yamlKeyColon returns the position of the colon ending a mapping key, or -1.
+func yamlKeyColon(text string) int {
+	if text == "" || text[0] == '[' || text[0] == '{' {
+		return -1
+	}
+
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && i == 0:
+			quote = c
+		case c == ':' && (i+1 == len(text) || text[i+1] == ' '):
+			return i
+		}
+	}
+
+	return -1
+}
+
+func stripYAMLComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			if i == 0 || strings.ContainsRune(" \t:[{,-", rune(line[i-1])) {
+				quote = c
+			}
+		case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+
+	return line
+}
+
+func parseYAMLScalar(text string, number int) (interface{}, error) {
+	value, err := yamlValue(text)
+	if err != nil {
+		return nil, fmt.Errorf("yaml: line %d: %w", number, err)
+	}
+
+	return value, nil
+}
+
+// yamlValue parses a scalar or flow collection on a single line.
+func yamlValue(text string) (interface{}, error) {
+	text = strings.TrimSpace(text)
+
+	switch {
+	case text == "":
+		return nil, nil
+	case text[0] == '[' || text[0] == '{':
+		value, rest, err := parseYAMLFlow(text)
+		if err != nil {
+			return nil, err
+		}
+		if strings.TrimSpace(rest) != "" {
+			return nil, fmt.Errorf("unexpected %q after flow collection", rest)
+		}
+		return value, nil
+	case text[0] == '"' || text[0] == '\'':
+		return unquoteYAML(text)
+	case text[0] == '&' || text[0] == '*' || text[0] == '!':
+		return nil, fmt.Errorf("anchors, aliases and tags are not supported: %q", text)
+	}
+
+	switch strings.ToLower(text) {
+	case "~", "null":
+		return nil, nil
+	case "true", "yes", "on":
+		return true, nil
+	case "false", "no", "off":
+		return false, nil
+	}
+
+	if number, err := strconv.ParseFloat(text, 64); err == nil && !strings.ContainsAny(text, "xXoObB_") {
+		return number, nil
+	}
+
+	return text, nil
+}
+
+func unquoteYAML(text string) (string, error) {
+	if len(text) < 2 || (text[0] != '"' && text[0] != '\'') {
+		return text, nil
+	}
+	if text[len(text)-1] != text[0] {
+		return "", fmt.Errorf("unterminated string %s", text)
+	}
+	if text[0] == '\'' {
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	}
+
+	return strconv.Unquote(text)
+}
+
+// parseYAMLFlow parses a flow sequence or mapping, returning the unparsed remainder.
+func parseYAMLFlow(text string) (interface{}, string, error) {
+	open := text[0]
+	closing := byte(']')
+	if open == '{' {
+		closing = '}'
+	}
+
+	rest := strings.TrimLeft(text[1:], " ")
+	sequence := make([]interface{}, 0)
+	mapping := make(map[string]interface{})
+
+	for {
+		if rest == "" {
+			return nil, "", fmt.Errorf("unterminated flow collection")
+		}
+		if rest[0] == closing {
+			if open == '{' {
+				return mapping, rest[1:], nil
+			}
+			return sequence, rest[1:], nil
+		}
+
+		var (
+			item interface{}
+			err  error
+		)
+
+		if open == '{' {
+			var key string
+			key, rest, err = flowMappingKey(rest, closing)
+			if err != nil {
+				return nil, "", err
+			}
+			if _, ok := mapping[key]; ok {
+				return nil, "", fmt.Errorf("duplicate key %q", key)
+			}
+			mapping[key], rest, err = flowItem(rest, closing)
+		} else {
+			item, rest, err = flowItem(rest, closing)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		if open == '[' {
+			sequence = append(sequence, item)
+		}
+
+		rest = strings.TrimLeft(rest, " ")
+		if strings.HasPrefix(rest, ",") {
+			rest = strings.TrimLeft(rest[1:], " ")
+		}
+	}
+}
+
+// flowItem parses the value at the start of text, a nested collection or a scalar.
+func flowItem(text string, closing byte) (interface{}, string, error) {
+	if text != "" && (text[0] == '[' || text[0] == '{') {
+		return parseYAMLFlow(text)
+	}
+
+	end := flowItemEnd(text, closing)
+	value, err := yamlValue(text[:end])
+
+	return value, text[end:], err
+}
+
+// flowMappingKey splits the "key:" of a flow mapping entry; a key without value maps to null.
+func flowMappingKey(text string, closing byte) (string, string, error) {
+	end := flowItemEnd(text, closing)
+	colon := yamlKeyColon(text[:end])
+	if colon < 0 {
+		key, err := unquoteYAML(strings.TrimSpace(text[:end]))
+		return key, text[end:], err
+	}
+
+	key, err := unquoteYAML(strings.TrimSpace(text[:colon]))
+
+	// the value may be a nested collection spanning separators
+	return key, strings.TrimLeft(text[colon+1:], " "), err
+}
+
+func flowItemEnd(text string, closing byte) int {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',' || c == closing:
+			return i
+		}
+	}
+
+	return len(text)
+}
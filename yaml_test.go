@@ -0,0 +1,180 @@
+package traefik_dynamic_public_whitelist_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	traefikdynamicpublicwhitelist "github.com/KCL-Electronics/traefik-cdn-whitelist/v2"
+)
+
+func TestFileSourceYAMLDocuments(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		document string
+		ipv4     string
+		ipv6     string
+		expected string
+	}{
+		{
+			name:     "block mapping scalars",
+			document: "office:\n  cidr: 192.0.2.1\n  enabled: true\n  count: 3\n  ratio: 0.5\n  missing: ~\n",
+			ipv4:     `[?(enabled==true && count==3 && ratio==0.5 && missing==null)].cidr`,
+			expected: "192.0.2.1",
+		},
+		{
+			name:     "nested mappings and sequences",
+			document: "ranges:\n  ipv4:\n    - 203.0.113.0/24\n    - 198.51.100.7\n  ipv6: []\n",
+			ipv4:     "ranges.ipv4",
+			expected: "203.0.113.0/24,198.51.100.7",
+		},
+		{
+			name:     "sequence at the key indentation",
+			document: "ranges:\n- 203.0.113.0/24\n- 192.0.2.1\nname: office\n",
+			ipv4:     "ranges",
+			expected: "203.0.113.0/24,192.0.2.1",
+		},
+		{
+			name:     "sequence of mappings",
+			document: "- cidr: 203.0.113.0/24\n  label: office\n- cidr: 192.0.2.1\n  label: vpn\n",
+			ipv4:     "[?label=='vpn'].cidr",
+			expected: "192.0.2.1",
+		},
+		{
+			name:     "nested sequences",
+			document: "- - 192.0.2.1\n  - 192.0.2.2\n-\n  - 192.0.2.3\n",
+			ipv4:     "[*]",
+			expected: "192.0.2.1,192.0.2.2,192.0.2.3",
+		},
+		{
+			name:     "comments",
+			document: "# header\noffice:\n  cidr: 192.0.2.1 # trailing\n  url: http://example.com/#anchor\n  quoted: \"a # b\"\n",
+			ipv4:     "[?(url=='http://example.com/#anchor' && quoted=='a # b')].cidr",
+			expected: "192.0.2.1",
+		},
+		{
+			name:     "quoting and escapes",
+			document: "office:\n  cidr: \"192.0.2.1\"\n  double: \"tab\\tquote\\\" end\"\n  single: 'it''s'\n  \"quoted key\": 1\n  numeric: \"42\"\n  bool: 'true'\n",
+			ipv4:     `[?(double=="tab\tquote\" end" && single=='it\'s' && quoted key==1 && numeric=='42' && bool=='true')].cidr`,
+			expected: "192.0.2.1",
+		},
+		{
+			name:     "plain scalars that are not numbers",
+			document: "office:\n  cidr: 192.0.2.1\n  hex: 0x1f\n  version: 1.2.3\n  port: \":443\"\n  yes: yes\n",
+			ipv4:     "[?(hex=='0x1f' && version=='1.2.3' && port==':443' && yes==true)].cidr",
+			expected: "192.0.2.1",
+		},
+		{
+			name:     "flow sequences",
+			document: "list: [203.0.113.0/24, \"192.0.2.1\", '192.0.2.2']\nnested: [[198.51.100.1, 198.51.100.2], {a: b}]\nempty: {}\n",
+			ipv4:     "list",
+			ipv6:     "nested[0]",
+			expected: "203.0.113.0/24,192.0.2.1,192.0.2.2,198.51.100.1,198.51.100.2",
+		},
+		{
+			name:     "flow mappings",
+			document: "office: {cidr: 192.0.2.0/24, label: \"x, y\"}\nvpn: {}\n",
+			ipv4:     "[?label=='x, y'].cidr",
+			expected: "192.0.2.0/24",
+		},
+		{
+			name:     "nested flow collections",
+			document: "a: {b: [192.0.2.1, {c: 192.0.2.2}], 'e:f': \"g, \\\"h\\\"\", i}\n",
+			ipv4:     `[?(e:f=='g, "h"' && i==null)].b`,
+			ipv6:     "a.b[1].c",
+			expected: "192.0.2.1,192.0.2.2",
+		},
+		{
+			name:     "block scalars",
+			document: "office:\n  cidr: 192.0.2.1\n  literal: |\n    203.0.113.0/24\n    192.0.2.1\n  folded: >-\n    one\n    two\n  kept: |+\n    line\n\n  next: 1\n",
+			ipv4:     `[?(literal=="203.0.113.0/24\n192.0.2.1\n" && folded=='one two' && kept=="line\n\n" && next==1)].cidr`,
+			expected: "192.0.2.1",
+		},
+		{
+			name:     "document markers, BOM and CRLF",
+			document: "\ufeff---\r\ncidr: 192.0.2.1\r\n...\r\n",
+			ipv4:     "cidr",
+			expected: "192.0.2.1",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "ranges.yaml")
+			writeFile(t, path, test.document)
+
+			cfg := baseConfig("")
+			cfg.WhitelistIPv6 = test.ipv6 != ""
+			cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+				Type: "file",
+				Path: path,
+				JSON: &traefikdynamicpublicwhitelist.JSONSourceConfig{IPv4: test.ipv4, IPv6: test.ipv6},
+			}}
+
+			configuration := loadOnce(t, cfg)
+			if got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ","); got != test.expected {
+				t.Fatalf("unexpected source ranges: %s", got)
+			}
+		})
+	}
+}
+
+func TestDirectorySourceYAMLCommentOnly(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "retired.yaml"), "# only a comment\n\n")
+	writeFile(t, filepath.Join(dir, "office.yml"), "- 192.0.2.1\n")
+
+	cfg := baseConfig("")
+	cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{
+		Type:      "directory",
+		Path:      dir,
+		Directory: &traefikdynamicpublicwhitelist.DirectorySourceConfig{Patterns: []string{"*.yaml", "*.yml"}},
+	}}
+
+	// a comment-only document holds no ranges and is not an error
+	configuration := loadOnce(t, cfg)
+	if got := strings.Join(configuration.HTTP.Middlewares["public_ipwhitelist"].IPWhiteList.SourceRange, ","); got != "192.0.2.1" {
+		t.Fatalf("unexpected source ranges: %s", got)
+	}
+}
+
+func TestFileSourceYAMLErrors(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		document string
+		message  string
+	}{
+		{name: "tab indentation", document: "key:\n\t- value\n", message: "line 2: tabs"},
+		{name: "over-indented key", document: "a: 1\n  b: 2\n", message: "line 2: unexpected indentation"},
+		{name: "over-indented item", document: "- a\n    - b\n", message: "line 2: unexpected indentation"},
+		{name: "item after mapping", document: "a: 1\n- b\n", message: "line 2: expected a mapping key"},
+		{name: "content after root", document: "- a\nb: 1\n", message: "line 2: unexpected content"},
+		{name: "scalar inside mapping", document: "a: 1\nplain\n", message: "line 2: expected a mapping key"},
+		{name: "duplicate key", document: "a: 1\na: 2\n", message: "line 2: duplicate key"},
+		{name: "unterminated double quote", document: "a: \"open\n", message: "line 1: unterminated string"},
+		{name: "unterminated single quote", document: "a: 'open\n", message: "line 1: unterminated string"},
+		{name: "invalid escape", document: "a: \"\\q\"\n", message: "line 1"},
+		{name: "unterminated flow", document: "a: [1, 2\n", message: "line 1: unterminated flow collection"},
+		{name: "content after flow", document: "a: [1] 2\n", message: "line 1: unexpected"},
+		{name: "duplicate flow key", document: "a: {b: 1, b: 2}\n", message: "line 1: duplicate key"},
+		{name: "multiple documents", document: "a: 1\n---\nb: 2\n", message: "line 2: multi-document"},
+		{name: "anchor", document: "a: &base 1\n", message: "line 1: anchors, aliases and tags"},
+		{name: "alias", document: "a: *base\n", message: "line 1: anchors, aliases and tags"},
+		{name: "tag", document: "a: !!str 1\n", message: "line 1: anchors, aliases and tags"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "ranges.yaml")
+			writeFile(t, path, test.document)
+
+			cfg := baseConfig("")
+			cfg.Sources = []traefikdynamicpublicwhitelist.SourceConfig{{Type: "file", Path: path}}
+
+			_, err := newProvider(t, cfg).GenerateConfiguration(context.Background())
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !strings.Contains(err.Error(), test.message) {
+				t.Fatalf("expected error containing %q, got %v", test.message, err)
+			}
+		})
+	}
+}